@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+)
+
+type BulkController interface {
+	Apply(ctx *gin.Context, retention time.Duration) *dto.BulkResult
+}
+
+type bulkController struct {
+	bulkService service.BulkService
+}
+
+func NewBulkController(bulkService service.BulkService) BulkController {
+	return &bulkController{
+		bulkService: bulkService,
+	}
+}
+
+// Apply runs a bulk operation and responds with the outcome of every document, 207 when some
+// of them failed. It returns the result so that the cache and open sessions can follow.
+// Administrators signed in with a session act on any document.
+func (controller *bulkController) Apply(ctx *gin.Context, retention time.Duration) *dto.BulkResult {
+	var request dto.BulkRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return nil
+	}
+	admin := ctx.GetBool("admin") && ctx.GetString("scope") == ""
+	result, err := controller.bulkService.Apply(ctx.Request.Context(), ctx.GetString("email"), admin, request, retention)
+	switch {
+	case errors.Is(err, service.ErrTransactionsUnsupported):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil
+	case errors.Is(err, service.ErrPrincipalNotFound), errors.Is(err, service.ErrFolderNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil
+	case errors.Is(err, service.ErrFolderPermissions), errors.Is(err, service.ErrBulkPermissions):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return nil
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply bulk operation"})
+		return nil
+	}
+	status := http.StatusOK
+	if result.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	ctx.JSON(status, result)
+	return result
+}
@@ -1,53 +1,90 @@
 package controller
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/khallihub/godoc/dto"
 	"github.com/khallihub/godoc/service"
+	"github.com/khallihub/godoc/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DocumentController interface {
-	GetAllDocuments(ctx *gin.Context) ([]*dto.Document, error)
-	SearchDocuments(ctx *gin.Context) ([]*dto.Document, error)
+	ListDocuments(ctx *gin.Context)
+	SearchDocuments(ctx *gin.Context) ([]*dto.SearchResult, error)
 	CreateNewDocument(ctx *gin.Context)
-	UpdateDocument(documentID string, body dto.DocumentData) error
-	GetOneDocument(ctx *gin.Context) (*dto.Document, error)
+	DuplicateDocument(ctx *gin.Context, save func(documentID string) error)
+	UpdateDocument(ctx context.Context, documentID string, body dto.DocumentData, revision int64, editor string) error
+	RecordOpen(ctx context.Context, documentID string, email string) error
+	GetDocumentByID(ctx context.Context, documentID string) (*dto.Document, error)
+	GetRole(ctx context.Context, documentID string, email string) (string, error)
+	Principals(ctx context.Context, email string) ([]string, error)
 	UpdateTitle(ctx *gin.Context) (string, string)
+	UpdateTags(ctx *gin.Context) (string, []string)
 	UpdateCollaborators(ctx *gin.Context) dto.Document
+	AddCollaborator(ctx *gin.Context) dto.Document
+	ChangeCollaboratorRole(ctx *gin.Context) dto.Document
+	RemoveCollaborator(ctx *gin.Context) dto.Document
+	ListInvitations(ctx *gin.Context)
+	RevokeInvitation(ctx *gin.Context)
+	AcceptInvitation(ctx *gin.Context) dto.Document
+	TransferOwnership(ctx *gin.Context) dto.Document
+	TrashDocument(ctx *gin.Context, retention time.Duration) string
+	RestoreDocument(ctx *gin.Context)
 	DeleteDocument(ctx *gin.Context)
+	ListTrash(ctx *gin.Context)
 }
 
 type documentController struct {
-	documentService service.DocumentService
+	documentService   service.DocumentService
+	invitationService service.InvitationService
 }
 
-func NewDocumentController(documentService service.DocumentService) DocumentController {
+func NewDocumentController(documentService service.DocumentService, invitationService service.InvitationService) DocumentController {
 	return &documentController{
-		documentService: documentService,
+		documentService:   documentService,
+		invitationService: invitationService,
 	}
 }
 
-func (controller *documentController) GetAllDocuments(ctx *gin.Context) ([]*dto.Document, error) {
-	// Implement logic to fetch all documents from the MongoDB collection of a single user
-	var email dto.Email
-	err := ctx.ShouldBind(&email)
-	if err != nil {
+// trace starts the span of a controller method and returns the document service running its
+// MongoDB calls in it. The caller ends the span.
+func (controller *documentController) trace(ctx context.Context, method string) (service.DocumentService, trace.Span) {
+	ctx, span := tracing.Tracer.Start(ctx, "DocumentController."+method)
+	return controller.documentService.WithContext(ctx), span
+}
+
+// ListDocuments responds with a page of the caller's documents, the query comes from the
+// URL or the JSON body
+func (controller *documentController) ListDocuments(ctx *gin.Context) {
+	documentService, span := controller.trace(ctx.Request.Context(), "ListDocuments")
+	defer span.End()
+	var query dto.DocumentListQuery
+	if err := ctx.ShouldBind(&query); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
-		return nil, err
+		return
+	}
+	page, err := documentService.ListDocuments(ctx.GetString("email"), query)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	documents, err := controller.documentService.GetAllDocuments(email)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch documents"})
-		return nil, err
+		return
 	}
-
-	return documents, nil
+	ctx.JSON(http.StatusOK, page)
 }
 
-func (contrller *documentController) SearchDocuments(ctx *gin.Context) ([]*dto.Document, error) {
+func (contrller *documentController) SearchDocuments(ctx *gin.Context) ([]*dto.SearchResult, error) {
+	documentService, span := contrller.trace(ctx.Request.Context(), "SearchDocuments")
+	defer span.End()
 	var searchQuery dto.Search
 	// Implement logic to search for documents in the MongoDB collection of a single user
 	err := ctx.ShouldBind(&searchQuery)
@@ -55,7 +92,7 @@ func (contrller *documentController) SearchDocuments(ctx *gin.Context) ([]*dto.D
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return nil, err
 	}
-	documents, err := contrller.documentService.SearchDocuments(searchQuery.Email, searchQuery.SearchQuery)
+	documents, err := documentService.SearchDocuments(ctx.GetString("email"), searchQuery)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search documents"})
 		return nil, err
@@ -65,23 +102,23 @@ func (contrller *documentController) SearchDocuments(ctx *gin.Context) ([]*dto.D
 }
 
 func (controller *documentController) CreateNewDocument(ctx *gin.Context) {
-	var document dto.Document
+	documentService, span := controller.trace(ctx.Request.Context(), "CreateNewDocument")
+	defer span.End()
+	var document dto.CreateDocument
 	if err := ctx.ShouldBindJSON(&document); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	if document.Author == "" {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Author is required"})
+	if !validACL(document.ACL) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role in access list"})
 		return
-	}	
-	if document.ReadAccess == nil {
-		document.ReadAccess = []string{document.Author}
 	}
-	if document.WriteAccess == nil {
-		document.WriteAccess = []string{document.Author}
+	if !knownPrincipals(ctx, documentService, document.ACL) {
+		return
 	}
 
-	documentID, err := controller.documentService.CreateDocument(document.Author, document.Title, document.Data, document.ReadAccess, document.WriteAccess)
+	// The caller owns the documents they create, nobody can create them for someone else
+	documentID, err := documentService.CreateDocument(ctx.GetString("email"), document.Title, document.Data, document.ACL)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create document"})
 		return
@@ -90,28 +127,82 @@ func (controller *documentController) CreateNewDocument(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, gin.H{"message": "Document created successfully", "document_id": documentID})
 }
 
-func (controller *documentController) UpdateDocument(documentID string, body dto.DocumentData) error {
+// DuplicateDocument copies a document the caller can read into a new document they own. save
+// is called first so that edits not yet written from the cache are part of the copy.
+func (controller *documentController) DuplicateDocument(ctx *gin.Context, save func(documentID string) error) {
+	documentService, span := controller.trace(ctx.Request.Context(), "DuplicateDocument")
+	defer span.End()
+	var request dto.DuplicateDocument
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !controller.authorize(ctx, request.DocumentID, dto.RoleViewer) {
+		return
+	}
+	if err := save(request.DocumentID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to duplicate document"})
+		return
+	}
+	documentID, err := documentService.DuplicateDocument(request.DocumentID, ctx.GetString("email"), request.Title)
+	if errors.Is(err, service.ErrDocumentNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to duplicate document"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Document duplicated successfully", "document_id": documentID})
+}
+
+func (controller *documentController) UpdateDocument(ctx context.Context, documentID string, body dto.DocumentData, revision int64, editor string) error {
+	documentService, span := controller.trace(ctx, "UpdateDocument")
+	defer span.End()
 	// Implement logic to update a document in the MongoDB collection of a single user
-	err := controller.documentService.UpdateDocument(documentID, body)
+	err := documentService.UpdateDocument(documentID, body, revision, editor)
 	if err != nil {
+		tracing.Fail(span, err)
 		return err
 	}
 	return nil
 }
 
-func (controller *documentController) GetOneDocument(ctx *gin.Context) (*dto.Document, error) {
-	fmt.Println("GetOneDocument is called")
-	documentID := ctx.Param("id")
-	document, err := controller.documentService.GetDocumentByID(documentID)
-	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
-		return nil, err
-	}
+func (controller *documentController) RecordOpen(ctx context.Context, documentID string, email string) error {
+	documentService, span := controller.trace(ctx, "RecordOpen")
+	defer span.End()
+	err := documentService.RecordOpen(documentID, email)
+	tracing.Fail(span, err)
+	return err
+}
+
+func (controller *documentController) GetDocumentByID(ctx context.Context, documentID string) (*dto.Document, error) {
+	documentService, span := controller.trace(ctx, "GetDocumentByID")
+	defer span.End()
+	document, err := documentService.GetDocumentByID(documentID)
+	tracing.Fail(span, err)
+	return document, err
+}
 
-	return document, nil
+func (controller *documentController) GetRole(ctx context.Context, documentID string, email string) (string, error) {
+	documentService, span := controller.trace(ctx, "GetRole")
+	defer span.End()
+	role, err := documentService.GetRole(documentID, email)
+	tracing.Fail(span, err)
+	return role, err
+}
+
+func (controller *documentController) Principals(ctx context.Context, email string) ([]string, error) {
+	documentService, span := controller.trace(ctx, "Principals")
+	defer span.End()
+	principals, err := documentService.Principals(email)
+	tracing.Fail(span, err)
+	return principals, err
 }
 
 func (controller *documentController) UpdateTitle(ctx *gin.Context) (string, string) {
+	documentService, span := controller.trace(ctx.Request.Context(), "UpdateTitle")
+	defer span.End()
 	var document dto.Title
 	if err := ctx.ShouldBindJSON(&document); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
@@ -125,7 +216,10 @@ func (controller *documentController) UpdateTitle(ctx *gin.Context) (string, str
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Title is required"})
 		return "", ""
 	}
-	_, err := controller.documentService.UpdateTitle(document.ID, document.Title)
+	if !controller.authorize(ctx, document.ID, dto.RoleEditor) {
+		return "", ""
+	}
+	_, err := documentService.UpdateTitle(document.ID, document.Title)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update document title"})
 		return "", ""
@@ -134,21 +228,59 @@ func (controller *documentController) UpdateTitle(ctx *gin.Context) (string, str
 	return document.Title, document.ID
 }
 
+// UpdateTags changes the tags shared with every collaborator, returning the document ID and
+// its tags so that the cached document can be updated
+func (controller *documentController) UpdateTags(ctx *gin.Context) (string, []string) {
+	documentService, span := controller.trace(ctx.Request.Context(), "UpdateTags")
+	defer span.End()
+	var update dto.LabelUpdate
+	if err := ctx.ShouldBindJSON(&update); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return "", nil
+	}
+	if !controller.authorize(ctx, update.DocumentID, dto.RoleEditor) {
+		return "", nil
+	}
+	tags, err := documentService.UpdateTags(update)
+	if errors.Is(err, service.ErrDocumentNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return "", nil
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update document tags"})
+		return "", nil
+	}
+	ctx.JSON(http.StatusOK, gin.H{"tags": tags})
+	return update.DocumentID, tags
+}
+
 func (controller *documentController) UpdateCollaborators(ctx *gin.Context) dto.Document {
+	documentService, span := controller.trace(ctx.Request.Context(), "UpdateCollaborators")
+	defer span.End()
 	var access dto.Access
 	if err := ctx.ShouldBindJSON(&access); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return dto.Document{}
 	}
-	if len(access.ReadAccess) == 0 {
+	if len(access.ACL) == 0 {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Access is required"})
 		return dto.Document{}
 	}
-	if len(access.WriteAccess )== 0 {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Access is required"})
+	if !validACL(access.ACL) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role in access list"})
 		return dto.Document{}
 	}
-	document, err := controller.documentService.UpdateCollaborators(access.ID, access)
+	if service.CountOwners(access.ACL) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "A document needs at least one owner"})
+		return dto.Document{}
+	}
+	if !controller.authorize(ctx, access.ID, dto.RoleOwner) {
+		return dto.Document{}
+	}
+	if !knownPrincipals(ctx, documentService, access.ACL) {
+		return dto.Document{}
+	}
+	document, err := documentService.UpdateCollaborators(access.ID, access)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update document access"})
 		return dto.Document{}
@@ -157,21 +289,328 @@ func (controller *documentController) UpdateCollaborators(ctx *gin.Context) dto.
 	return document
 }
 
-func (controller *documentController) DeleteDocument(ctx *gin.Context) {
-	documentID := ctx.Param("id")	
+// AddCollaborator shares the document with one more principal. Emails without an account are
+// sent an invitation instead, in which case no document is returned.
+func (controller *documentController) AddCollaborator(ctx *gin.Context) dto.Document {
+	documentService, span := controller.trace(ctx.Request.Context(), "AddCollaborator")
+	defer span.End()
+	var collaborator dto.Collaborator
+	if err := ctx.ShouldBindJSON(&collaborator); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return dto.Document{}
+	}
+	if !service.ValidRole(collaborator.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return dto.Document{}
+	}
+	if !controller.authorize(ctx, collaborator.ID, dto.RoleOwner) {
+		return dto.Document{}
+	}
+	entry := dto.ACLEntry{Principal: collaborator.Principal, Role: collaborator.Role}
+	document, err := documentService.AddCollaborator(collaborator.ID, entry)
+	if errors.Is(err, service.ErrPrincipalNotFound) && !strings.HasPrefix(collaborator.Principal, dto.GroupPrincipalPrefix) {
+		controller.invite(ctx, collaborator)
+		return dto.Document{}
+	}
+	if err != nil {
+		respondCollaboratorError(ctx, err, "Failed to add collaborator")
+		return dto.Document{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Collaborator added successfully", "acl": document.ACL})
+	return document
+}
 
+func (controller *documentController) invite(ctx *gin.Context, collaborator dto.Collaborator) {
+	if collaborator.Role == dto.RoleOwner {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Only existing users can be made owners"})
+		return
+	}
+	if _, err := mail.ParseAddress(collaborator.Principal); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return
+	}
+	invitation, err := controller.invitationService.CreateInvitation(collaborator.ID, ctx.GetString("email"), collaborator.Principal, collaborator.Role)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send invitation"})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "Invitation sent successfully", "invitation": invitation})
+}
+
+func (controller *documentController) ChangeCollaboratorRole(ctx *gin.Context) dto.Document {
+	documentService, span := controller.trace(ctx.Request.Context(), "ChangeCollaboratorRole")
+	defer span.End()
+	var collaborator dto.Collaborator
+	if err := ctx.ShouldBindJSON(&collaborator); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return dto.Document{}
+	}
+	if !service.ValidRole(collaborator.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return dto.Document{}
+	}
+	if !controller.authorize(ctx, collaborator.ID, dto.RoleOwner) {
+		return dto.Document{}
+	}
+	document, err := documentService.ChangeCollaboratorRole(collaborator.ID, collaborator.Principal, collaborator.Role)
+	if err != nil {
+		respondCollaboratorError(ctx, err, "Failed to change collaborator role")
+		return dto.Document{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Collaborator role changed successfully", "acl": document.ACL})
+	return document
+}
+
+// RemoveCollaborator takes the principal from the query off the document. Owners can remove
+// anyone, other collaborators can only remove themselves.
+func (controller *documentController) RemoveCollaborator(ctx *gin.Context) dto.Document {
+	documentService, span := controller.trace(ctx.Request.Context(), "RemoveCollaborator")
+	defer span.End()
+	documentID := ctx.Query("document_id")
+	principal := ctx.Query("principal")
+	if documentID == "" || principal == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Document ID and principal are required"})
+		return dto.Document{}
+	}
+	required := dto.RoleOwner
+	if principal == ctx.GetString("email") {
+		required = dto.RoleViewer
+	}
+	if !controller.authorize(ctx, documentID, required) {
+		return dto.Document{}
+	}
+	document, err := documentService.RemoveCollaborator(documentID, principal)
+	if err != nil {
+		respondCollaboratorError(ctx, err, "Failed to remove collaborator")
+		return dto.Document{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Collaborator removed successfully", "acl": document.ACL})
+	return document
+}
+
+func (controller *documentController) ListInvitations(ctx *gin.Context) {
+	documentID := ctx.Query("document_id")
+	if !controller.authorize(ctx, documentID, dto.RoleOwner) {
+		return
+	}
+	invitations, err := controller.invitationService.ListInvitations(documentID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (controller *documentController) RevokeInvitation(ctx *gin.Context) {
+	documentID := ctx.Query("document_id")
+	if !controller.authorize(ctx, documentID, dto.RoleOwner) {
+		return
+	}
+	err := controller.invitationService.RevokeInvitation(documentID, ctx.Param("invitationId"))
+	if errors.Is(err, service.ErrInvitationNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invitation"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+// AcceptInvitation grants the caller the role they were invited with
+func (controller *documentController) AcceptInvitation(ctx *gin.Context) dto.Document {
+	documentService, span := controller.trace(ctx.Request.Context(), "AcceptInvitation")
+	defer span.End()
+	var request dto.AcceptInvitation
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return dto.Document{}
+	}
+	email := ctx.GetString("email")
+	invitation, err := controller.invitationService.AcceptInvitation(request.Token, email)
+	if errors.Is(err, service.ErrInvalidInvitation) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return dto.Document{}
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return dto.Document{}
+	}
+
+	entry := dto.ACLEntry{Principal: email, Role: invitation.Role}
+	document, err := documentService.AddCollaborator(invitation.DocumentID, entry)
+	if errors.Is(err, service.ErrCollaboratorExists) {
+		// Shared with the account in the meantime, keep the role the owners gave it
+		ctx.JSON(http.StatusOK, gin.H{"message": "Invitation accepted", "document_id": invitation.DocumentID})
+		return dto.Document{}
+	}
+	if err != nil {
+		respondCollaboratorError(ctx, err, "Failed to accept invitation")
+		return dto.Document{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Invitation accepted", "document_id": invitation.DocumentID})
+	return document
+}
+
+func respondCollaboratorError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrDocumentNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	case errors.Is(err, service.ErrPrincipalNotFound), errors.Is(err, service.ErrNotCollaborator):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrCollaboratorExists), errors.Is(err, service.ErrLastOwner):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+func (controller *documentController) TransferOwnership(ctx *gin.Context) dto.Document {
+	documentService, span := controller.trace(ctx.Request.Context(), "TransferOwnership")
+	defer span.End()
+	var transfer dto.OwnershipTransfer
+	if err := ctx.ShouldBindJSON(&transfer); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return dto.Document{}
+	}
+	if !controller.authorize(ctx, transfer.ID, dto.RoleOwner) {
+		return dto.Document{}
+	}
+	document, err := documentService.TransferOwnership(transfer.ID, ctx.GetString("email"), transfer.NewOwner)
+	if errors.Is(err, service.ErrPrincipalNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return dto.Document{}
+	}
+	if errors.Is(err, service.ErrNotDirectOwner) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return dto.Document{}
+	}
+	if errors.Is(err, service.ErrACLChanged) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Document access changed, please retry"})
+		return dto.Document{}
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer ownership"})
+		return dto.Document{}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Ownership transferred successfully"})
+	return document
+}
+
+// TrashDocument moves a document to the trash, returning its ID so that its open sessions
+// can be closed
+func (controller *documentController) TrashDocument(ctx *gin.Context, retention time.Duration) string {
+	documentService, span := controller.trace(ctx.Request.Context(), "TrashDocument")
+	defer span.End()
+	documentID := ctx.Param("id")
 	if documentID == "" {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
+		return ""
+	}
+	if !controller.authorize(ctx, documentID, dto.RoleOwner) {
+		return ""
+	}
+	err := documentService.TrashDocument(documentID, ctx.GetString("email"), retention)
+	if errors.Is(err, service.ErrDocumentNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return ""
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
+		return ""
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Document moved to trash"})
+	return documentID
+}
+
+func (controller *documentController) RestoreDocument(ctx *gin.Context) {
+	documentService, span := controller.trace(ctx.Request.Context(), "RestoreDocument")
+	defer span.End()
+	err := documentService.RestoreDocument(ctx.Param("id"), ctx.GetString("email"))
+	if errors.Is(err, service.ErrDocumentNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found in trash"})
 		return
 	}
-	s, err := controller.documentService.DeleteDocument(documentID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore document"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Document restored successfully"})
+}
+
+// DeleteDocument deletes a document in the trash for good
+func (controller *documentController) DeleteDocument(ctx *gin.Context) {
+	documentService, span := controller.trace(ctx.Request.Context(), "DeleteDocument")
+	defer span.End()
+	deleted, err := documentService.DeleteDocument(ctx.Param("id"), ctx.GetString("email"))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete document"})
 		return
 	}
-	if s == false {
-		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	if !deleted {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found in trash"})
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"message": "Document deleted successfully"})
-}
\ No newline at end of file
+}
+
+func (controller *documentController) ListTrash(ctx *gin.Context) {
+	documentService, span := controller.trace(ctx.Request.Context(), "ListTrash")
+	defer span.End()
+	documents, err := documentService.ListTrash(ctx.GetString("email"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch trash"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"documents": documents})
+}
+
+// authorize checks that the caller holds at least the required role on the document,
+// responding with an error when it doesn't
+func (controller *documentController) authorize(ctx *gin.Context, documentID string, required string) bool {
+	return authorizeDocument(ctx, controller.documentService, documentID, required)
+}
+
+// authorizeDocument checks that the caller holds at least the required role on the document,
+// responding with an error when it doesn't. Documents the caller can't see are reported as missing.
+func authorizeDocument(ctx *gin.Context, documentService service.DocumentService, documentID string, required string) bool {
+	role, err := documentService.WithContext(ctx.Request.Context()).GetRole(documentID, ctx.GetString("email"))
+	if errors.Is(err, service.ErrDocumentNotFound) || (err == nil && role == "") {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check document access"})
+		return false
+	}
+	if !service.RoleAllows(role, required) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return false
+	}
+	return true
+}
+
+// knownPrincipals checks that every principal of an access list names a user or group,
+// answering the request otherwise. Emails without an account are invited one at a time.
+func knownPrincipals(ctx *gin.Context, documentService service.DocumentService, acl []dto.ACLEntry) bool {
+	principal, err := documentService.UnknownPrincipal(acl)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access list"})
+		return false
+	}
+	if principal != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "No user or group named " + principal})
+		return false
+	}
+	return true
+}
+
+func validACL(acl []dto.ACLEntry) bool {
+	for _, entry := range acl {
+		if entry.Principal == "" || !service.ValidRole(entry.Role) {
+			return false
+		}
+	}
+	return true
+}
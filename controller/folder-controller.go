@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+)
+
+type FolderController interface {
+	CreateFolder(ctx *gin.Context)
+	GetContents(ctx *gin.Context)
+	Breadcrumbs(folderID string, email string) ([]dto.Breadcrumb, error)
+	RenameFolder(ctx *gin.Context)
+	MoveFolder(ctx *gin.Context) []string
+	ShareFolder(ctx *gin.Context) []string
+	DeleteFolder(ctx *gin.Context) []string
+	MoveDocument(ctx *gin.Context) *dto.Document
+}
+
+type folderController struct {
+	folderService service.FolderService
+}
+
+func NewFolderController(folderService service.FolderService) FolderController {
+	return &folderController{
+		folderService: folderService,
+	}
+}
+
+func (controller *folderController) CreateFolder(ctx *gin.Context) {
+	var request dto.CreateFolder
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	folder, err := controller.folderService.CreateFolder(ctx.GetString("email"), request)
+	if err != nil {
+		respondFolderError(ctx, err, "Failed to create folder")
+		return
+	}
+	ctx.JSON(http.StatusCreated, folder)
+}
+
+// GetContents responds with the folder of the :id parameter and its subfolders, or with the
+// top level folders when there is none
+func (controller *folderController) GetContents(ctx *gin.Context) {
+	contents, err := controller.folderService.GetContents(ctx.Param("id"), ctx.GetString("email"))
+	if err != nil {
+		respondFolderError(ctx, err, "Failed to fetch folder")
+		return
+	}
+	ctx.JSON(http.StatusOK, contents)
+}
+
+func (controller *folderController) Breadcrumbs(folderID string, email string) ([]dto.Breadcrumb, error) {
+	return controller.folderService.Breadcrumbs(folderID, email)
+}
+
+func (controller *folderController) RenameFolder(ctx *gin.Context) {
+	var request dto.RenameFolder
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	folder, err := controller.folderService.RenameFolder(ctx.Param("id"), ctx.GetString("email"), request.Name)
+	if err != nil {
+		respondFolderError(ctx, err, "Failed to rename folder")
+		return
+	}
+	ctx.JSON(http.StatusOK, folder)
+}
+
+// MoveFolder moves the folder and returns the documents whose inherited access changed
+func (controller *folderController) MoveFolder(ctx *gin.Context) []string {
+	var request dto.MoveFolder
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return nil
+	}
+	documentIDs, err := controller.folderService.MoveFolder(ctx.Param("id"), ctx.GetString("email"), request.ParentID)
+	if err != nil {
+		respondFolderError(ctx, err, "Failed to move folder")
+		return nil
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Folder moved successfully"})
+	return documentIDs
+}
+
+// ShareFolder changes a role on the folder and returns the documents whose inherited access changed
+func (controller *folderController) ShareFolder(ctx *gin.Context) []string {
+	var share dto.FolderShare
+	if err := ctx.ShouldBindJSON(&share); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return nil
+	}
+	documentIDs, err := controller.folderService.ShareFolder(ctx.Param("id"), ctx.GetString("email"), share)
+	if err != nil {
+		respondFolderError(ctx, err, "Failed to share folder")
+		return nil
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Folder access updated successfully"})
+	return documentIDs
+}
+
+// DeleteFolder deletes the folder and returns the documents whose inherited access changed
+func (controller *folderController) DeleteFolder(ctx *gin.Context) []string {
+	documentIDs, err := controller.folderService.DeleteFolder(ctx.Param("id"), ctx.GetString("email"))
+	if err != nil {
+		respondFolderError(ctx, err, "Failed to delete folder")
+		return nil
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Folder deleted successfully"})
+	return documentIDs
+}
+
+// MoveDocument files the document in a folder and returns it with its new inherited access
+func (controller *folderController) MoveDocument(ctx *gin.Context) *dto.Document {
+	var move dto.MoveDocument
+	if err := ctx.ShouldBindJSON(&move); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return nil
+	}
+	document, err := controller.folderService.MoveDocument(ctx.GetString("email"), move)
+	if err != nil {
+		respondFolderError(ctx, err, "Failed to move document")
+		return nil
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Document moved successfully", "folderId": document.FolderID})
+	return document
+}
+
+func respondFolderError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrFolderNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrDocumentNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	case errors.Is(err, service.ErrFolderPermissions):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRole):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrFolderCycle), errors.Is(err, service.ErrLastOwner), errors.Is(err, service.ErrACLChanged):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
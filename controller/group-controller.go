@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+)
+
+type GroupController interface {
+	CreateGroup(ctx *gin.Context)
+	ListGroups(ctx *gin.Context)
+	GetGroup(ctx *gin.Context)
+	AddMember(ctx *gin.Context) []string
+	RemoveMember(ctx *gin.Context) []string
+	DeleteGroup(ctx *gin.Context) []string
+}
+
+type groupController struct {
+	groupService service.GroupService
+}
+
+func NewGroupController(groupService service.GroupService) GroupController {
+	return &groupController{
+		groupService: groupService,
+	}
+}
+
+func (controller *groupController) CreateGroup(ctx *gin.Context) {
+	var request dto.CreateGroup
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	group, err := controller.groupService.CreateGroup(ctx.GetString("email"), request.Name)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create group"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, group)
+}
+
+func (controller *groupController) ListGroups(ctx *gin.Context) {
+	groups, err := controller.groupService.ListGroups(ctx.GetString("email"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch groups"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"groups": groups})
+}
+
+func (controller *groupController) GetGroup(ctx *gin.Context) {
+	group, err := controller.groupService.GetGroup(ctx.Param("id"), ctx.GetString("email"))
+	if err != nil {
+		respondGroupError(ctx, err, "Failed to fetch group")
+		return
+	}
+	ctx.JSON(http.StatusOK, group)
+}
+
+// AddMember adds or updates a member and returns the users whose access changed
+func (controller *groupController) AddMember(ctx *gin.Context) []string {
+	var member dto.GroupMember
+	if err := ctx.ShouldBindJSON(&member); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return nil
+	}
+	group, err := controller.groupService.AddMember(ctx.Param("id"), ctx.GetString("email"), member)
+	if err != nil {
+		respondGroupError(ctx, err, "Failed to add group member")
+		return nil
+	}
+	ctx.JSON(http.StatusOK, group)
+	return []string{member.Email}
+}
+
+// RemoveMember removes a member and returns the users whose access changed
+func (controller *groupController) RemoveMember(ctx *gin.Context) []string {
+	member := ctx.Param("email")
+	group, err := controller.groupService.RemoveMember(ctx.Param("id"), ctx.GetString("email"), member)
+	if err != nil {
+		respondGroupError(ctx, err, "Failed to remove group member")
+		return nil
+	}
+	ctx.JSON(http.StatusOK, group)
+	return []string{member}
+}
+
+// DeleteGroup deletes the group and returns its former members, who all lose its roles
+func (controller *groupController) DeleteGroup(ctx *gin.Context) []string {
+	group, err := controller.groupService.DeleteGroup(ctx.Param("id"), ctx.GetString("email"))
+	if err != nil {
+		respondGroupError(ctx, err, "Failed to delete group")
+		return nil
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Group deleted successfully"})
+	return group.Members
+}
+
+func respondGroupError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrGroupNotFound), errors.Is(err, service.ErrPrincipalNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotGroupAdmin):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrLastGroupAdmin):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+)
+
+type LabelController interface {
+	GetLabels(documentID string, email string) (*dto.DocumentLabels, error)
+	SetStarred(ctx *gin.Context)
+	UpdateLabels(ctx *gin.Context)
+	ListLabels(ctx *gin.Context)
+}
+
+type labelController struct {
+	labelService    service.LabelService
+	documentService service.DocumentService
+}
+
+func NewLabelController(labelService service.LabelService, documentService service.DocumentService) LabelController {
+	return &labelController{
+		labelService:    labelService,
+		documentService: documentService,
+	}
+}
+
+func (controller *labelController) GetLabels(documentID string, email string) (*dto.DocumentLabels, error) {
+	return controller.labelService.GetLabels(documentID, email)
+}
+
+// SetStarred stars or unstars a document for the caller, any role on it is enough
+func (controller *labelController) SetStarred(ctx *gin.Context) {
+	var star dto.Star
+	if err := ctx.ShouldBindJSON(&star); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !authorizeDocument(ctx, controller.documentService, star.DocumentID, dto.RoleViewer) {
+		return
+	}
+	labels, err := controller.labelService.SetStarred(star.DocumentID, ctx.GetString("email"), star.Starred)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to star document"})
+		return
+	}
+	ctx.JSON(http.StatusOK, labels)
+}
+
+// UpdateLabels adds and removes the caller's own labels on a document
+func (controller *labelController) UpdateLabels(ctx *gin.Context) {
+	var update dto.LabelUpdate
+	if err := ctx.ShouldBindJSON(&update); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !authorizeDocument(ctx, controller.documentService, update.DocumentID, dto.RoleViewer) {
+		return
+	}
+	labels, err := controller.labelService.UpdateLabels(ctx.GetString("email"), update)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update labels"})
+		return
+	}
+	ctx.JSON(http.StatusOK, labels)
+}
+
+func (controller *labelController) ListLabels(ctx *gin.Context) {
+	labels, err := controller.labelService.ListLabels(ctx.GetString("email"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch labels"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"labels": labels})
+}
@@ -7,31 +7,69 @@ import (
 )
 
 type LoginController interface {
-	Login(ctx *gin.Context) string
+	Login(ctx *gin.Context) *dto.LoginResponse
+	LoginWithMFA(ctx *gin.Context) string
 }
 
 type loginController struct {
 	loginService service.LoginService
 	jWtService   service.JWTService
+	mfaService   service.MFAService
 }
 
 func NewLoginController(loginService service.LoginService,
-	jWtService service.JWTService) LoginController {
+	jWtService service.JWTService, mfaService service.MFAService) LoginController {
 	return &loginController{
 		loginService: loginService,
 		jWtService:   jWtService,
+		mfaService:   mfaService,
 	}
 }
 
-func (controller *loginController) Login(ctx *gin.Context) string {
+func (controller *loginController) Login(ctx *gin.Context) *dto.LoginResponse {
 	var credentials dto.Login
 	err := ctx.ShouldBind(&credentials)
 	if err != nil {
-		return ""
+		return nil
 	}
 	isAuthenticated := controller.loginService.Login(credentials.Email, credentials.Password)
-	if isAuthenticated {
-		return controller.jWtService.GenerateToken(credentials.Email, true)
+	if !isAuthenticated {
+		return nil
+	}
+
+	// Users with two-factor enabled, or who must enroll because of the policy, only get a
+	// pending token until the second step is completed
+	if controller.mfaService.IsEnabled(credentials.Email) {
+		return &dto.LoginResponse{
+			MFARequired: true,
+			MFAToken:    controller.jWtService.GenerateMFAToken(credentials.Email),
+		}
+	}
+	if controller.mfaService.IsRequired() {
+		return &dto.LoginResponse{
+			MFAEnrollmentRequired: true,
+			MFAToken:              controller.jWtService.GenerateMFAToken(credentials.Email),
+		}
+	}
+
+	admin := controller.loginService.IsAdmin(credentials.Email)
+	return &dto.LoginResponse{
+		Token: controller.jWtService.GenerateToken(credentials.Email, admin),
+	}
+}
+
+func (controller *loginController) LoginWithMFA(ctx *gin.Context) string {
+	var credentials dto.MFALogin
+	err := ctx.ShouldBindJSON(&credentials)
+	if err != nil {
+		return ""
+	}
+	email, err := controller.jWtService.ValidateMFAToken(credentials.MFAToken)
+	if err != nil {
+		return ""
+	}
+	if !controller.mfaService.Verify(email, credentials.Code) {
+		return ""
 	}
-	return ""
+	return controller.jWtService.GenerateToken(email, controller.loginService.IsAdmin(email))
 }
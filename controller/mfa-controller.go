@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+)
+
+type MFAController interface {
+	Enroll(ctx *gin.Context)
+	ConfirmEnrollment(ctx *gin.Context)
+	RegenerateRecoveryCodes(ctx *gin.Context)
+	Disable(ctx *gin.Context)
+	GetPolicy(ctx *gin.Context)
+	SetPolicy(ctx *gin.Context)
+}
+
+type mfaController struct {
+	mfaService   service.MFAService
+	loginService service.LoginService
+	jWtService   service.JWTService
+}
+
+func NewMFAController(mfaService service.MFAService, loginService service.LoginService,
+	jWtService service.JWTService) MFAController {
+	return &mfaController{
+		mfaService:   mfaService,
+		loginService: loginService,
+		jWtService:   jWtService,
+	}
+}
+
+func (controller *mfaController) Enroll(ctx *gin.Context) {
+	email := ctx.GetString("email")
+	enrollment, err := controller.mfaService.Enroll(email)
+	if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor enrollment"})
+		return
+	}
+	ctx.JSON(http.StatusOK, enrollment)
+}
+
+func (controller *mfaController) ConfirmEnrollment(ctx *gin.Context) {
+	var code dto.MFACode
+	if err := ctx.ShouldBindJSON(&code); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	email := ctx.GetString("email")
+	recoveryCodes, err := controller.mfaService.ConfirmEnrollment(email, code.Code)
+	switch {
+	case errors.Is(err, service.ErrMFAInvalidCode), errors.Is(err, service.ErrMFANoPending):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrMFAAlreadyEnabled):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	// Enrollment completes the login of users that were forced to enroll by the policy
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": recoveryCodes,
+		"token":         controller.jWtService.GenerateToken(email, controller.loginService.IsAdmin(email)),
+	})
+}
+
+func (controller *mfaController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var code dto.MFACode
+	if err := ctx.ShouldBindJSON(&code); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	recoveryCodes, err := controller.mfaService.RegenerateRecoveryCodes(ctx.GetString("email"), code.Code)
+	if errors.Is(err, service.ErrMFAInvalidCode) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to regenerate recovery codes"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"recoveryCodes": recoveryCodes})
+}
+
+func (controller *mfaController) Disable(ctx *gin.Context) {
+	var code dto.MFACode
+	if err := ctx.ShouldBindJSON(&code); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	err := controller.mfaService.Disable(ctx.GetString("email"), code.Code)
+	switch {
+	case errors.Is(err, service.ErrMFAInvalidCode):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrMFANotEnabled):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrMFAPolicyRequired):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func (controller *mfaController) GetPolicy(ctx *gin.Context) {
+	policy, err := controller.mfaService.GetPolicy()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch two-factor policy"})
+		return
+	}
+	ctx.JSON(http.StatusOK, policy)
+}
+
+func (controller *mfaController) SetPolicy(ctx *gin.Context) {
+	var policy dto.MFAPolicy
+	if err := ctx.ShouldBindJSON(&policy); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := controller.mfaService.SetPolicy(policy); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update two-factor policy"})
+		return
+	}
+	ctx.JSON(http.StatusOK, policy)
+}
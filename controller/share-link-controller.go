@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/middlewares"
+	"github.com/khallihub/godoc/service"
+)
+
+type ShareLinkController interface {
+	CreateLink(ctx *gin.Context)
+	ListLinks(ctx *gin.Context)
+	RevokeLink(ctx *gin.Context) string
+	ResolveLink(ctx *gin.Context) *dto.ShareLink
+}
+
+type shareLinkController struct {
+	shareLinkService service.ShareLinkService
+	documentService  service.DocumentService
+}
+
+func NewShareLinkController(shareLinkService service.ShareLinkService, documentService service.DocumentService) ShareLinkController {
+	return &shareLinkController{
+		shareLinkService: shareLinkService,
+		documentService:  documentService,
+	}
+}
+
+func (controller *shareLinkController) CreateLink(ctx *gin.Context) {
+	var request dto.CreateShareLink
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !authorizeDocument(ctx, controller.documentService, request.DocumentID, dto.RoleOwner) {
+		return
+	}
+	token, link, err := controller.shareLinkService.CreateLink(ctx.GetString("email"), request)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share link"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{
+		"message": "Share link created successfully, the token will not be shown again",
+		"token":   token,
+		"link":    link,
+	})
+}
+
+func (controller *shareLinkController) ListLinks(ctx *gin.Context) {
+	documentID := ctx.Query("document_id")
+	if !authorizeDocument(ctx, controller.documentService, documentID, dto.RoleOwner) {
+		return
+	}
+	links, err := controller.shareLinkService.ListLinks(documentID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share links"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"links": links})
+}
+
+// RevokeLink deletes a share link and returns its ID so that its sessions can be closed
+func (controller *shareLinkController) RevokeLink(ctx *gin.Context) string {
+	documentID := ctx.Query("document_id")
+	linkID := ctx.Param("linkId")
+	if !authorizeDocument(ctx, controller.documentService, documentID, dto.RoleOwner) {
+		return ""
+	}
+	err := controller.shareLinkService.RevokeLink(documentID, linkID)
+	if errors.Is(err, service.ErrShareLinkNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return ""
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke share link"})
+		return ""
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Share link revoked successfully"})
+	return linkID
+}
+
+// ResolveLink checks the share token of the request, from the JSON body or the "share" and
+// "password" query parameters, responding with an error when it can't be used
+func (controller *shareLinkController) ResolveLink(ctx *gin.Context) *dto.ShareLink {
+	var request dto.OpenShareLink
+	if err := ctx.ShouldBind(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return nil
+	}
+	link, err := controller.shareLinkService.Resolve(request.Token, request.Password, ctx.GetString("email"))
+	switch {
+	case errors.Is(err, service.ErrShareLinkNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil
+	case errors.Is(err, service.ErrShareLinkPassword), errors.Is(err, service.ErrShareLinkSignIn):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil
+	case errors.Is(err, service.ErrShareLinkDomain):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return nil
+	case err != nil:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open share link"})
+		return nil
+	}
+	// A token for other documents would otherwise open this one with its owner's role
+	if !middlewares.TokenAllowsDocument(ctx, link.DocumentID) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Token is not valid for this document"})
+		return nil
+	}
+	return link
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+)
+
+type TemplateController interface {
+	ListTemplates(ctx *gin.Context)
+	MarkTemplate(ctx *gin.Context)
+	UnmarkTemplate(ctx *gin.Context)
+	UseTemplate(ctx *gin.Context, save func(documentID string) error)
+}
+
+type templateController struct {
+	documentService service.DocumentService
+}
+
+func NewTemplateController(documentService service.DocumentService) TemplateController {
+	return &templateController{
+		documentService: documentService,
+	}
+}
+
+func (controller *templateController) ListTemplates(ctx *gin.Context) {
+	templates, err := controller.documentService.ListTemplates(ctx.GetString("email"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// MarkTemplate offers a document as a template. Owners choose the scope: their own gallery, a
+// group they belong to or, for administrators, everybody.
+func (controller *templateController) MarkTemplate(ctx *gin.Context) {
+	var request dto.MarkTemplate
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !authorizeDocument(ctx, controller.documentService, request.DocumentID, dto.RoleOwner) {
+		return
+	}
+	template := &dto.Template{
+		Scope:       request.Scope,
+		Description: request.Description,
+		MarkedBy:    ctx.GetString("email"),
+	}
+	switch request.Scope {
+	case dto.TemplateScopeGlobal:
+		if !ctx.GetBool("admin") {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can publish global templates"})
+			return
+		}
+	case dto.TemplateScopeTeam:
+		principals, err := controller.documentService.Principals(ctx.GetString("email"))
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check group membership"})
+			return
+		}
+		member := false
+		for _, principal := range principals {
+			member = member || principal == service.GroupPrincipal(request.GroupID)
+		}
+		if !member {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Not a member of the group"})
+			return
+		}
+		template.GroupID = request.GroupID
+	}
+	if err := controller.documentService.SetTemplate(request.DocumentID, template); err != nil {
+		respondTemplateError(ctx, err, "Failed to mark template")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"template": template})
+}
+
+func (controller *templateController) UnmarkTemplate(ctx *gin.Context) {
+	documentID := ctx.Param("id")
+	if !authorizeDocument(ctx, controller.documentService, documentID, dto.RoleOwner) {
+		return
+	}
+	if err := controller.documentService.SetTemplate(documentID, nil); err != nil {
+		respondTemplateError(ctx, err, "Failed to withdraw template")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Template withdrawn successfully"})
+}
+
+// UseTemplate creates a document owned by the caller from a template in their gallery, the
+// request body is optional. save is called first so that edits not yet written from the cache
+// are part of the new document.
+func (controller *templateController) UseTemplate(ctx *gin.Context, save func(documentID string) error) {
+	var request dto.UseTemplate
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+	}
+	if err := save(ctx.Param("id")); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create document from template"})
+		return
+	}
+	documentID, err := controller.documentService.CreateFromTemplate(ctx.Param("id"), ctx.GetString("email"), request.Title)
+	if err != nil {
+		respondTemplateError(ctx, err, "Failed to create document from template")
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{"message": "Document created successfully", "document_id": documentID})
+}
+
+func respondTemplateError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrTemplateNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+	case errors.Is(err, service.ErrDocumentNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+)
+
+type TokenController interface {
+	CreateToken(ctx *gin.Context)
+	ListTokens(ctx *gin.Context)
+	RevokeToken(ctx *gin.Context)
+}
+
+type tokenController struct {
+	tokenService service.TokenService
+}
+
+func NewTokenController(tokenService service.TokenService) TokenController {
+	return &tokenController{
+		tokenService: tokenService,
+	}
+}
+
+func (controller *tokenController) CreateToken(ctx *gin.Context) {
+	var request dto.CreateToken
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	secret, token, err := controller.tokenService.CreateToken(ctx.GetString("email"), request)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	ctx.JSON(http.StatusCreated, gin.H{
+		"message": "Token created successfully, it will not be shown again",
+		"token":   secret,
+		"details": token,
+	})
+}
+
+func (controller *tokenController) ListTokens(ctx *gin.Context) {
+	tokens, err := controller.tokenService.ListTokens(ctx.GetString("email"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+func (controller *tokenController) RevokeToken(ctx *gin.Context) {
+	err := controller.tokenService.RevokeToken(ctx.GetString("email"), ctx.Param("id"))
+	if errors.Is(err, service.ErrTokenNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+)
+
+type UserController interface {
+	GetMe(ctx *gin.Context)
+	UpdateMe(ctx *gin.Context)
+	GetProfile(ctx *gin.Context)
+	RequestEmailChange(ctx *gin.Context)
+	VerifyEmailChange(ctx *gin.Context)
+	DeleteMe(ctx *gin.Context) []string
+}
+
+type userController struct {
+	userService service.UserService
+}
+
+func NewUserController(userService service.UserService) UserController {
+	return &userController{
+		userService: userService,
+	}
+}
+
+func (controller *userController) GetMe(ctx *gin.Context) {
+	user, err := controller.userService.GetUser(ctx.GetString("email"))
+	if err != nil {
+		respondUserError(ctx, err, "Failed to fetch user")
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (controller *userController) UpdateMe(ctx *gin.Context) {
+	var update dto.ProfileUpdate
+	if err := ctx.ShouldBindJSON(&update); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if update.DisplayName != nil && *update.DisplayName == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Display name cannot be empty"})
+		return
+	}
+	user, err := controller.userService.UpdateProfile(ctx.GetString("email"), update)
+	if err != nil {
+		respondUserError(ctx, err, "Failed to update user")
+		return
+	}
+	ctx.JSON(http.StatusOK, user)
+}
+
+func (controller *userController) GetProfile(ctx *gin.Context) {
+	email := ctx.Query("email")
+	if email == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		return
+	}
+	profile, err := controller.userService.GetProfile(email)
+	if err != nil {
+		respondUserError(ctx, err, "Failed to fetch profile")
+		return
+	}
+	ctx.JSON(http.StatusOK, profile)
+}
+
+func (controller *userController) RequestEmailChange(ctx *gin.Context) {
+	var request dto.EmailChangeRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	err := controller.userService.RequestEmailChange(ctx.GetString("email"), request.Password, request.NewEmail)
+	if err != nil {
+		respondUserError(ctx, err, "Failed to request email change")
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent to the new address"})
+}
+
+func (controller *userController) VerifyEmailChange(ctx *gin.Context) {
+	var verification dto.EmailVerification
+	if err := ctx.ShouldBindJSON(&verification); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	email, err := controller.userService.VerifyEmailChange(verification.Token)
+	if err != nil {
+		respondUserError(ctx, err, "Failed to verify email change")
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Email address updated, please log in again", "email": email})
+}
+
+// DeleteMe removes the caller's account and returns the IDs of the documents deleted with it
+func (controller *userController) DeleteMe(ctx *gin.Context) []string {
+	var deletion dto.AccountDeletion
+	if err := ctx.ShouldBindJSON(&deletion); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return nil
+	}
+	email := ctx.GetString("email")
+	if deletion.TransferTo == email {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Cannot transfer documents to the deleted account"})
+		return nil
+	}
+	documentIDs, err := controller.userService.DeleteUser(email, deletion.Password, deletion.TransferTo)
+	if err != nil {
+		respondUserError(ctx, err, "Failed to delete account")
+		return nil
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+	return documentIDs
+}
+
+func respondUserError(ctx *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidPassword):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrEmailTaken):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidVerifyToken):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
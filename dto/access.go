@@ -1,7 +1,33 @@
 package dto
 
+// Roles a principal can hold on a document, from most to least privileged
+const (
+	RoleOwner     = "owner"
+	RoleEditor    = "editor"
+	RoleCommenter = "commenter"
+	RoleViewer    = "viewer"
+)
+
+// ACLEntry grants a role on a document to a principal, currently a user's email
+type ACLEntry struct {
+	Principal string `json:"principal" bson:"principal"`
+	Role      string `json:"role" bson:"role"`
+}
+
 type Access struct {
-	ID     string `json:"document_id" bson:"_id"`
-	ReadAccess []string `json:"readAccess" bson:"readAccess"`
-	WriteAccess []string `json:"writeAccess" bson:"writeAccess"`
+	ID  string     `json:"document_id" bson:"_id"`
+	ACL []ACLEntry `json:"acl" bson:"acl"`
+}
+
+type OwnershipTransfer struct {
+	ID       string `json:"document_id" binding:"required"`
+	NewOwner string `json:"newOwner" binding:"required"`
+}
+
+// Collaborator adds a principal to a document or changes its role, without touching the
+// rest of the access list
+type Collaborator struct {
+	ID        string `json:"document_id" binding:"required"`
+	Principal string `json:"principal" binding:"required"`
+	Role      string `json:"role" binding:"required"`
 }
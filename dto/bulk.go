@@ -0,0 +1,53 @@
+package dto
+
+// Operations of the bulk API
+const (
+	BulkDelete   = "delete"
+	BulkRestore  = "restore"
+	BulkMove     = "move"
+	BulkRetag    = "retag"
+	BulkTransfer = "transfer"
+	BulkShare    = "share"
+)
+
+// Outcomes of the documents of a bulk request
+const (
+	BulkSucceeded  = "ok"
+	BulkFailed     = "failed"
+	BulkRolledBack = "rolledBack"
+	BulkSkipped    = "skipped"
+)
+
+// BulkRequest applies one operation to many documents. Delete moves them to the trash and
+// restore takes them out of it. The other fields are the arguments of the operation: FolderID
+// for move (empty for the root), Add and Remove for retag, From and To for transfer and
+// Principal and Role for share, where an empty role removes the principal.
+type BulkRequest struct {
+	Operation   string   `json:"operation" binding:"required,oneof=delete restore move retag transfer share"`
+	DocumentIDs []string `json:"document_ids" binding:"required,min=1,max=500,dive,required"`
+	// Atomic applies all the changes or none of them, it needs a database with transactions
+	Atomic    bool     `json:"atomic"`
+	FolderID  string   `json:"folderId"`
+	Add       []string `json:"add" binding:"max=20,dive,max=50"`
+	Remove    []string `json:"remove" binding:"max=20,dive,max=50"`
+	From      string   `json:"from"`
+	To        string   `json:"to" binding:"required_if=Operation transfer"`
+	Principal string   `json:"principal" binding:"required_if=Operation share"`
+	Role      string   `json:"role" binding:"omitempty,oneof=owner editor commenter viewer"`
+}
+
+type BulkItemResult struct {
+	DocumentID string `json:"document_id"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BulkResult reports the outcome of every document of a bulk request in the request's order.
+// Transactional tells whether the changes of each document were applied in a transaction.
+type BulkResult struct {
+	Operation     string           `json:"operation"`
+	Transactional bool             `json:"transactional"`
+	Succeeded     int              `json:"succeeded"`
+	Failed        int              `json:"failed"`
+	Results       []BulkItemResult `json:"results"`
+}
@@ -0,0 +1,57 @@
+package dto
+
+import "time"
+
+// Filters and sort orders of the document list
+const (
+	ListOwned  = "owned"
+	ListShared = "shared"
+
+	SortTitle    = "title"
+	SortCreated  = "created"
+	SortModified = "modified"
+	SortOpened   = "opened"
+	// SortRelevance orders search results by how well they match, the default for searches
+	SortRelevance = "relevance"
+
+	// RootFolder lists the documents outside of any folder the user can see
+	RootFolder = "root"
+)
+
+// DocumentListQuery selects a page of the documents a user can access. Tag filters on the
+// shared tags, Starred and Label on the caller's own marks. Cursor is the NextCursor of the
+// previous page and must be used with the same filters and sort.
+type DocumentListQuery struct {
+	Filter       string `json:"filter" form:"filter" binding:"omitempty,oneof=owned shared"`
+	Collaborator string `json:"collaborator" form:"collaborator"`
+	Folder       string `json:"folder" form:"folder"`
+	Tag          string `json:"tag" form:"tag"`
+	Starred      bool   `json:"starred" form:"starred"`
+	Label        string `json:"label" form:"label"`
+	Sort         string `json:"sort" form:"sort" binding:"omitempty,oneof=title created modified opened"`
+	Order        string `json:"order" form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit        int64  `json:"limit" form:"limit" binding:"min=0,max=100"`
+	Cursor       string `json:"cursor" form:"cursor"`
+}
+
+// DocumentListItem is a document as shown on the home screen, without its body
+type DocumentListItem struct {
+	ID            string `json:"id" bson:"_id"`
+	Title         string `json:"title" bson:"title"`
+	Owner         string `json:"owner" bson:"author"`
+	DocumentStats `bson:",inline"`
+	// LastOpenedAt is when the user last opened the document, nil if they never did
+	LastOpenedAt *time.Time `json:"lastOpenedAt,omitempty" bson:"lastOpenedAt"`
+	Tags         []string   `json:"tags" bson:"tags"`
+	Role         string     `json:"role" bson:"-"`
+	Snippet      string     `json:"snippet" bson:"-"`
+	// Starred and Labels are the caller's own marks
+	Starred bool     `json:"starred" bson:"-"`
+	Labels  []string `json:"labels" bson:"-"`
+}
+
+type DocumentPage struct {
+	Documents []*DocumentListItem `json:"documents"`
+	// NextCursor is empty on the last page
+	NextCursor string `json:"nextCursor,omitempty"`
+}
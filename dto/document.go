@@ -1,19 +1,58 @@
 package dto
 
+import "time"
+
 type DocumentData struct {
 	Ops []map[string]interface{} `json:"ops" bson:"ops"`
 }
 
 type Document struct {
-	ID     string        `json:"id" bson:"_id,omitempty"`
-	Author string        `json:"author" binding:"required"`
-	ReadAccess []string      `json:"readAccess" bson:"readAccess"`
-	WriteAccess []string      `json:"writeAccess" bson:"writeAccess"`
-	Title  string        `json:"title"`
+	ID     string       `json:"id" bson:"_id,omitempty"`
+	Author string       `json:"author" binding:"required"`
+	ACL    []ACLEntry   `json:"acl" bson:"acl"`
+	Title  string       `json:"title"`
 	Data   DocumentData `json:"data" bson:"data"`
+
+	// FolderID is the folder holding the document, empty at the root
+	FolderID string `json:"folderId,omitempty" bson:"folderId,omitempty"`
+	// InheritedACL is the access granted by the folder and its ancestors, kept up to date by
+	// the folder service
+	InheritedACL []ACLEntry `json:"inheritedAcl,omitempty" bson:"inheritedAcl,omitempty"`
+	// Tags are shared with every collaborator and set by editors
+	Tags []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	// Template is set when the document is offered as a template
+	Template *Template `json:"template,omitempty" bson:"template,omitempty"`
+	// Revision counts the edits made to the document over WebSockets
+	Revision int64 `json:"revision" bson:"revision"`
+	// Breadcrumbs is the path of folders to the document the caller can see, set on reads
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs,omitempty" bson:"-"`
+
+	DocumentStats `bson:",inline"`
+	// Role is the effective role of the caller, computed on every read and never stored
+	Role string `json:"role,omitempty" bson:"-"`
+	// Starred and Labels are the caller's own marks, set on reads
+	Starred bool     `json:"starred,omitempty" bson:"-"`
+	Labels  []string `json:"labels,omitempty" bson:"-"`
+}
+
+// CreateDocument is a new document, owned by the caller along with the collaborators of ACL.
+// An author sent by former clients is ignored.
+type CreateDocument struct {
+	Title string       `json:"title"`
+	Data  DocumentData `json:"data"`
+	ACL   []ACLEntry   `json:"acl"`
+}
+
+// DocumentStats is the metadata the service keeps up to date as a document is saved
+type DocumentStats struct {
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedAt"`
+	LastEditedBy string    `json:"lastEditedBy,omitempty" bson:"lastEditedBy,omitempty"`
+	WordCount    int       `json:"wordCount" bson:"wordCount"`
+	CharCount    int       `json:"charCount" bson:"charCount"`
 }
 
 type Message struct {
 	Data   DocumentData `json:"data" bson:"data"`
 	Change map[string]interface{} 
-}
\ No newline at end of file
+}
@@ -1,5 +0,0 @@
-package dto
-
-type Email struct {
-	Email string `form:"email"`
-}
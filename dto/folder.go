@@ -0,0 +1,58 @@
+package dto
+
+import "time"
+
+// Folder groups documents and other folders. Its access list applies to everything in it,
+// together with the access inherited from its ancestors.
+type Folder struct {
+	ID       string `json:"id" bson:"_id,omitempty"`
+	Name     string `json:"name" bson:"name"`
+	ParentID string `json:"parentId,omitempty" bson:"parentId,omitempty"`
+	// Ancestors are the IDs of the folders above, from the top level down to the parent
+	Ancestors    []string   `json:"ancestors" bson:"ancestors"`
+	ACL          []ACLEntry `json:"acl" bson:"acl"`
+	InheritedACL []ACLEntry `json:"inheritedAcl,omitempty" bson:"inheritedAcl,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt" bson:"createdAt"`
+	// Role is the effective role of the caller, computed on every read and never stored
+	Role string `json:"role,omitempty" bson:"-"`
+}
+
+// Breadcrumb is a folder on the path to a document or folder
+type Breadcrumb struct {
+	ID   string `json:"id" bson:"_id"`
+	Name string `json:"name" bson:"name"`
+}
+
+// FolderContents is a folder with the path to it and its subfolders, its documents are listed
+// with the document list filtered by folder
+type FolderContents struct {
+	Folder      *Folder      `json:"folder,omitempty"`
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+	Folders     []*Folder    `json:"folders"`
+}
+
+type CreateFolder struct {
+	Name     string `json:"name" binding:"required"`
+	ParentID string `json:"parentId"`
+}
+
+type RenameFolder struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// MoveFolder moves a folder under another one, an empty parent moves it to the top level
+type MoveFolder struct {
+	ParentID string `json:"parentId"`
+}
+
+// MoveDocument moves a document into a folder, an empty folder moves it to the root
+type MoveDocument struct {
+	ID       string `json:"document_id" binding:"required"`
+	FolderID string `json:"folderId"`
+}
+
+// FolderShare grants a role on a folder to a principal, an empty role removes its access
+type FolderShare struct {
+	Principal string `json:"principal" binding:"required"`
+	Role      string `json:"role"`
+}
@@ -0,0 +1,21 @@
+package dto
+
+// GroupPrincipalPrefix marks ACL principals that refer to a group rather than a user's email
+const GroupPrincipalPrefix = "group:"
+
+type Group struct {
+	ID      string   `json:"id" bson:"_id,omitempty"`
+	Name    string   `json:"name" bson:"name"`
+	Members []string `json:"members" bson:"members"`
+	// Admins is the subset of members allowed to manage the group
+	Admins []string `json:"admins" bson:"admins"`
+}
+
+type CreateGroup struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type GroupMember struct {
+	Email string `json:"email" binding:"required,email"`
+	Admin bool   `json:"admin"`
+}
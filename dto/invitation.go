@@ -0,0 +1,20 @@
+package dto
+
+import "time"
+
+// Invitation shares a document with an email that has no account yet, the role is granted
+// once the invitee signs up and accepts it. Only the token hash is stored.
+type Invitation struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	DocumentID string    `json:"documentId" bson:"documentId"`
+	Email      string    `json:"email" bson:"email"`
+	Role       string    `json:"role" bson:"role"`
+	InvitedBy  string    `json:"invitedBy" bson:"invitedBy"`
+	TokenHash  string    `json:"-" bson:"tokenHash"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+type AcceptInvitation struct {
+	Token string `json:"token" binding:"required"`
+}
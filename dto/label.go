@@ -0,0 +1,28 @@
+package dto
+
+// DocumentLabels is a user's own marks on a document. They are private to the user, other
+// collaborators on the document never see them.
+type DocumentLabels struct {
+	DocumentID string   `json:"document_id" bson:"documentId"`
+	Starred    bool     `json:"starred" bson:"starred"`
+	Labels     []string `json:"labels" bson:"labels"`
+}
+
+type Star struct {
+	DocumentID string `json:"document_id" binding:"required"`
+	Starred    bool   `json:"starred"`
+}
+
+// LabelUpdate adds and removes labels of a document in one change, either the caller's own
+// labels or the tags shared with every collaborator. A label both added and removed is removed.
+type LabelUpdate struct {
+	DocumentID string   `json:"document_id" binding:"required"`
+	Add        []string `json:"add" binding:"max=20,dive,max=50"`
+	Remove     []string `json:"remove" binding:"max=20,dive,max=50"`
+}
+
+// LabelCount is one of a user's labels and the number of documents carrying it
+type LabelCount struct {
+	Label string `json:"label" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
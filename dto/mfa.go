@@ -0,0 +1,35 @@
+package dto
+
+// MFA is the two-factor state stored on a user document
+type MFA struct {
+	Enabled       bool     `json:"enabled" bson:"enabled"`
+	Secret        string   `json:"-" bson:"secret,omitempty"`
+	PendingSecret string   `json:"-" bson:"pendingSecret,omitempty"`
+	RecoveryCodes []string `json:"-" bson:"recoveryCodes,omitempty"`
+	LastUsedStep  int64    `json:"-" bson:"lastUsedStep,omitempty"`
+}
+
+type MFACode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type MFALogin struct {
+	MFAToken string `json:"mfaToken" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type MFAPolicy struct {
+	Required bool `json:"required" bson:"required"`
+}
+
+type LoginResponse struct {
+	Token                 string `json:"token,omitempty"`
+	MFARequired           bool   `json:"mfaRequired,omitempty"`
+	MFAEnrollmentRequired bool   `json:"mfaEnrollmentRequired,omitempty"`
+	MFAToken              string `json:"mfaToken,omitempty"`
+}
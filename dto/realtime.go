@@ -0,0 +1,132 @@
+package dto
+
+import "encoding/json"
+
+// ProtocolVersion is the version of the realtime protocol spoken by this server. Editors ask for
+// it by offering the ProtocolName or ProtocolNameMsgpack WebSocket subprotocol, the others get
+// the legacy messages.
+const (
+	ProtocolVersion = 1
+	ProtocolName    = "godoc.v1"
+	// ProtocolNameMsgpack is the same protocol with messages in MessagePack binary frames
+	ProtocolNameMsgpack = "godoc.v1.msgpack"
+)
+
+// Types of the realtime messages
+const (
+	// Sent by the server once the session is open
+	MessageWelcome = "welcome"
+	// Sent by editors, then by the server to the other sessions once it has a revision
+	MessageEdit = "edit"
+	// Sent by the server to confirm an edit, with the revision it got
+	MessageAck = "ack"
+	// Sent by the server when a message is rejected
+	MessageError = "error"
+	// Sent by clients about their cursor, relayed by the server with joins and leaves
+	MessagePresence = "presence"
+	// Sent by the server when the title or the caller's role on the document changes
+	MessageTitleChange      = "title-change"
+	MessagePermissionChange = "permission-change"
+	// Sent by clients to check the session is alive, answered with a pong
+	MessagePing = "ping"
+	MessagePong = "pong"
+	// Sent by clients coming back from a lost connection, answered with a sync
+	MessageResume = "resume"
+	MessageSync   = "sync"
+	// Sent by the server to viewers when they join, they then get the edits coalesced
+	MessageSnapshot = "snapshot"
+)
+
+// Codes of the error messages
+const (
+	ErrorInvalidMessage     = "invalid-message"
+	ErrorUnsupportedVersion = "unsupported-version"
+	ErrorUnknownType        = "unknown-type"
+	ErrorInvalidPayload     = "invalid-payload"
+	ErrorReadOnly           = "read-only"
+	ErrorInternal           = "internal"
+	// The server no longer has the changes since the client's revision, which has to reload
+	// the document
+	ErrorResyncRequired = "resync-required"
+)
+
+// Envelope is a realtime message. ID is set by clients on the messages they want acknowledged
+// and echoed on the ack or error answering them. Revision is the revision of the document an
+// edit was made on, and on messages from the server the revision of the document they follow.
+type Envelope struct {
+	Version  int             `json:"v"`
+	Type     string          `json:"type"`
+	ID       string          `json:"id,omitempty"`
+	Revision int64           `json:"rev,omitempty"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
+
+// EditPayload is a change to a document as a delta of Quill operations. Data is the whole
+// document after the change, which editors no longer need to send: the server applies the
+// change to its copy. The server fills Author and SessionID on the edits it relays.
+type EditPayload struct {
+	Change    DocumentData  `json:"change"`
+	Data      *DocumentData `json:"data,omitempty"`
+	Author    string        `json:"author,omitempty"`
+	SessionID string        `json:"sessionId,omitempty"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PresencePayload is where a user is in a document. State is "joined" or "left" when the
+// server announces a session, empty for cursor moves.
+type PresencePayload struct {
+	SessionID string      `json:"sessionId,omitempty"`
+	Email     string      `json:"email,omitempty"`
+	State     string      `json:"state,omitempty"`
+	Cursor    interface{} `json:"cursor,omitempty"`
+}
+
+// Presence states announced by the server
+const (
+	PresenceJoined = "joined"
+	PresenceLeft   = "left"
+)
+
+type TitlePayload struct {
+	Title string `json:"title"`
+}
+
+type PermissionPayload struct {
+	Role    string `json:"role"`
+	CanEdit bool   `json:"canEdit"`
+}
+
+// WelcomePayload opens a session with the caller's access, the envelope carries the revision
+// the client starts from
+type WelcomePayload struct {
+	SessionID string `json:"sessionId"`
+	Role      string `json:"role"`
+	CanEdit   bool   `json:"canEdit"`
+}
+
+// ResumePayload is sent by a client reconnecting with the revision it last had acknowledged
+// in the envelope and the edits it made since, in order
+type ResumePayload struct {
+	Pending []PendingEdit `json:"pending,omitempty"`
+}
+
+type PendingEdit struct {
+	ID     string       `json:"id"`
+	Change DocumentData `json:"change"`
+}
+
+// SyncPayload answers a resume: Change brings the client's copy, with its pending edits, up
+// to the revision of the envelope. Acked lists the pending edits now applied.
+type SyncPayload struct {
+	Change DocumentData `json:"change"`
+	Acked  []string     `json:"acked,omitempty"`
+}
+
+// SnapshotPayload is the document as of the revision of the envelope
+type SnapshotPayload struct {
+	Data DocumentData `json:"data"`
+}
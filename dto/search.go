@@ -2,5 +2,26 @@ package dto
 
 type Search struct {
 	SearchQuery string `json:"searchQuery" binding:"required"`
-	Email 	 string `json:"email" binding:"required"`
-}
\ No newline at end of file
+	// Email is no longer used, results are filtered by the signed-in user's access
+	Email string `json:"email"`
+	Sort  string `json:"sort" binding:"omitempty,oneof=relevance created modified"`
+	Limit int64  `json:"limit" binding:"min=0,max=100"`
+	// Tag, Starred and Label narrow the search like the document list filters
+	Tag     string `json:"tag"`
+	Starred bool   `json:"starred"`
+	Label   string `json:"label"`
+}
+
+// SearchResult is a document matching a search, most relevant first. Snippet is an HTML
+// escaped excerpt of the body with the matched terms wrapped in <mark> tags.
+type SearchResult struct {
+	ID            string `json:"id" bson:"_id"`
+	Title         string `json:"title" bson:"title"`
+	DocumentStats `bson:",inline"`
+	Role          string   `json:"role" bson:"-"`
+	Score         float64  `json:"score" bson:"score"`
+	Snippet       string   `json:"snippet" bson:"-"`
+	Tags          []string `json:"tags" bson:"tags"`
+	Starred       bool     `json:"starred" bson:"-"`
+	Labels        []string `json:"labels" bson:"-"`
+}
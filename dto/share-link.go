@@ -0,0 +1,31 @@
+package dto
+
+import "time"
+
+// ShareLink grants a role on a document to whoever holds its token, only the token hash is stored
+type ShareLink struct {
+	ID           string     `json:"id" bson:"_id,omitempty"`
+	DocumentID   string     `json:"documentId" bson:"documentId"`
+	TokenHash    string     `json:"-" bson:"tokenHash"`
+	Role         string     `json:"role" bson:"role"`
+	CreatedBy    string     `json:"createdBy" bson:"createdBy"`
+	CreatedAt    time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	PasswordHash string     `json:"-" bson:"passwordHash,omitempty"`
+	HasPassword  bool       `json:"hasPassword" bson:"-"`
+	// Domain restricts the link to signed-in users whose email belongs to it
+	Domain string `json:"domain,omitempty" bson:"domain,omitempty"`
+}
+
+type CreateShareLink struct {
+	DocumentID     string `json:"document_id" binding:"required"`
+	Role           string `json:"role" binding:"required,oneof=viewer commenter editor"`
+	ExpiresInHours int    `json:"expiresInHours" binding:"min=0"`
+	Password       string `json:"password"`
+	Domain         string `json:"domain"`
+}
+
+type OpenShareLink struct {
+	Token    string `json:"token" form:"share" binding:"required"`
+	Password string `json:"password" form:"password"`
+}
@@ -0,0 +1,48 @@
+package dto
+
+import "time"
+
+// Scopes a template is offered at
+const (
+	TemplateScopeUser   = "user"
+	TemplateScopeTeam   = "team"
+	TemplateScopeGlobal = "global"
+)
+
+// Template marks a document as a template new documents can be started from. User templates
+// are offered to the user who marked them, team templates to the members of a group and global
+// templates to everybody.
+type Template struct {
+	Scope       string `json:"scope" bson:"scope"`
+	GroupID     string `json:"groupId,omitempty" bson:"groupId,omitempty"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	MarkedBy    string `json:"markedBy" bson:"markedBy"`
+}
+
+type MarkTemplate struct {
+	DocumentID  string `json:"document_id" binding:"required"`
+	Scope       string `json:"scope" binding:"required,oneof=user team global"`
+	GroupID     string `json:"groupId" binding:"required_if=Scope team"`
+	Description string `json:"description" binding:"max=200"`
+}
+
+// TemplateItem is a template as shown in the gallery
+type TemplateItem struct {
+	ID        string    `json:"id" bson:"_id"`
+	Title     string    `json:"title" bson:"title"`
+	Template  Template  `json:"template" bson:"template"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// UseTemplate names the document created from a template, the template's title is used when
+// empty. Placeholders such as {{date}} and {{author}} are filled in the title and the body.
+type UseTemplate struct {
+	Title string `json:"title"`
+}
+
+// DuplicateDocument copies the title and body of a document, without its sharing, history of
+// opens or the users' own labels. Title defaults to "Copy of" the original title.
+type DuplicateDocument struct {
+	DocumentID string `json:"document_id" binding:"required"`
+	Title      string `json:"title"`
+}
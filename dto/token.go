@@ -0,0 +1,30 @@
+package dto
+
+import "time"
+
+const (
+	TokenScopeRead  = "read"
+	TokenScopeWrite = "write"
+)
+
+// PersonalAccessToken is a long-lived credential for scripts, only its hash is stored
+type PersonalAccessToken struct {
+	ID         string     `json:"id" bson:"_id,omitempty"`
+	Owner      string     `json:"owner" bson:"owner"`
+	Name       string     `json:"name" bson:"name"`
+	Prefix     string     `json:"prefix" bson:"prefix"`
+	TokenHash  string     `json:"-" bson:"tokenHash"`
+	Scope      string     `json:"scope" bson:"scope"`
+	Documents  []string   `json:"documents,omitempty" bson:"documents,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+}
+
+type CreateToken struct {
+	Name  string `json:"name" binding:"required"`
+	Scope string `json:"scope" binding:"required,oneof=read write"`
+	// Documents restricts the token to the listed document IDs when not empty
+	Documents     []string `json:"documents"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"min=0"`
+}
@@ -0,0 +1,16 @@
+package dto
+
+import "time"
+
+// TrashedDocument is a deleted document waiting in its owners' trash until it's restored or
+// purged once the retention period is over
+type TrashedDocument struct {
+	ID        string    `json:"id" bson:"_id"`
+	Title     string    `json:"title" bson:"title"`
+	Owner     string    `json:"owner" bson:"author"`
+	DeletedAt time.Time `json:"deletedAt" bson:"deletedAt"`
+	DeletedBy string    `json:"deletedBy" bson:"deletedBy"`
+	// PurgeAt is when the document will be deleted for good, set from the retention period
+	// in force when it was deleted
+	PurgeAt time.Time `json:"purgeAt" bson:"purgeAt"`
+}
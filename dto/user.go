@@ -0,0 +1,49 @@
+package dto
+
+import "time"
+
+// User is the account document stored in the users collection
+type User struct {
+	ID           string       `json:"id" bson:"_id,omitempty"`
+	Email        string       `json:"email" bson:"email"`
+	DisplayName  string       `json:"displayName" bson:"username"`
+	AvatarURL    string       `json:"avatarUrl" bson:"avatarUrl,omitempty"`
+	PasswordHash string       `json:"-" bson:"password"`
+	Admin        bool         `json:"admin" bson:"admin"`
+	MFA          MFA          `json:"mfa" bson:"mfa,omitempty"`
+	EmailChange  *EmailChange `json:"-" bson:"emailChange,omitempty"`
+}
+
+// Profile is the public view of a user shown to collaborators
+type Profile struct {
+	Email       string `json:"email" bson:"email"`
+	DisplayName string `json:"displayName" bson:"username"`
+	AvatarURL   string `json:"avatarUrl" bson:"avatarUrl,omitempty"`
+}
+
+type ProfileUpdate struct {
+	DisplayName *string `json:"displayName"`
+	AvatarURL   *string `json:"avatarUrl"`
+}
+
+// EmailChange is a pending email address waiting for the new owner to confirm it
+type EmailChange struct {
+	Email     string    `bson:"email"`
+	TokenHash string    `bson:"tokenHash"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+type EmailChangeRequest struct {
+	NewEmail string `json:"newEmail" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type EmailVerification struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type AccountDeletion struct {
+	Password string `json:"password" binding:"required"`
+	// TransferTo receives the documents owned by the deleted account; when empty they are deleted
+	TransferTo string `json:"transferTo"`
+}
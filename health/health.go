@@ -0,0 +1,159 @@
+// Package health reports whether the server is alive, and whether it's ready to take requests
+// given the state of its dependencies. The load balancer only sends requests to ready servers.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// Statuses of the server and of its components
+const (
+	StatusUp   = "UP"
+	StatusDown = "DOWN"
+)
+
+// DefaultTimeout bounds how long a component check may take before it's reported down
+const DefaultTimeout = 2 * time.Second
+
+// Component is the status of a dependency of the server, with details on its state
+type Component struct {
+	Status  string                 `json:"status"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+// Report is the status of the server, which is up when all its components are
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+// Check reports the status of a component, it returns once ctx is done at the latest
+type Check func(ctx context.Context) Component
+
+// Checker holds the checks deciding whether the server is ready, and whether it's draining:
+// a draining server finishes the requests it has but takes no new ones
+type Checker struct {
+	Timeout time.Duration
+
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{Timeout: DefaultTimeout, checks: make(map[string]Check)}
+}
+
+// Add adds a component to the readiness of the server, checks are added before serving
+func (checker *Checker) Add(name string, check Check) {
+	checker.checks[name] = check
+}
+
+// Drain makes the server report not ready from now on
+func (checker *Checker) Drain() {
+	checker.draining.Store(true)
+}
+
+func (checker *Checker) Draining() bool {
+	return checker.draining.Load()
+}
+
+// Live reports the server up as long as it answers
+func (checker *Checker) Live() Report {
+	return Report{Status: StatusUp}
+}
+
+// Ready runs the checks of the components at once, each within the timeout, and reports the
+// server up when all of them are and it isn't draining
+func (checker *Checker) Ready(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, checker.Timeout)
+	defer cancel()
+
+	report := Report{Status: StatusUp, Components: make(map[string]Component, len(checker.checks)+1)}
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	for name, check := range checker.checks {
+		wait.Add(1)
+		go func(name string, check Check) {
+			defer wait.Done()
+			component := check(ctx)
+			mutex.Lock()
+			report.Components[name] = component
+			mutex.Unlock()
+		}(name, check)
+	}
+	wait.Wait()
+
+	draining := Component{Status: StatusUp, Details: map[string]interface{}{"draining": checker.Draining()}}
+	if checker.Draining() {
+		draining.Status = StatusDown
+	}
+	report.Components["lifecycle"] = draining
+	for _, component := range report.Components {
+		if component.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+// LiveHandler answers liveness probes
+func (checker *Checker) LiveHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, checker.Live())
+	}
+}
+
+// ReadyHandler answers readiness probes, with 503 Service Unavailable when the server isn't
+// ready so that probes only looking at the status code see it too
+func (checker *Checker) ReadyHandler() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		report := checker.Ready(ctx.Request.Context())
+		status := http.StatusOK
+		if report.Status != StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+		ctx.JSON(status, report)
+	}
+}
+
+// Mongo checks that the primary of the MongoDB deployment answers a ping
+func Mongo(client *mongo.Client) Check {
+	return func(ctx context.Context) Component {
+		started := time.Now()
+		err := client.Ping(ctx, readpref.Primary())
+		component := Component{Status: StatusUp, Details: map[string]interface{}{"latency": time.Since(started).String()}}
+		if err != nil {
+			component.Status = StatusDown
+			component.Error = err.Error()
+		}
+		return component
+	}
+}
+
+// FlushLag checks that the edits held in the cache get saved: the cache is down when it holds
+// edits and its last complete flush is older than maxLag. lastFlush is when all the edited
+// documents were last written, dirty how many are waiting to be.
+func FlushLag(lastFlush func() time.Time, dirty func() int, maxLag time.Duration) Check {
+	return func(ctx context.Context) Component {
+		lag := time.Since(lastFlush())
+		pending := dirty()
+		component := Component{Status: StatusUp, Details: map[string]interface{}{
+			"dirtyDocuments": pending,
+			"flushLag":       lag.Round(time.Millisecond).String(),
+		}}
+		if pending > 0 && lag > maxLag {
+			component.Status = StatusDown
+			component.Error = "edits haven't been saved for " + lag.Round(time.Second).String()
+		}
+		return component
+	}
+}
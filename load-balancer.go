@@ -1,33 +1,83 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/khallihub/godoc/logging"
+	"github.com/khallihub/godoc/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	lbRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "godoc_lb_requests_total",
+		Help: "Requests proxied by the load balancer, by method and status.",
+	}, []string{"method", "code"})
+	lbRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "godoc_lb_request_duration_seconds",
+		Help:    "Time taken to proxy requests, WebSockets last as long as their session.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "code"})
+	backendUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "godoc_lb_backend_up",
+		Help: "Whether a backend passed its last health check.",
+	}, []string{"backend"})
+	backendSelections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "godoc_lb_backend_selections_total",
+		Help: "Requests sent to each backend, by kind: document requests stick to a backend, the others are spread.",
+	}, []string{"backend", "kind"})
+)
+
+// readinessTTL is how long the readiness of a backend is trusted before it's checked again,
+// healthClient bounds the checks of backends that don't answer
+const readinessTTL = 2 * time.Second
+
+var healthClient = &http.Client{Timeout: 2 * time.Second}
+
 type Server interface {
 	Address() string
-	IsAlive() bool
+	IsReady() bool
 	Serve(rw http.ResponseWriter, req *http.Request)
 }
 
 type simpleServer struct {
 	addr  string
 	proxy *httputil.ReverseProxy
+
+	// mutex guards the last readiness check
+	mutex     sync.Mutex
+	ready     bool
+	checkedAt time.Time
 }
 
 func newSimpleServer(addr string) *simpleServer {
 	serverUrl, err := url.Parse(addr)
 	handleErr(err)
 
+	proxy := httputil.NewSingleHostReverseProxy(serverUrl)
+	proxy.ErrorHandler = func(rw http.ResponseWriter, req *http.Request, err error) {
+		slog.Error("Error proxying request", "backend", addr, "error", err)
+		tracing.Fail(trace.SpanFromContext(req.Context()), err)
+		rw.WriteHeader(http.StatusBadGateway)
+	}
 	return &simpleServer{
 		addr:  addr,
-		proxy: httputil.NewSingleHostReverseProxy(serverUrl),
+		proxy: proxy,
 	}
 }
 
@@ -53,23 +103,44 @@ func NewLoadBalancer(port string, servers []Server) *LoadBalancer {
 }
 func handleErr(err error) {
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		slog.Error("Fatal error", "error", err)
 		os.Exit(1)
 	}
 }
 
 func (s *simpleServer) Address() string { return s.addr }
 
-func (s *simpleServer) IsAlive() bool {
-	healthURL := s.addr + "/health"
-	response, err := http.Get(healthURL)
+// IsReady tells whether the backend takes requests, as its readiness route said within the
+// last readinessTTL. A backend that lost MongoDB or is shutting down isn't ready.
+func (s *simpleServer) IsReady() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if time.Since(s.checkedAt) < readinessTTL {
+		return s.ready
+	}
+	s.ready = s.checkReady()
+	s.checkedAt = time.Now()
+	return s.ready
+}
+
+func (s *simpleServer) checkReady() bool {
+	healthURL := s.addr + "/health/ready"
+	response, err := healthClient.Get(healthURL)
 	if err != nil {
-		fmt.Printf("Error checking server %s health: %v\n", s.addr, err)
+		slog.Warn("Error checking server health", "backend", s.addr, "error", err)
+		backendUp.WithLabelValues(s.addr).Set(0)
 		return false
 	}
 	defer response.Body.Close()
 
-	return response.StatusCode == http.StatusOK
+	ready := response.StatusCode == http.StatusOK
+	if ready {
+		backendUp.WithLabelValues(s.addr).Set(1)
+	} else {
+		slog.Warn("Server not ready", "backend", s.addr, "status", response.StatusCode)
+		backendUp.WithLabelValues(s.addr).Set(0)
+	}
+	return ready
 }
 
 
@@ -77,40 +148,21 @@ func (s *simpleServer) Serve(rw http.ResponseWriter, req *http.Request) {
 	s.proxy.ServeHTTP(rw, req)
 }
 
+// getNextAvailableServer returns the next ready server in turn, nil when none is ready
 func (lb *LoadBalancer) getNextAvailableServer(isSocket bool) Server {
-	loop := 0
+	roundRobinCount := &lb.roundRobinCountForHttp
 	if isSocket {
-		server := lb.servers[lb.roundRobinCountForWebSocket%len(lb.servers)]
-		for !server.IsAlive() {
-			lb.roundRobinCountForWebSocket++
-			loop++
-			server = lb.servers[lb.roundRobinCountForWebSocket%len(lb.servers)]
-			if loop > len(lb.servers) {
-				fmt.Print("No server is alive\n")
-				loop = 0
-				// os.Exit(1)
-			}
-		}
-		// fmt.Print("Round Robin socket Count is : ", lb.roundRobinCountForWebSocket, ", Selected Server: ", server.Address(), "\n")
-		lb.roundRobinCountForWebSocket++
-		return server
-	} else {
-		server := lb.servers[lb.roundRobinCountForHttp%len(lb.servers)]
-		for !server.IsAlive() {
-			lb.roundRobinCountForHttp++
-			loop++
-			server = lb.servers[lb.roundRobinCountForHttp%len(lb.servers)]
-			if loop > len(lb.servers) {
-				fmt.Print("No server is alive\n")
-				loop = 0
-				// os.Exit(1)
-			}
+		roundRobinCount = &lb.roundRobinCountForWebSocket
+	}
+	for range lb.servers {
+		server := lb.servers[*roundRobinCount%len(lb.servers)]
+		*roundRobinCount++
+		if server.IsReady() {
+			return server
 		}
-		// fmt.Print("Round Robin http Count is : ", lb.roundRobinCountForHttp, ", Selected Server: ", server.Address(), "\n")
-		lb.roundRobinCountForHttp++
-		return server
 	}
-
+	slog.Error("No server is ready")
+	return nil
 }
 
 func (lb *LoadBalancer) getServerWithExistingConnection(documentID string) Server {
@@ -121,32 +173,76 @@ func (lb *LoadBalancer) getServerWithExistingConnection(documentID string) Serve
 		if serverAddr, ok := lb.Connections[conn]; ok {
 			// Find the server object with the matching address
 			for _, s := range lb.servers {
-				if s.Address() == serverAddr && s.IsAlive() {
+				if s.Address() == serverAddr && s.IsReady() {
 					return s
 				}
 			}
 		}
 	}
 
-	// If no existing connection is found, create a new one
+	// If no existing connection is found, or its server isn't ready, create a new one
 	server := lb.getNextAvailableServer(true)
+	if server == nil {
+		return nil
+	}
 	lb.documentWebSockets[documentID] = &websocket.Conn{}
 	lb.Connections[lb.documentWebSockets[documentID]] = server.Address()
 	return server
 }
 
 func (lb *LoadBalancer) serveProxy(rw http.ResponseWriter, req *http.Request) {
+	// The servers log the request under the ID given here, clients can quote it
+	requestID := logging.RequestID(req.Header.Get(logging.RequestIDHeader))
+	req.Header.Set(logging.RequestIDHeader, requestID)
+
+	// The span continues the trace of the client if it sent one, the servers continue it in
+	// turn from the traceparent header set here
+	propagator := otel.GetTextMapPropagator()
+	ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	ctx, span := tracing.Tracer.Start(ctx, "LoadBalancer.serveProxy", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.method", req.Method),
+		attribute.String("http.target", req.URL.Path),
+		attribute.String("godoc.request_id", requestID),
+	))
+	defer span.End()
+	req = req.WithContext(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
 	documentID := req.URL.Query().Get("document_id")
 	if documentID == "" {
 		targetServer := lb.getNextAvailableServer(false)
+		if targetServer == nil {
+			serveUnavailable(rw, span)
+			return
+		}
+		backendSelections.WithLabelValues(targetServer.Address(), "http").Inc()
+		span.SetAttributes(attribute.String("godoc.backend", targetServer.Address()))
+		slog.Debug("Proxying request", "request_id", requestID, "backend", targetServer.Address(), "path", logging.RedactURL(req.URL))
 		targetServer.Serve(rw, req)
 	} else {
 		targetServer := lb.getServerWithExistingConnection(documentID)
+		if targetServer == nil {
+			serveUnavailable(rw, span)
+			return
+		}
+		backendSelections.WithLabelValues(targetServer.Address(), "document").Inc()
+		span.SetAttributes(attribute.String("godoc.backend", targetServer.Address()), attribute.String("godoc.document_id", documentID))
+		slog.Debug("Proxying document request", "request_id", requestID, "backend", targetServer.Address(), "document_id", documentID, "path", logging.RedactURL(req.URL))
 		targetServer.Serve(rw, req)
 	}
 }
 
+// serveUnavailable answers a request no server is ready to take
+func serveUnavailable(rw http.ResponseWriter, span trace.Span) {
+	tracing.Fail(span, errors.New("no server is ready"))
+	http.Error(rw, "No server is ready", http.StatusServiceUnavailable)
+}
+
 func main() {
+	logging.Setup()
+	shutdownTracing, err := tracing.Setup(context.Background(), "godoc-load-balancer")
+	handleErr(err)
+	defer shutdownTracing(context.Background())
 	servers := []Server{
 		newSimpleServer("http://127.0.0.1:8080"),
 		newSimpleServer("http://127.0.0.1:8081"),
@@ -158,6 +254,9 @@ func main() {
 		lb.serveProxy(rw, req)
 	}
 
-	http.HandleFunc("/", handleRedirect)
+	// The load balancer answers /metrics itself, those of the servers stay on their own ports
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/", promhttp.InstrumentHandlerDuration(lbRequestDuration,
+		promhttp.InstrumentHandlerCounter(lbRequests, http.HandlerFunc(handleRedirect))))
 	http.ListenAndServe("127.0.0.1:"+lb.port, nil)
 }
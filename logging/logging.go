@@ -0,0 +1,127 @@
+// Package logging sets up the structured logs of the server and the load balancer
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// RequestIDHeader carries the ID of a request from the load balancer to the servers and back
+// to the client
+const RequestIDHeader = "X-Request-ID"
+
+// Redacted replaces the values kept out of the logs
+const Redacted = "[REDACTED]"
+
+// maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 64
+
+// sensitiveKeys are the attributes whose values are never logged: credentials and the content
+// of documents
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"body":          true,
+	"change":        true,
+	"code":          true,
+	"content":       true,
+	"data":          true,
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+}
+
+// sensitiveParams are the query parameters carrying credentials
+var sensitiveParams = []string{"token", "share", "password"}
+
+// Setup makes the default logger write at the level set by LOG_LEVEL (debug, info, warn or
+// error, info by default) in the format set by LOG_FORMAT (text or json, text by default).
+// Messages of the log package go through it too.
+func Setup() *slog.Logger {
+	logger := New(os.Stderr, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New returns a logger writing to w, redacting the sensitive attributes. Unknown levels and
+// formats fall back to info and text.
+func New(w io.Writer, level string, format string) *slog.Logger {
+	var minimum slog.Level
+	if err := minimum.UnmarshalText([]byte(level)); err != nil {
+		minimum = slog.LevelInfo
+	}
+	options := &slog.HandlerOptions{Level: minimum, ReplaceAttr: redact}
+	if strings.EqualFold(format, "json") {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, Redacted)
+	}
+	return attr
+}
+
+// RedactURL returns a URL as it may be logged, without the credentials of its query
+func RedactURL(u *url.URL) string {
+	query := u.Query()
+	redacted := false
+	for _, param := range sensitiveParams {
+		if query.Has(param) {
+			query.Set(param, Redacted)
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.RequestURI()
+	}
+	copied := *u
+	copied.RawQuery = query.Encode()
+	return copied.RequestURI()
+}
+
+// NewID returns a random ID for a request or a connection
+func NewID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		// The ID only ties log lines together, a fixed one is better than none
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// RequestID returns the ID a request came with when it's one the logs can take, a new one
+// otherwise
+func RequestID(received string) string {
+	if received == "" || len(received) > maxRequestIDLength {
+		return NewID()
+	}
+	for _, c := range received {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return NewID()
+		}
+	}
+	return received
+}
+
+type contextKey struct{}
+
+// WithLogger returns a context carrying a logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of a context, the default one when it carries none
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
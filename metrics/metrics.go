@@ -0,0 +1,125 @@
+// Package metrics holds the Prometheus metrics of the server, exposed on /metrics
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const namespace = "godoc"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route and status.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by route. Realtime routes last as long as their session.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// RealtimeSessions counts the open sessions of each document, by transport (websocket or
+	// event-stream) and mode (edit or view)
+	RealtimeSessions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "realtime_sessions",
+		Help:      "Open realtime sessions, by document, transport and mode.",
+	}, []string{"document", "transport", "mode"})
+	// MessagesSent counts the messages queued for sessions by broadcasts, by message type
+	MessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "realtime_messages_broadcast_total",
+		Help:      "Messages queued for realtime sessions by broadcasts, by message type.",
+	}, []string{"type"})
+	// SlowDisconnects counts the sessions dropped for falling behind their messages
+	SlowDisconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "realtime_slow_disconnects_total",
+		Help:      "Realtime sessions disconnected for being too slow to follow their document.",
+	})
+
+	// CacheFlushDuration measures the periodic saves of the edited documents
+	CacheFlushDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cache_flush_duration_seconds",
+		Help:      "Time taken to save the edited documents of the cache.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	// CacheFlushErrors counts the documents that failed to be saved
+	CacheFlushErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_flush_errors_total",
+		Help:      "Cached documents that failed to be saved.",
+	})
+
+	mongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "Time taken by MongoDB commands, by command.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command"})
+	mongoCommandErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_errors_total",
+		Help:      "MongoDB commands that failed, by command.",
+	}, []string{"command"})
+)
+
+// HTTP records the requests handled by the routes of the server. Requests matching no route
+// are recorded together, so that scanners don't make up new series.
+func HTTP() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		started := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ctx.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(started).Seconds())
+	}
+}
+
+// Cache exposes the number of cached documents and of those edited since they were saved,
+// counted when the metrics are collected
+func Cache(size func() int, dirty func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_documents",
+		Help:      "Documents held in the cache.",
+	}, func() float64 { return float64(size()) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cache_dirty_documents",
+		Help:      "Cached documents edited since they were last saved.",
+	}, func() float64 { return float64(dirty()) })
+}
+
+// ForgetDocument drops the series of a document once its last session left
+func ForgetDocument(documentID string) {
+	RealtimeSessions.DeletePartialMatch(prometheus.Labels{"document": documentID})
+}
+
+// MongoMonitor records the latency and the failures of the commands of a MongoDB client
+func MongoMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(ctx context.Context, finished *event.CommandSucceededEvent) {
+			mongoCommandDuration.WithLabelValues(finished.CommandName).Observe(finished.Duration.Seconds())
+		},
+		Failed: func(ctx context.Context, failed *event.CommandFailedEvent) {
+			mongoCommandDuration.WithLabelValues(failed.CommandName).Observe(failed.Duration.Seconds())
+			mongoCommandErrors.WithLabelValues(failed.CommandName).Inc()
+		},
+	}
+}
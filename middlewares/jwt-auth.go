@@ -1,44 +1,85 @@
 package middlewares
 
 import (
-	"log"
 	"net/http"
+	"strings"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/logging"
 	"github.com/khallihub/godoc/service"
 )
 
-// AuthorizeJWT validates the token from the http request, returning a 401 if it's not valid
-func AuthorizeJWT() gin.HandlerFunc {
+// AuthorizeJWT validates the token from the http request, returning a 401 if it's not valid.
+// Personal access tokens are accepted alongside session JWTs.
+func AuthorizeJWT(tokenService service.TokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenString := ""
-		receivedToken := c.Query("token")
-		if receivedToken != "" {
-			tokenString = receivedToken
-		} else {
-			const BEARER_SCHEMA = "Bearer "
-			authHeader := c.GetHeader("Authorization")
-			if authHeader == "" || len(authHeader) < len(BEARER_SCHEMA) {
-				c.AbortWithStatus(http.StatusUnauthorized)
-			}
-			tokenString = authHeader[len(BEARER_SCHEMA):]
+		tokenString, ok := extractToken(c)
+		if !ok || !authenticate(c, tokenService, tokenString) {
+			c.AbortWithStatus(http.StatusUnauthorized)
 		}
+	}
+}
 
-		token, err := service.NewJWTService().ValidateToken(tokenString)
-		print(token)
-		print(err)
-
-		if token.Valid {
-			claims := token.Claims.(jwt.MapClaims)
-			log.Println("Claims[Name]: ", claims["name"])
-			log.Println("Claims[Admin]: ", claims["admin"])
-			log.Println("Claims[Issuer]: ", claims["iss"])
-			log.Println("Claims[IssuedAt]: ", claims["iat"])
-			log.Println("Claims[ExpiresAt]: ", claims["exp"])
-		} else {
-			log.Println(err)
+// OptionalJWT authenticates the request like AuthorizeJWT when it carries a token and lets
+// anonymous requests through, leaving "email" unset for them
+func OptionalJWT(tokenService service.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := extractToken(c)
+		if ok && !authenticate(c, tokenService, tokenString) {
 			c.AbortWithStatus(http.StatusUnauthorized)
 		}
 	}
 }
+
+func authenticate(c *gin.Context, tokenService service.TokenService, tokenString string) bool {
+	if strings.HasPrefix(tokenString, service.PersonalAccessTokenPrefix) {
+		accessToken, err := tokenService.Authenticate(tokenString)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Info("Personal access token rejected", "error", err)
+			return false
+		}
+		c.Set("email", accessToken.Owner)
+		c.Set("admin", false)
+		c.Set("scope", accessToken.Scope)
+		c.Set("tokenDocuments", accessToken.Documents)
+		return true
+	}
+
+	logger := logging.FromContext(c.Request.Context())
+	token, err := service.NewJWTService().ValidateToken(tokenString)
+	if err == nil && token.Valid {
+		claims := token.Claims.(jwt.MapClaims)
+		logger.Debug("Token accepted", "email", claims["name"], "admin", claims["admin"], "expires", claims["exp"])
+
+		// Tokens from the first step of a two-factor login are not session tokens
+		if claims["purpose"] == service.MFAPendingPurpose {
+			return false
+		}
+		setClaims(c, claims)
+		return true
+	}
+	logger.Info("Token rejected", "error", err)
+	return false
+}
+
+// extractToken reads the token from the "token" query parameter or the bearer Authorization header
+func extractToken(c *gin.Context) (string, bool) {
+	if receivedToken := c.Query("token"); receivedToken != "" {
+		return receivedToken, true
+	}
+	const BEARER_SCHEMA = "Bearer "
+	authHeader := c.GetHeader("Authorization")
+	if len(authHeader) <= len(BEARER_SCHEMA) {
+		return "", false
+	}
+	return authHeader[len(BEARER_SCHEMA):], true
+}
+
+// setClaims exposes the authenticated user to the handlers further down the chain
+func setClaims(c *gin.Context, claims jwt.MapClaims) {
+	name, _ := claims["name"].(string)
+	admin, _ := claims["admin"].(bool)
+	c.Set("email", name)
+	c.Set("admin", admin)
+}
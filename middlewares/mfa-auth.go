@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/service"
+)
+
+// AuthorizeMFAEnrollment accepts either a session token or an MFA pending token, so that users
+// forced to enroll by the two-factor policy can do so before receiving a session token
+func AuthorizeMFAEnrollment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := extractToken(c)
+		if !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		token, err := service.NewJWTService().ValidateToken(tokenString)
+		if err != nil || !token.Valid {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		setClaims(c, token.Claims.(jwt.MapClaims))
+	}
+}
+
+// RequireAdmin rejects requests whose token was not issued to an administrator.
+// It must run after AuthorizeJWT.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("admin") {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	}
+}
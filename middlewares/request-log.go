@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestID tags the request with the ID the load balancer gave it, or a new one, and hands
+// the handlers a logger carrying it through the context of the request, along with the ID of
+// the trace when the request is traced. The ID is sent back with the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := logging.RequestID(c.GetHeader(logging.RequestIDHeader))
+		c.Set("requestID", id)
+		c.Header(logging.RequestIDHeader, id)
+		logger := slog.Default().With("request_id", id)
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			logger = logger.With("trace_id", span.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(logging.WithLogger(c.Request.Context(), logger))
+		c.Next()
+	}
+}
+
+// AccessLog logs every request once it's handled. Credentials passed in the query string are
+// redacted.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		started := time.Now()
+		c.Next()
+
+		logger := logging.FromContext(c.Request.Context())
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		logger.Log(c.Request.Context(), level, "Request handled",
+			"method", c.Request.Method,
+			"path", logging.RedactURL(c.Request.URL),
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"duration", time.Since(started),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
@@ -0,0 +1,140 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/metrics"
+)
+
+// DefaultViewerInterval is how often viewers get the edits made since the last ones they got
+const DefaultViewerInterval = 250 * time.Millisecond
+
+// Audience fans the edits of a document out to its viewers, read-only sessions that follow
+// the document without presence. Edits are published to it as they are made and sent to the
+// viewers coalesced, at most once an interval, by its own goroutine: editors only append to a
+// list, whatever the number of viewers.
+type Audience struct {
+	// mutex guards the viewers and the document they are at
+	mutex    sync.Mutex
+	viewers  map[*Client]struct{}
+	document dto.DocumentData
+	revision int64
+	// snapshot is the document as sent to joining viewers, built once per revision
+	snapshot *Outgoing
+
+	// pendingMutex guards the edits not sent yet, apart from the viewers so that publishing
+	// never waits for a fan-out
+	pendingMutex    sync.Mutex
+	pending         []dto.DocumentData
+	pendingRevision int64
+
+	stop chan struct{}
+}
+
+// NewAudience starts fanning out the edits made to a document from a revision
+func NewAudience(document dto.DocumentData, revision int64, interval time.Duration) *Audience {
+	audience := &Audience{
+		viewers:  make(map[*Client]struct{}),
+		document: document,
+		revision: revision,
+		stop:     make(chan struct{}),
+	}
+	go audience.run(interval)
+	return audience
+}
+
+// Publish queues an edit for the viewers, revision being the one it got
+func (audience *Audience) Publish(revision int64, change dto.DocumentData) {
+	audience.pendingMutex.Lock()
+	audience.pending = append(audience.pending, change)
+	audience.pendingRevision = revision
+	audience.pendingMutex.Unlock()
+}
+
+// Add sends a viewer the document as of the last edits sent, the following ones come on top
+func (audience *Audience) Add(client *Client) {
+	audience.mutex.Lock()
+	defer audience.mutex.Unlock()
+	if audience.snapshot == nil {
+		audience.snapshot = NewOutgoing(dto.MessageSnapshot, "", audience.revision, dto.SnapshotPayload{Data: audience.document})
+	}
+	audience.viewers[client] = struct{}{}
+	if message := audience.snapshot.In(client.Encoding); message != nil {
+		client.Send(message)
+	}
+}
+
+// Remove stops sending edits to a viewer
+func (audience *Audience) Remove(client *Client) {
+	audience.mutex.Lock()
+	delete(audience.viewers, client)
+	audience.mutex.Unlock()
+}
+
+// Broadcast queues a message for every viewer
+func (audience *Audience) Broadcast(message *Outgoing) {
+	audience.mutex.Lock()
+	defer audience.mutex.Unlock()
+	audience.send(message)
+}
+
+// send queues a message for every viewer, the caller holds the mutex
+func (audience *Audience) send(message *Outgoing) {
+	sent := 0
+	for viewer := range audience.viewers {
+		if data := message.In(viewer.Encoding); data != nil && viewer.Send(data) {
+			sent++
+		}
+	}
+	metrics.MessagesSent.WithLabelValues(message.Type()).Add(float64(sent))
+}
+
+// Viewers returns the viewers following the document
+func (audience *Audience) Viewers() []*Client {
+	audience.mutex.Lock()
+	defer audience.mutex.Unlock()
+	viewers := make([]*Client, 0, len(audience.viewers))
+	for viewer := range audience.viewers {
+		viewers = append(viewers, viewer)
+	}
+	return viewers
+}
+
+// Stop ends the fan-out, edits still pending are dropped
+func (audience *Audience) Stop() {
+	close(audience.stop)
+}
+
+func (audience *Audience) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			audience.flush()
+		case <-audience.stop:
+			return
+		}
+	}
+}
+
+// flush sends the viewers the edits published since the last flush as a single edit
+func (audience *Audience) flush() {
+	audience.pendingMutex.Lock()
+	pending, revision := audience.pending, audience.pendingRevision
+	audience.pending = nil
+	audience.pendingMutex.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	change := ComposeAll(pending...)
+	audience.mutex.Lock()
+	defer audience.mutex.Unlock()
+	audience.document = Compose(audience.document, change)
+	audience.revision = revision
+	audience.snapshot = nil
+	audience.send(NewOutgoing(dto.MessageEdit, "", revision, dto.EditPayload{Change: change}))
+}
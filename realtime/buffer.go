@@ -0,0 +1,117 @@
+package realtime
+
+import "github.com/khallihub/godoc/dto"
+
+// Change is an edit applied to a document, kept so that sessions can catch up with it
+type Change struct {
+	Revision int64
+	Delta    dto.DocumentData
+	// Author and MessageIDs identify the edits of a client applied in the change, so that
+	// edits sent again after a reconnection aren't applied twice
+	Author     string
+	MessageIDs []string
+}
+
+// ChangeBuffer keeps the latest changes of a document, dropping the oldest past its size. It
+// isn't safe for concurrent use, callers hold the mutex of the document.
+type ChangeBuffer struct {
+	size     int
+	revision int64
+	changes  []Change
+}
+
+// NewChangeBuffer returns an empty buffer for a document at a revision
+func NewChangeBuffer(size int, revision int64) *ChangeBuffer {
+	return &ChangeBuffer{size: size, revision: revision}
+}
+
+// Add records the change giving the document its next revision
+func (buffer *ChangeBuffer) Add(change Change) {
+	buffer.revision = change.Revision
+	if len(buffer.changes) == buffer.size {
+		// Reuse the array rather than grow it forever
+		copy(buffer.changes, buffer.changes[1:])
+		buffer.changes = buffer.changes[:len(buffer.changes)-1]
+	}
+	buffer.changes = append(buffer.changes, change)
+}
+
+// Revision is the revision of the document after the latest change
+func (buffer *ChangeBuffer) Revision() int64 {
+	return buffer.revision
+}
+
+// Since returns the changes made after a revision, ok is false when some of them were
+// dropped already or the revision is unknown
+func (buffer *ChangeBuffer) Since(revision int64) (changes []Change, ok bool) {
+	if revision > buffer.revision || revision < 0 {
+		return nil, false
+	}
+	missed := int(buffer.revision - revision)
+	if missed > len(buffer.changes) {
+		return nil, false
+	}
+	return buffer.changes[len(buffer.changes)-missed:], true
+}
+
+// Rebase transforms a change made before the missed changes to apply after them
+func Rebase(missed []Change, change dto.DocumentData) dto.DocumentData {
+	return Transform(composeChanges(missed), change, true)
+}
+
+// CatchUp works out how a client that was disconnected rejoins a document. The client last
+// saw the document before the missed changes and made the pending edits on top of it, some of
+// which the server may have applied without the client knowing. CatchUp returns the change
+// bringing the client's copy up to date, the change applying the rest of the pending edits to
+// the document, and the IDs of the pending edits applied earlier.
+func CatchUp(missed []Change, author string, pending []dto.PendingEdit) (client dto.DocumentData, server dto.DocumentData, applied []string) {
+	missedChange := composeChanges(missed)
+	// Edits are applied in order, so only a prefix of the pending ones may be applied already
+	for i, change := range missed {
+		if change.Author != author || !isPrefix(change.MessageIDs, pending) {
+			continue
+		}
+		applied = change.MessageIDs
+		// The client has its own edits already, it misses the changes made before them
+		// transformed to follow them, and the changes made after them as they are
+		own := composePending(pending[:len(applied)])
+		before := Transform(own, composeChanges(missed[:i]), false)
+		missedChange = Compose(before, composeChanges(missed[i+1:]))
+		pending = pending[len(applied):]
+		break
+	}
+
+	rest := composePending(pending)
+	server = Transform(missedChange, rest, true)
+	client = Transform(rest, missedChange, false)
+	return client, server, applied
+}
+
+func composeChanges(changes []Change) dto.DocumentData {
+	deltas := make([]dto.DocumentData, len(changes))
+	for i, change := range changes {
+		deltas[i] = change.Delta
+	}
+	return ComposeAll(deltas...)
+}
+
+func composePending(pending []dto.PendingEdit) dto.DocumentData {
+	deltas := make([]dto.DocumentData, len(pending))
+	for i, edit := range pending {
+		deltas[i] = edit.Change
+	}
+	return ComposeAll(deltas...)
+}
+
+// isPrefix reports whether the IDs are those of the first pending edits
+func isPrefix(ids []string, pending []dto.PendingEdit) bool {
+	if len(ids) == 0 || len(ids) > len(pending) {
+		return false
+	}
+	for i, id := range ids {
+		if pending[i].ID != id {
+			return false
+		}
+	}
+	return true
+}
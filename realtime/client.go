@@ -0,0 +1,184 @@
+package realtime
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/khallihub/godoc/metrics"
+)
+
+const (
+	// writeWait is how long a message may take to be written before the client is dropped
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent, pings are sent often enough for its
+	// pongs to arrive in time
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	// sendQueueSize is how many messages may wait for a client before it's considered too
+	// slow to follow the document and disconnected
+	sendQueueSize = 256
+	// compressionThreshold is the size from which messages are compressed, when the client
+	// negotiated permessage-deflate. Smaller ones gain little and cost a flush of the
+	// compressor.
+	compressionThreshold = 512
+)
+
+// SlowConsumerCloseCode closes the sessions that fall too far behind, in the range of close
+// codes left to applications
+const SlowConsumerCloseCode = 4408
+
+// Client is a session on a document. Messages are queued for it and written by its own
+// goroutine, to a WebSocket or to a stream of Server-Sent Events, so that a slow client never
+// holds up the others. CanEdit follows the current role
+// of the user. Sessions opened through a share link carry its ID and an empty Email when
+// anonymous.
+type Client struct {
+	Email       string
+	Scope       string
+	ShareLinkID string
+	CanEdit     atomic.Bool
+	// Role is the user's role when the session opened or its access last changed, guarded by
+	// the mutex of the hub
+	Role string
+	// SessionID tells apart the sessions of a user, Protocol is the version of the realtime
+	// protocol the client speaks and 0 for legacy clients
+	SessionID string
+	Protocol  int
+	// Encoding is how messages are written for the client, JSON for legacy clients
+	Encoding *Encoding
+	// Viewer sessions are read-only and follow the document through the audience of its hub
+	Viewer bool
+	// Log carries the IDs of the request and of the session, the default logger when unset
+	Log *slog.Logger
+
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	slow      atomic.Bool
+	// closeCode and closeReason tell stream clients why their session ended, they are set
+	// before done is closed
+	closeCode   int
+	closeReason string
+}
+
+// Attach starts writing the messages queued for the client to its connection
+func (client *Client) Attach(conn *websocket.Conn) {
+	client.conn = conn
+	client.open()
+	go client.writeMessages()
+}
+
+func (client *Client) open() {
+	if client.Encoding == nil {
+		client.Encoding = JSON
+	}
+	client.send = make(chan []byte, sendQueueSize)
+	client.done = make(chan struct{})
+}
+
+// Logger returns the logger of the session
+func (client *Client) Logger() *slog.Logger {
+	if client.Log == nil {
+		return slog.Default()
+	}
+	return client.Log
+}
+
+// Streamed reports whether the client's messages are written as Server-Sent Events
+func (client *Client) Streamed() bool {
+	return client.send != nil && client.conn == nil
+}
+
+// Send queues a message for the client without waiting. A client whose queue is full is
+// disconnected, Send then returns false.
+func (client *Client) Send(message []byte) bool {
+	select {
+	case <-client.done:
+		return false
+	default:
+	}
+	select {
+	case client.send <- message:
+		return true
+	default:
+		// Senders hold the mutex of the hub, the close message is written apart
+		if client.slow.CompareAndSwap(false, true) {
+			metrics.SlowDisconnects.Inc()
+			client.Logger().Warn("Disconnecting slow realtime client")
+			go client.CloseWith(SlowConsumerCloseCode, "Too slow to follow the document")
+		}
+		return false
+	}
+}
+
+// ReadMessages hands the messages of the client to handle until the connection fails or the
+// client stays silent for too long
+func (client *Client) ReadMessages(handle func(message []byte)) error {
+	client.conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		_, message, err := client.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		client.conn.SetReadDeadline(time.Now().Add(pongWait))
+		handle(message)
+	}
+}
+
+// CloseWith tells the client why its session ends and closes it
+func (client *Client) CloseWith(code int, reason string) {
+	if client.conn == nil {
+		client.closeOnce.Do(func() {
+			client.closeCode, client.closeReason = code, reason
+			close(client.done)
+		})
+		return
+	}
+	message := websocket.FormatCloseMessage(code, reason)
+	if err := client.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		client.Logger().Info("Error writing close message", "error", err)
+	}
+	client.Close()
+}
+
+// Close ends the session, its read loop then fails and the client leaves its hub
+func (client *Client) Close() {
+	client.closeOnce.Do(func() {
+		close(client.done)
+		if client.conn != nil {
+			client.conn.Close()
+		}
+	})
+}
+
+func (client *Client) writeMessages() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case message := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			client.conn.EnableWriteCompression(len(message) >= compressionThreshold)
+			if err := client.conn.WriteMessage(client.Encoding.FrameType, message); err != nil {
+				client.Logger().Info("Error writing message", "error", err)
+				client.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := client.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				client.Logger().Info("Error writing ping", "error", err)
+				client.Close()
+				return
+			}
+		case <-client.done:
+			return
+		}
+	}
+}
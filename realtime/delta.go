@@ -0,0 +1,362 @@
+package realtime
+
+import (
+	"math"
+	"reflect"
+	"unicode/utf16"
+
+	"github.com/khallihub/godoc/dto"
+)
+
+// The functions below follow the semantics of quill-delta so that the server and the editors
+// agree on the result of combining changes. Lengths are counted in UTF-16 code units, like
+// JavaScript strings, and embeds have a length of 1.
+
+// infinity is the length of the implicit retain at the end of every delta
+const infinity = math.MaxInt
+
+// operation is a delta operation. Inserted text is only converted to UTF-16 when it has to be
+// split, most of a document goes through a change untouched.
+type operation struct {
+	text       string
+	units      []uint16
+	size       int // length of the text in UTF-16 code units
+	embed      interface{}
+	delete     int
+	retain     int
+	attributes map[string]interface{}
+}
+
+func textOperation(text string, attributes map[string]interface{}) operation {
+	size := 0
+	for _, r := range text {
+		// Characters outside the Basic Multilingual Plane take a surrogate pair
+		if r >= 0x10000 {
+			size += 2
+		} else {
+			size++
+		}
+	}
+	return operation{text: text, size: size, attributes: attributes}
+}
+
+func (op operation) length() int {
+	switch {
+	case op.delete > 0:
+		return op.delete
+	case op.retain > 0:
+		return op.retain
+	case op.embed != nil:
+		return 1
+	}
+	return op.size
+}
+
+func (op operation) isText() bool {
+	return op.kind() == "insert" && op.embed == nil
+}
+
+func (op operation) kind() string {
+	switch {
+	case op.delete > 0:
+		return "delete"
+	case op.retain > 0:
+		return "retain"
+	}
+	return "insert"
+}
+
+func toOperations(data dto.DocumentData) []operation {
+	ops := make([]operation, 0, len(data.Ops))
+	for _, raw := range data.Ops {
+		var attributes map[string]interface{}
+		if formats, ok := raw["attributes"].(map[string]interface{}); ok && len(formats) > 0 {
+			attributes = formats
+		}
+		var op operation
+		switch insert := raw["insert"].(type) {
+		case string:
+			op = textOperation(insert, attributes)
+		case nil:
+			op.delete, _ = opLength(raw["delete"])
+			op.retain, _ = opLength(raw["retain"])
+			op.attributes = attributes
+		default:
+			op = operation{embed: insert, attributes: attributes}
+		}
+		if op.length() <= 0 {
+			continue
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+func toDocumentData(ops []operation) dto.DocumentData {
+	data := dto.DocumentData{Ops: make([]map[string]interface{}, 0, len(ops))}
+	for _, op := range ops {
+		raw := map[string]interface{}{}
+		switch op.kind() {
+		case "insert":
+			if op.embed != nil {
+				raw["insert"] = op.embed
+			} else {
+				raw["insert"] = op.text
+			}
+		case "delete":
+			raw["delete"] = op.delete
+		case "retain":
+			raw["retain"] = op.retain
+		}
+		if len(op.attributes) > 0 {
+			raw["attributes"] = op.attributes
+		}
+		data.Ops = append(data.Ops, raw)
+	}
+	return data
+}
+
+// opLength reads the length of a delete or retain, decoded from JSON, MessagePack or BSON. ok
+// is false when the value isn't a whole number.
+func opLength(value interface{}) (length int, ok bool) {
+	switch number := value.(type) {
+	case float64:
+		return int(number), number == float64(int64(number))
+	case int:
+		return number, true
+	case int32:
+		return int(number), true
+	case int64:
+		return int(number), true
+	case uint64:
+		return int(number), true
+	}
+	return 0, false
+}
+
+// delta builds a list of operations, merging each operation with the previous one when possible
+type delta struct {
+	ops []operation
+}
+
+func (d *delta) push(op operation) {
+	index := len(d.ops)
+	if index > 0 {
+		last := &d.ops[index-1]
+		if op.kind() == "delete" && last.kind() == "delete" {
+			last.delete += op.delete
+			return
+		}
+		// Inserts go before deletes at the same position
+		if last.kind() == "delete" && op.kind() == "insert" {
+			index--
+			if index == 0 {
+				d.ops = append([]operation{op}, d.ops...)
+				return
+			}
+			last = &d.ops[index-1]
+		}
+		if reflect.DeepEqual(op.attributes, last.attributes) {
+			if last.isText() && op.isText() {
+				last.text += op.text
+				last.size += op.size
+				last.units = nil
+				return
+			}
+			if last.kind() == "retain" && op.kind() == "retain" {
+				last.retain += op.retain
+				return
+			}
+		}
+	}
+	d.ops = append(d.ops, operation{})
+	copy(d.ops[index+1:], d.ops[index:])
+	d.ops[index] = op
+}
+
+func (d *delta) retain(length int, attributes map[string]interface{}) {
+	if length > 0 {
+		d.push(operation{retain: length, attributes: attributes})
+	}
+}
+
+// chop drops the trailing retain, which changes nothing
+func (d *delta) chop() []operation {
+	if n := len(d.ops); n > 0 && d.ops[n-1].kind() == "retain" && len(d.ops[n-1].attributes) == 0 {
+		return d.ops[:n-1]
+	}
+	return d.ops
+}
+
+// iterator walks a list of operations, splitting them as it goes
+type iterator struct {
+	ops    []operation
+	index  int
+	offset int
+}
+
+func (it *iterator) hasNext() bool {
+	return it.peekLength() < infinity
+}
+
+func (it *iterator) peekLength() int {
+	if it.index < len(it.ops) {
+		return it.ops[it.index].length() - it.offset
+	}
+	return infinity
+}
+
+func (it *iterator) peekType() string {
+	if it.index < len(it.ops) {
+		return it.ops[it.index].kind()
+	}
+	return "retain"
+}
+
+func (it *iterator) next(length int) operation {
+	if it.index >= len(it.ops) {
+		return operation{retain: infinity}
+	}
+	op := it.ops[it.index]
+	offset := it.offset
+	remaining := op.length() - offset
+	if offset == 0 && length >= remaining {
+		// The operation is taken whole
+		it.index++
+		return op
+	}
+	if op.isText() && op.units == nil {
+		op.units = utf16.Encode([]rune(op.text))
+		it.ops[it.index].units = op.units
+	}
+	if length >= remaining {
+		length = remaining
+		it.index++
+		it.offset = 0
+	} else {
+		it.offset += length
+	}
+	switch op.kind() {
+	case "delete":
+		return operation{delete: length}
+	case "retain":
+		return operation{retain: length, attributes: op.attributes}
+	}
+	if op.embed != nil {
+		return operation{embed: op.embed, attributes: op.attributes}
+	}
+	units := op.units[offset : offset+length]
+	return operation{text: string(utf16.Decode(units)), units: units, size: length, attributes: op.attributes}
+}
+
+// Compose returns the change made by applying a and then b. Composing a document with a
+// change gives the document after the change.
+func Compose(a, b dto.DocumentData) dto.DocumentData {
+	this := &iterator{ops: toOperations(a)}
+	other := &iterator{ops: toOperations(b)}
+	result := &delta{}
+	for this.hasNext() || other.hasNext() {
+		if other.peekType() == "insert" {
+			result.push(other.next(infinity))
+			continue
+		}
+		if this.peekType() == "delete" {
+			result.push(this.next(infinity))
+			continue
+		}
+		length := min(this.peekLength(), other.peekLength())
+		thisOp, otherOp := this.next(length), other.next(length)
+		switch {
+		case otherOp.kind() == "retain":
+			op := operation{}
+			if thisOp.kind() == "retain" {
+				op.retain = length
+			} else {
+				op.text, op.units, op.size, op.embed = thisOp.text, thisOp.units, thisOp.size, thisOp.embed
+			}
+			op.attributes = composeAttributes(thisOp.attributes, otherOp.attributes, thisOp.kind() == "retain")
+			result.push(op)
+		case otherOp.kind() == "delete" && thisOp.kind() == "retain":
+			result.push(otherOp)
+		}
+		// Otherwise b deletes what a inserted and neither remains
+	}
+	return toDocumentData(result.chop())
+}
+
+// Transform returns b changed to apply after a, both being made on the same document. With
+// priority a is considered to have happened first: where both insert at the same position,
+// the text of a comes first and its formatting wins.
+func Transform(a, b dto.DocumentData, priority bool) dto.DocumentData {
+	this := &iterator{ops: toOperations(a)}
+	other := &iterator{ops: toOperations(b)}
+	result := &delta{}
+	for this.hasNext() || other.hasNext() {
+		if this.peekType() == "insert" && (priority || other.peekType() != "insert") {
+			result.retain(this.next(infinity).length(), nil)
+			continue
+		}
+		if other.peekType() == "insert" {
+			result.push(other.next(infinity))
+			continue
+		}
+		length := min(this.peekLength(), other.peekLength())
+		thisOp, otherOp := this.next(length), other.next(length)
+		switch {
+		case thisOp.kind() == "delete":
+			// a already deleted what b deletes or retains
+		case otherOp.kind() == "delete":
+			result.push(otherOp)
+		default:
+			result.retain(length, transformAttributes(thisOp.attributes, otherOp.attributes, priority))
+		}
+	}
+	return toDocumentData(result.chop())
+}
+
+// ComposeAll composes a list of changes in order
+func ComposeAll(changes ...dto.DocumentData) dto.DocumentData {
+	composed := dto.DocumentData{Ops: []map[string]interface{}{}}
+	for _, change := range changes {
+		composed = Compose(composed, change)
+	}
+	return composed
+}
+
+// composeAttributes applies the formatting b on top of a. Null values remove a format and are
+// only kept when the result is itself a retain.
+func composeAttributes(a, b map[string]interface{}, keepNull bool) map[string]interface{} {
+	attributes := map[string]interface{}{}
+	for key, value := range b {
+		if value != nil || keepNull {
+			attributes[key] = value
+		}
+	}
+	for key, value := range a {
+		if _, ok := b[key]; !ok && value != nil {
+			attributes[key] = value
+		}
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+	return attributes
+}
+
+// transformAttributes returns the formatting b still applies after a, with priority a wins
+// where both set the same format
+func transformAttributes(a, b map[string]interface{}, priority bool) map[string]interface{} {
+	if len(a) == 0 || !priority {
+		return b
+	}
+	attributes := map[string]interface{}{}
+	for key, value := range b {
+		if _, ok := a[key]; !ok {
+			attributes[key] = value
+		}
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+	return attributes
+}
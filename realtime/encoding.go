@@ -0,0 +1,146 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log/slog"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/khallihub/godoc/dto"
+	"github.com/ugorji/go/codec"
+)
+
+// Encoding is how the messages of a session are written on the wire. Clients choose it with
+// the WebSocket subprotocol they ask for.
+type Encoding struct {
+	Subprotocol string
+	// FrameType is the type of the WebSocket frames carrying the messages
+	FrameType int
+
+	marshal   func(value interface{}) ([]byte, error)
+	unmarshal func(data []byte, value interface{}) error
+	// envelope encodes an envelope around a payload already encoded
+	envelope func(envelope dto.Envelope) ([]byte, error)
+	// open decodes an envelope, leaving its payload encoded
+	open func(data []byte) (*dto.Envelope, error)
+}
+
+// JSON is the encoding of legacy clients and of the editors asking for ProtocolName
+var JSON = &Encoding{
+	Subprotocol: dto.ProtocolName,
+	FrameType:   websocket.TextMessage,
+	marshal:     json.Marshal,
+	unmarshal:   json.Unmarshal,
+	envelope: func(envelope dto.Envelope) ([]byte, error) {
+		return json.Marshal(envelope)
+	},
+	open: func(data []byte) (*dto.Envelope, error) {
+		var envelope dto.Envelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return nil, err
+		}
+		return &envelope, nil
+	},
+}
+
+// msgpackHandle decodes maps the way encoding/json does, so that deltas look the same whatever
+// the encoding they came in
+var msgpackHandle = func() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{WriteExt: true}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.RawToString = true
+	handle.SignedInteger = true
+	handle.Raw = true
+	return handle
+}()
+
+// msgpackEnvelope is an envelope as it is written in MessagePack, with the payload embedded as
+// a MessagePack value rather than JSON text
+type msgpackEnvelope struct {
+	Version  int       `codec:"v"`
+	Type     string    `codec:"type"`
+	ID       string    `codec:"id,omitempty"`
+	Revision int64     `codec:"rev,omitempty"`
+	Payload  codec.Raw `codec:"payload,omitempty"`
+}
+
+// MessagePack is the compact binary encoding of the editors asking for ProtocolNameMsgpack
+var MessagePack = &Encoding{
+	Subprotocol: dto.ProtocolNameMsgpack,
+	FrameType:   websocket.BinaryMessage,
+	marshal: func(value interface{}) ([]byte, error) {
+		var data []byte
+		err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(value)
+		return data, err
+	},
+	unmarshal: func(data []byte, value interface{}) error {
+		return codec.NewDecoderBytes(data, msgpackHandle).Decode(value)
+	},
+	envelope: func(envelope dto.Envelope) ([]byte, error) {
+		var data []byte
+		wire := msgpackEnvelope{envelope.Version, envelope.Type, envelope.ID, envelope.Revision, codec.Raw(envelope.Payload)}
+		err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(wire)
+		return data, err
+	},
+	open: func(data []byte) (*dto.Envelope, error) {
+		var wire msgpackEnvelope
+		if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&wire); err != nil {
+			return nil, err
+		}
+		return &dto.Envelope{Version: wire.Version, Type: wire.Type, ID: wire.ID, Revision: wire.Revision, Payload: []byte(wire.Payload)}, nil
+	},
+}
+
+// Encodings are the encodings of the realtime protocol, in the order the server prefers them
+var Encodings = []*Encoding{MessagePack, JSON}
+
+// Subprotocols are the WebSocket subprotocols the server speaks, in the order it prefers them
+func Subprotocols() []string {
+	subprotocols := make([]string, len(Encodings))
+	for i, encoding := range Encodings {
+		subprotocols[i] = encoding.Subprotocol
+	}
+	return subprotocols
+}
+
+// EncodingOf returns the encoding of a subprotocol, nil for legacy clients
+func EncodingOf(subprotocol string) *Encoding {
+	for _, encoding := range Encodings {
+		if encoding.Subprotocol == subprotocol {
+			return encoding
+		}
+	}
+	return nil
+}
+
+// Outgoing is a message from the server, encoded once for each encoding it's sent in
+type Outgoing struct {
+	envelope dto.Envelope
+	payload  interface{}
+	encoded  map[*Encoding][]byte
+}
+
+// NewOutgoing builds a message from the server
+func NewOutgoing(messageType string, id string, revision int64, payload interface{}) *Outgoing {
+	envelope := dto.Envelope{Version: dto.ProtocolVersion, Type: messageType, ID: id, Revision: revision}
+	return &Outgoing{envelope: envelope, payload: payload, encoded: make(map[*Encoding][]byte)}
+}
+
+// Type is the type of the message
+func (message *Outgoing) Type() string {
+	return message.envelope.Type
+}
+
+// In returns the message in an encoding, nil when it can't be encoded
+func (message *Outgoing) In(encoding *Encoding) []byte {
+	if data, ok := message.encoded[encoding]; ok {
+		return data
+	}
+	data, err := encoding.Encode(message.envelope.Type, message.envelope.ID, message.envelope.Revision, message.payload)
+	if err != nil {
+		slog.Error("Error marshalling message", "type", message.envelope.Type, "error", err)
+		return nil
+	}
+	message.encoded[encoding] = data
+	return data
+}
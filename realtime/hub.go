@@ -0,0 +1,219 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+)
+
+// Hub holds the sessions of a document. Changes keeps the latest changes of the document for
+// the sessions catching up after a lost connection. Callers hold Mutex while they use Clients,
+// Changes and Audience, sending to clients only queues messages so it's cheap to do under the
+// mutex. Viewers aren't in Clients, Audience holds them while there are any.
+type Hub struct {
+	DocumentID string
+	Clients    map[*Client]struct{}
+	Changes    *ChangeBuffer
+	Audience   *Audience
+	Mutex      sync.Mutex
+
+	viewers int
+	// closing is set once the last client left, the hub then only waits to be removed
+	closing bool
+	closed  chan struct{}
+}
+
+// Broadcast queues a message for every client of the hub but the source. message builds what
+// each client gets, nil skipping it. The caller holds the mutex.
+func (hub *Hub) Broadcast(source *Client, message func(client *Client) []byte) {
+	for client := range hub.Clients {
+		if client == source {
+			continue
+		}
+		if data := message(client); data != nil {
+			client.Send(data)
+		}
+	}
+}
+
+// Session returns the client of a session, nil when it isn't in the hub. The caller holds the
+// mutex.
+func (hub *Hub) Session(sessionID string) *Client {
+	for client := range hub.Clients {
+		if client.SessionID == sessionID {
+			return client
+		}
+	}
+	return nil
+}
+
+// Registry holds the hubs of the documents with open sessions. A hub is created when the
+// first session of its document joins and removed once the last one left.
+type Registry struct {
+	// ViewerInterval is how often the viewers of a document get the edits made
+	ViewerInterval time.Duration
+
+	bufferSize int
+	// open loads a document when its hub is created and returns its revision, close runs
+	// once the last session of the document left
+	open  func(documentID string) (int64, error)
+	close func(documentID string)
+
+	mutex sync.Mutex
+	hubs  map[string]*Hub
+}
+
+func NewRegistry(bufferSize int, open func(documentID string) (int64, error), close func(documentID string)) *Registry {
+	return &Registry{ViewerInterval: DefaultViewerInterval, bufferSize: bufferSize, open: open, close: close, hubs: make(map[string]*Hub)}
+}
+
+// Join adds a client to the hub of a document, creating it when needed. joined runs under the
+// mutex of the hub as soon as the client is in it, so that nothing is broadcast in between.
+func (registry *Registry) Join(documentID string, client *Client, joined func(hub *Hub)) (*Hub, error) {
+	hub, err := registry.acquire(documentID)
+	if err != nil {
+		return nil, err
+	}
+	hub.Clients[client] = struct{}{}
+	if joined != nil {
+		joined(hub)
+	}
+	hub.Mutex.Unlock()
+	return hub, nil
+}
+
+// Watch adds a viewer to the audience of a document, which document starts from when the
+// viewer is the first one. The viewer gets the document as of the last edits sent to viewers.
+func (registry *Registry) Watch(documentID string, client *Client, document func(hub *Hub) dto.DocumentData) (*Hub, error) {
+	hub, err := registry.acquire(documentID)
+	if err != nil {
+		return nil, err
+	}
+	if hub.Audience == nil {
+		hub.Audience = NewAudience(document(hub), hub.Changes.Revision(), registry.ViewerInterval)
+	}
+	hub.viewers++
+	audience := hub.Audience
+	hub.Mutex.Unlock()
+
+	audience.Add(client)
+	return hub, nil
+}
+
+// acquire returns the hub of a document with its mutex held, opening the document when the
+// hub is new
+func (registry *Registry) acquire(documentID string) (*Hub, error) {
+	for {
+		registry.mutex.Lock()
+		hub, ok := registry.hubs[documentID]
+		if !ok {
+			hub = &Hub{DocumentID: documentID, Clients: make(map[*Client]struct{}), closed: make(chan struct{})}
+			registry.hubs[documentID] = hub
+		}
+		registry.mutex.Unlock()
+
+		hub.Mutex.Lock()
+		if hub.closing {
+			// The document is being closed, join it again once that's done
+			hub.Mutex.Unlock()
+			<-hub.closed
+			continue
+		}
+		if hub.Changes == nil {
+			revision, err := registry.open(documentID)
+			if err != nil {
+				hub.closing = true
+				hub.Mutex.Unlock()
+				registry.remove(hub)
+				return nil, err
+			}
+			hub.Changes = NewChangeBuffer(registry.bufferSize, revision)
+		}
+		return hub, nil
+	}
+}
+
+// Leave removes a client from its hub. left runs under the mutex of the hub once the client
+// is out. When it was the last client the document is closed before the hub is removed, so
+// that sessions joining meanwhile find the document as it was left.
+func (registry *Registry) Leave(hub *Hub, client *Client, left func(hub *Hub)) {
+	hub.Mutex.Lock()
+	delete(hub.Clients, client)
+	if left != nil {
+		left(hub)
+	}
+	registry.release(hub)
+}
+
+// Unwatch removes a viewer from the audience of its document, which stops with the last one
+func (registry *Registry) Unwatch(hub *Hub, client *Client) {
+	hub.Mutex.Lock()
+	audience := hub.Audience
+	hub.viewers--
+	if hub.viewers == 0 {
+		audience.Stop()
+		hub.Audience = nil
+	}
+	registry.release(hub)
+	// The audience may be sending edits, the editors don't wait for it
+	audience.Remove(client)
+}
+
+// release unlocks a hub a session left, closing the document when it was the last one
+func (registry *Registry) release(hub *Hub) {
+	last := len(hub.Clients) == 0 && hub.viewers == 0
+	if last {
+		hub.closing = true
+	}
+	hub.Mutex.Unlock()
+
+	if last {
+		registry.close(hub.DocumentID)
+		registry.remove(hub)
+	}
+}
+
+func (registry *Registry) remove(hub *Hub) {
+	registry.mutex.Lock()
+	delete(registry.hubs, hub.DocumentID)
+	registry.mutex.Unlock()
+	close(hub.closed)
+}
+
+// Locked runs fn with the hub of a document locked, hub being nil when the document has no
+// sessions. No session can join meanwhile, so nothing edits the document while fn runs.
+func (registry *Registry) Locked(documentID string, fn func(hub *Hub)) {
+	registry.mutex.Lock()
+	hub, ok := registry.hubs[documentID]
+	if !ok {
+		defer registry.mutex.Unlock()
+		fn(nil)
+		return
+	}
+	// The registry stays locked until the hub is, nobody holds a hub while waiting for the
+	// registry
+	hub.Mutex.Lock()
+	registry.mutex.Unlock()
+	defer hub.Mutex.Unlock()
+	fn(hub)
+}
+
+// Get returns the hub of a document, if it has open sessions
+func (registry *Registry) Get(documentID string) (*Hub, bool) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	hub, ok := registry.hubs[documentID]
+	return hub, ok
+}
+
+// Hubs returns the hubs of all the documents with open sessions
+func (registry *Registry) Hubs() []*Hub {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	hubs := make([]*Hub, 0, len(registry.hubs))
+	for _, hub := range registry.hubs {
+		hubs = append(hubs, hub)
+	}
+	return hubs
+}
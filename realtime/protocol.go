@@ -0,0 +1,190 @@
+// Package realtime implements the protocol spoken by editors over the document WebSockets
+package realtime
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/khallihub/godoc/dto"
+)
+
+// maxMessageIDLength bounds the IDs clients give their messages
+const maxMessageIDLength = 64
+
+// maxPendingEdits bounds the edits a client sends when it resumes a session
+const maxPendingEdits = 1000
+
+// ProtocolError rejects a client message, it is sent back to the client as an error message
+type ProtocolError struct {
+	Code    string
+	Message string
+}
+
+func (err *ProtocolError) Error() string {
+	return err.Code + ": " + err.Message
+}
+
+func protocolError(code string, format string, args ...interface{}) *ProtocolError {
+	return &ProtocolError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// clientTypes are the message types clients may send
+var clientTypes = map[string]bool{
+	dto.MessageEdit:     true,
+	dto.MessagePresence: true,
+	dto.MessagePing:     true,
+	dto.MessageResume:   true,
+}
+
+// ParseEnvelope decodes and validates a message from a client, leaving its payload encoded
+func (encoding *Encoding) ParseEnvelope(raw []byte) (*dto.Envelope, *ProtocolError) {
+	envelope, err := encoding.open(raw)
+	if err != nil {
+		return nil, protocolError(dto.ErrorInvalidMessage, "message is not a valid envelope")
+	}
+	if envelope.Version != dto.ProtocolVersion {
+		return envelope, protocolError(dto.ErrorUnsupportedVersion, "protocol version %d is not supported, use %d", envelope.Version, dto.ProtocolVersion)
+	}
+	if !clientTypes[envelope.Type] {
+		return envelope, protocolError(dto.ErrorUnknownType, "unknown message type %q", envelope.Type)
+	}
+	if len(envelope.ID) > maxMessageIDLength {
+		return envelope, protocolError(dto.ErrorInvalidMessage, "message id is longer than %d characters", maxMessageIDLength)
+	}
+	if envelope.Revision < 0 {
+		return envelope, protocolError(dto.ErrorInvalidMessage, "revision can't be negative")
+	}
+	if envelope.Type == dto.MessageEdit && envelope.ID == "" {
+		return envelope, protocolError(dto.ErrorInvalidMessage, "edits need an id to be acknowledged")
+	}
+	return envelope, nil
+}
+
+// ParseEdit decodes and validates the payload of an edit message
+func (encoding *Encoding) ParseEdit(envelope *dto.Envelope) (*dto.EditPayload, *ProtocolError) {
+	var edit dto.EditPayload
+	if err := encoding.unmarshal(envelope.Payload, &edit); err != nil {
+		return nil, protocolError(dto.ErrorInvalidPayload, "edit payload is not valid")
+	}
+	if len(edit.Change.Ops) == 0 {
+		return nil, protocolError(dto.ErrorInvalidPayload, "edit has no change")
+	}
+	if err := ValidateDelta(edit.Change.Ops); err != nil {
+		return nil, err
+	}
+	// Editors may still send the whole document along with the change
+	if edit.Data != nil {
+		if err := ValidateDelta(edit.Data.Ops); err != nil {
+			return nil, err
+		}
+	}
+	// Clients don't get to speak for others
+	edit.Author, edit.SessionID = "", ""
+	return &edit, nil
+}
+
+// ParseResume decodes and validates the payload of a resume message
+func (encoding *Encoding) ParseResume(envelope *dto.Envelope) (*dto.ResumePayload, *ProtocolError) {
+	var resume dto.ResumePayload
+	if len(envelope.Payload) > 0 {
+		if err := encoding.unmarshal(envelope.Payload, &resume); err != nil {
+			return nil, protocolError(dto.ErrorInvalidPayload, "resume payload is not valid")
+		}
+	}
+	if len(resume.Pending) > maxPendingEdits {
+		return nil, protocolError(dto.ErrorInvalidPayload, "more than %d pending edits", maxPendingEdits)
+	}
+	for _, edit := range resume.Pending {
+		if edit.ID == "" || len(edit.ID) > maxMessageIDLength {
+			return nil, protocolError(dto.ErrorInvalidPayload, "pending edits need an id of at most %d characters", maxMessageIDLength)
+		}
+		if err := ValidateDelta(edit.Change.Ops); err != nil {
+			return nil, err
+		}
+	}
+	return &resume, nil
+}
+
+// ParsePresence decodes the payload of a presence message, only the cursor is kept
+func (encoding *Encoding) ParsePresence(envelope *dto.Envelope) (*dto.PresencePayload, *ProtocolError) {
+	var presence dto.PresencePayload
+	if len(envelope.Payload) > 0 {
+		if err := encoding.unmarshal(envelope.Payload, &presence); err != nil {
+			return nil, protocolError(dto.ErrorInvalidPayload, "presence payload is not valid")
+		}
+	}
+	return &dto.PresencePayload{Cursor: presence.Cursor}, nil
+}
+
+// ValidateDelta checks that every operation of a Quill delta is exactly one insert, delete or
+// retain with a valid argument
+func ValidateDelta(ops []map[string]interface{}) *ProtocolError {
+	for i, op := range ops {
+		kinds := 0
+		for key, value := range op {
+			switch key {
+			case "insert":
+				kinds++
+				switch insert := value.(type) {
+				case string:
+					if insert == "" {
+						return protocolError(dto.ErrorInvalidPayload, "operation %d inserts nothing", i)
+					}
+				case map[string]interface{}:
+					if len(insert) != 1 {
+						return protocolError(dto.ErrorInvalidPayload, "operation %d inserts an invalid embed", i)
+					}
+				default:
+					return protocolError(dto.ErrorInvalidPayload, "operation %d inserts neither text nor an embed", i)
+				}
+			case "delete", "retain":
+				kinds++
+				if length, ok := opLength(value); !ok || length < 1 {
+					return protocolError(dto.ErrorInvalidPayload, "operation %d has an invalid %s length", i, key)
+				}
+			case "attributes":
+				if _, ok := value.(map[string]interface{}); !ok {
+					return protocolError(dto.ErrorInvalidPayload, "operation %d has invalid attributes", i)
+				}
+			default:
+				return protocolError(dto.ErrorInvalidPayload, "operation %d has an unknown field %q", i, key)
+			}
+		}
+		if kinds != 1 {
+			return protocolError(dto.ErrorInvalidPayload, "operation %d must be one insert, delete or retain", i)
+		}
+		if _, deletes := op["delete"]; deletes && op["attributes"] != nil {
+			return protocolError(dto.ErrorInvalidPayload, "operation %d deletes with attributes", i)
+		}
+	}
+	return nil
+}
+
+// Encode builds a message from the server
+func (encoding *Encoding) Encode(messageType string, id string, revision int64, payload interface{}) ([]byte, error) {
+	envelope := dto.Envelope{Version: dto.ProtocolVersion, Type: messageType, ID: id, Revision: revision}
+	if payload != nil {
+		raw, err := encoding.marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		envelope.Payload = raw
+	}
+	return encoding.envelope(envelope)
+}
+
+// EncodeError builds the error message answering a rejected client message
+func (encoding *Encoding) EncodeError(id string, err *ProtocolError) []byte {
+	message, _ := encoding.Encode(dto.MessageError, id, 0, dto.ErrorPayload{Code: err.Code, Message: err.Message})
+	return message
+}
+
+// NewSessionID returns a random ID for a WebSocket session
+func NewSessionID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,81 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// streamKeepAlive is how often a comment is written to an idle stream, often enough for
+// proxies not to drop it
+const streamKeepAlive = 15 * time.Second
+
+// streamClose is the last event of a stream the server ended, with the close code a WebSocket
+// would have been closed with
+type streamClose struct {
+	Code   int    `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// AttachStream prepares the client of a stream of Server-Sent Events, for editors that can't
+// open a WebSocket. Stream then writes its messages, which are always JSON.
+func (client *Client) AttachStream() {
+	client.Encoding = JSON
+	client.open()
+}
+
+// Stream writes the messages queued for the client as Server-Sent Events until its session is
+// closed, the request is cancelled or writing fails
+func (client *Client) Stream(ctx context.Context, w http.ResponseWriter) error {
+	controller := http.NewResponseController(w)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// Buffering proxies would hold the events back
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	write := func(event string) error {
+		// Servers without write deadlines don't support them, a stuck stream then ends
+		// with the request
+		controller.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err := fmt.Fprint(w, event); err != nil {
+			return err
+		}
+		return controller.Flush()
+	}
+	for {
+		select {
+		case message := <-client.send:
+			// JSON messages are written on a single line
+			if err := write("data: " + string(message) + "\n\n"); err != nil {
+				client.Close()
+				return err
+			}
+		case <-ticker.C:
+			if err := write(": keepalive\n\n"); err != nil {
+				client.Close()
+				return err
+			}
+		case <-client.done:
+			if client.closeCode == 0 {
+				return nil
+			}
+			data, err := json.Marshal(streamClose{Code: client.closeCode, Reason: client.closeReason})
+			if err != nil {
+				return err
+			}
+			return write("event: close\ndata: " + string(data) + "\n\n")
+		case <-ctx.Done():
+			client.Close()
+			return nil
+		}
+	}
+}
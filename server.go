@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -15,43 +20,98 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/khallihub/godoc/controller"
 	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/health"
+	"github.com/khallihub/godoc/logging"
+	"github.com/khallihub/godoc/metrics"
 	"github.com/khallihub/godoc/middlewares"
+	"github.com/khallihub/godoc/realtime"
 	"github.com/khallihub/godoc/service"
+	"github.com/khallihub/godoc/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"github.com/joho/godotenv"
 )
 
+// documentDeletedCloseCode closes the sessions of a document moved to the trash, in the range
+// of close codes left to applications
+const documentDeletedCloseCode = 4410
+
+// viewerMode is the mode asked for by the sessions opened to follow a document read-only, as
+// when it's presented to a large audience
+const viewerMode = "view"
+
+// changeBufferSize is how many of the latest changes of a document are kept for the sessions
+// catching up after a lost connection
+const changeBufferSize = 500
+
+// cacheFlushInterval is how often the edits held in the cache are saved, the server stops
+// being ready when they haven't been for maxFlushLag
+const (
+	cacheFlushInterval = 30 * time.Second
+	maxFlushLag        = 3 * cacheFlushInterval
+)
+
+// On SIGTERM the server reports not ready for drainDelay, long enough for the load balancer
+// to stop sending it requests, then waits up to shutdownTimeout for those in flight
+const (
+	drainDelay      = 5 * time.Second
+	shutdownTimeout = 30 * time.Second
+)
+
+// defaultTrashRetentionDays is how long deleted documents stay in the trash when
+// TRASH_RETENTION_DAYS isn't set
+const defaultTrashRetentionDays = 30
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    realtime.Subprotocols(),
+	// Clients negotiating permessage-deflate get their larger messages compressed
+	EnableCompression: true,
 }
 
-type DocumentWebSocket struct {
-	Connections map[*websocket.Conn]bool
-	Mutex       sync.Mutex
-}
-
-var documentWebSockets = make(map[string]*DocumentWebSocket)
+// documentHubs holds the sessions of the documents open over WebSockets
+var documentHubs *realtime.Registry
 var documentCache sync.Map
 
+// dirtyDocuments maps the IDs of cached documents edited since they were last saved to the
+// email of their last editor
+var dirtyDocuments sync.Map
+
+// lastCacheFlush is when, in Unix nanoseconds, the cache was last saved without errors
+var lastCacheFlush atomic.Int64
+
 func main() {
 
 	err := godotenv.Load()
+	// The level and the format of the logs may come from the .env file
+	logging.Setup()
 	if err != nil {
-		fmt.Println("Error loading .env file:", err)
+		slog.Error("Error loading .env file", "error", err)
 		return
 	}
 
 	dbUrl := os.Getenv("DATABASE_URL")
 
 	if dbUrl == "" {
-		fmt.Println("DATABASE_URL not found in .env file")
+		slog.Error("DATABASE_URL not found in .env file")
 		return
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), "godoc-server")
+	if err != nil {
+		slog.Error("Error setting up tracing", "error", err)
+		return
+	}
+	defer shutdownTracing(context.Background())
+
 	// MongoDB connection setup
-	mongoClient, err := mongo.NewClient(options.Client().ApplyURI(dbUrl))
+	mongoClient, err := mongo.NewClient(options.Client().ApplyURI(dbUrl).SetMonitor(tracing.MongoMonitor(metrics.MongoMonitor())))
 	if err != nil {
 		panic(err)
 	}
@@ -65,26 +125,51 @@ func main() {
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Authorization", "Content-Type"}
+	config.AllowHeaders = []string{"Origin", "Authorization", "Content-Type", logging.RequestIDHeader, "traceparent", "tracestate"}
+	config.ExposeHeaders = []string{logging.RequestIDHeader}
 
 	server.Use(cors.New(config))
 
-	server.Use(gin.Recovery(), gin.Logger())
+	// Requests are traced in the trace of the load balancer, and logged without the credentials
+	// of their query strings
+	server.Use(gin.Recovery(), otelgin.Middleware("godoc-server"), middlewares.RequestID(), middlewares.AccessLog(), metrics.HTTP())
 
 	signupService := service.NewSignupService(mongoClient, "godoc", "users")
 	signupController := controller.NewSignupController(signupService)
 
 	loginService := service.NewLoginService(mongoClient, "godoc", "users")
 	jwtService := service.NewJWTService()
-	loginController := controller.NewLoginController(loginService, jwtService)
+	mfaService := service.NewMFAService(mongoClient, "godoc", "users")
+	loginController := controller.NewLoginController(loginService, jwtService, mfaService)
+	mfaController := controller.NewMFAController(mfaService, loginService, jwtService)
 
-	// Route for chaecking the health of the server
-	server.GET("/health", func(ctx *gin.Context) {
-		ctx.JSON(http.StatusOK, gin.H{
-			"status": "UP",
-		})
+	tokenService := service.NewTokenService(mongoClient, "godoc", "tokens")
+	tokenController := controller.NewTokenController(tokenService)
+	authorize := middlewares.AuthorizeJWT(tokenService)
+
+	// Route for Prometheus, the load balancer doesn't forward it
+	server.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	metrics.Cache(func() int {
+		return countEntries(&documentCache)
+	}, func() int {
+		return countEntries(&dirtyDocuments)
 	})
 
+	// The server is ready while MongoDB answers, the cache gets saved and it isn't shutting down
+	lastCacheFlush.Store(time.Now().UnixNano())
+	checker := health.NewChecker()
+	checker.Add("mongo", health.Mongo(mongoClient))
+	checker.Add("cache", health.FlushLag(func() time.Time {
+		return time.Unix(0, lastCacheFlush.Load())
+	}, func() int {
+		return countEntries(&dirtyDocuments)
+	}, maxFlushLag))
+
+	// Routes for checking the health of the server, /health is the former liveness route
+	server.GET("/health", checker.LiveHandler())
+	server.GET("/health/live", checker.LiveHandler())
+	server.GET("/health/ready", checker.ReadyHandler())
+
 	// Routes for handling user authentication
 	authRoutes := server.Group("/auth")
 	{
@@ -101,49 +186,184 @@ func main() {
 		})
 
 		// Login Endpoint: Authentication + Token creation
+		// Users with two-factor authentication get an MFA pending token instead of a session token
 		authRoutes.POST("/login", func(ctx *gin.Context) {
-			token := loginController.Login(ctx)
+			response := loginController.Login(ctx)
+			if response != nil {
+				ctx.JSON(http.StatusOK, response)
+			} else {
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"message": "Invalid credentials",
+				})
+			}
+		})
+
+		// Second login step: exchanges an MFA pending token and a TOTP or recovery code for a session token
+		authRoutes.POST("/login/mfa", func(ctx *gin.Context) {
+			token := loginController.LoginWithMFA(ctx)
 			if token != "" {
 				ctx.JSON(http.StatusOK, gin.H{
 					"token": token,
 				})
 			} else {
 				ctx.JSON(http.StatusUnauthorized, gin.H{
-					"message": "Invalid credentials",
+					"message": "Invalid two-factor code",
 				})
 			}
 		})
 	}
 
+	// Routes for managing two-factor authentication
+	mfaRoutes := server.Group("/auth/mfa")
+	{
+		// Enrollment is also reachable with an MFA pending token when the policy forces it
+		mfaRoutes.POST("/enroll", middlewares.AuthorizeMFAEnrollment(), mfaController.Enroll)
+		mfaRoutes.POST("/confirm", middlewares.AuthorizeMFAEnrollment(), mfaController.ConfirmEnrollment)
+		mfaRoutes.POST("/recovery-codes", authorize, middlewares.RequireSession(), mfaController.RegenerateRecoveryCodes)
+		mfaRoutes.POST("/disable", authorize, middlewares.RequireSession(), mfaController.Disable)
+	}
+
+	mailService := service.NewMailService()
+	userService := service.NewUserService(mongoClient, "godoc", "users", mailService)
+	userController := controller.NewUserController(userService)
+
+	// Confirms an email change from the link sent to the new address, the token is the credential
+	server.POST("/users/verify-email", userController.VerifyEmailChange)
+
+	// Routes for managing user accounts
+	userRoutes := server.Group("/users")
+	userRoutes.Use(authorize)
+	{
+		userRoutes.GET("/me", userController.GetMe)
+		userRoutes.PATCH("/me", userController.UpdateMe)
+		userRoutes.POST("/me/email", middlewares.RequireSession(), userController.RequestEmailChange)
+
+		// Public profile of a collaborator: display name and avatar only
+		userRoutes.GET("/profile", userController.GetProfile)
+
+		userRoutes.DELETE("/me", middlewares.RequireSession(), func(ctx *gin.Context) {
+			documentIDs := userController.DeleteMe(ctx)
+			// Documents deleted with the account must not be written back by the cache sync
+			for _, documentID := range documentIDs {
+				evictDocument(documentID)
+			}
+		})
+	}
+
+	// Routes for managing personal access tokens, only reachable with a session token
+	tokenRoutes := server.Group("/auth/tokens")
+	tokenRoutes.Use(authorize, middlewares.RequireSession())
+	{
+		tokenRoutes.POST("", tokenController.CreateToken)
+		tokenRoutes.GET("", tokenController.ListTokens)
+		tokenRoutes.DELETE("/:id", tokenController.RevokeToken)
+	}
+
+	// Routes reserved for administrators
+	adminRoutes := server.Group("/admin")
+	adminRoutes.Use(authorize, middlewares.RequireSession(), middlewares.RequireAdmin())
+	{
+		adminRoutes.GET("/mfa-policy", mfaController.GetPolicy)
+		adminRoutes.PUT("/mfa-policy", mfaController.SetPolicy)
+	}
+
 	documentService := service.NewDocumentService(mongoClient, "godoc", "documents")
-	documentController := controller.NewDocumentController(documentService)
+	invitationService := service.NewInvitationService(mongoClient, "godoc", "invitations", mailService)
+	documentController := controller.NewDocumentController(documentService, invitationService)
+	documentHubs = realtime.NewRegistry(changeBufferSize, openDocument(documentController), closeDocument(documentController))
+
+	// Convert documents still using readAccess/writeAccess to role based access lists
+	migrated, err := documentService.MigrateAccess()
+	if err != nil {
+		slog.Error("Error migrating document access", "error", err)
+		return
+	}
+	if migrated > 0 {
+		slog.Info("Migrated document access lists", "count", migrated)
+	}
+
+	// Date documents saved before modification times were recorded
+	if _, err := documentService.BackfillMetadata(); err != nil {
+		slog.Error("Error backfilling document metadata", "error", err)
+		return
+	}
+
+	// Index the bodies of documents saved before full-text search
+	indexed, err := documentService.BackfillSearchText()
+	if err != nil {
+		slog.Error("Error indexing document text", "error", err)
+		return
+	}
+	if indexed > 0 {
+		slog.Info("Indexed document text", "count", indexed)
+	}
+
+	labelService := service.NewLabelService(mongoClient, "godoc", "documentlabels")
+	labelController := controller.NewLabelController(labelService, documentService)
+
+	trashRetention := time.Duration(defaultTrashRetentionDays) * 24 * time.Hour
+	if days := os.Getenv("TRASH_RETENTION_DAYS"); days != "" {
+		parsed, err := strconv.Atoi(days)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid TRASH_RETENTION_DAYS, keeping deleted documents for the default period", "days", defaultTrashRetentionDays)
+		} else {
+			trashRetention = time.Duration(parsed) * 24 * time.Hour
+		}
+	}
+
+	bulkService := service.NewBulkService(mongoClient, "godoc", "documents")
+	bulkController := controller.NewBulkController(bulkService)
+
+	folderService := service.NewFolderService(mongoClient, "godoc", "folders")
+	folderController := controller.NewFolderController(folderService)
+
+	// Routes for organizing documents in folders, access changes apply to open sessions. Tokens
+	// for specific documents can't reach the other documents of a folder through it.
+	folderRoutes := server.Group("/folders")
+	folderRoutes.Use(authorize, middlewares.RejectDocumentTokens())
+	{
+		folderRoutes.GET("", folderController.GetContents)
+		folderRoutes.GET("/:id", folderController.GetContents)
+		folderRoutes.POST("", middlewares.RequireWriteScope(), folderController.CreateFolder)
+		folderRoutes.PATCH("/:id", middlewares.RequireWriteScope(), folderController.RenameFolder)
+		folderRoutes.POST("/:id/move", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			reloadDocumentAccess(ctx.Request.Context(), documentController, folderController.MoveFolder(ctx))
+		})
+		folderRoutes.POST("/:id/share", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			reloadDocumentAccess(ctx.Request.Context(), documentController, folderController.ShareFolder(ctx))
+		})
+		folderRoutes.DELETE("/:id", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			reloadDocumentAccess(ctx.Request.Context(), documentController, folderController.DeleteFolder(ctx))
+		})
+	}
 
 	// Route for handling document operations
 	documentRoutes := server.Group(("/documents"))
-	documentRoutes.Use(middlewares.AuthorizeJWT())
+	documentRoutes.Use(authorize, middlewares.RestrictTokenDocuments())
 	{
 		documentRoutes.GET("/handler", func(ctx *gin.Context) {
 			documentID := ctx.Query("document_id")
 			handleWebSocket(ctx, documentID, documentController)
 		})
 
-		// Route for getting all documents
-		documentRoutes.POST("/getall", func(ctx *gin.Context) {
-			// Fetching documents from MongoDB and responding with JSON
-			documents, err := documentController.GetAllDocuments(ctx)
-			if err != nil {
-				return
-			}
-			ctx.JSON(http.StatusOK, gin.H{
-				"documents": documents,
-			})
+		// Routes for editors that can't open a WebSocket: changes and presence come as
+		// Server-Sent Events and messages are posted, their answers come on the stream
+		documentRoutes.GET("/stream", func(ctx *gin.Context) {
+			handleEventStream(ctx, ctx.Query("document_id"), documentController)
 		})
+		documentRoutes.POST("/stream/messages", func(ctx *gin.Context) {
+			postStreamMessage(ctx, false)
+		})
+
+		// Routes for listing the documents of the user a page at a time
+		documentRoutes.GET("/list", documentController.ListDocuments)
+		documentRoutes.POST("/getall", documentController.ListDocuments)
 
-		// Route for seraching documents by title
+		// Route for searching the titles and bodies of documents, best matches first
 		documentRoutes.POST("/search", func(ctx *gin.Context) {
 			documents, err := documentController.SearchDocuments(ctx)
 			if err != nil {
-				fmt.Println("Error searching documents:", err)
+				requestLogger(ctx).Error("Error searching documents", "error", err)
 				return
 			}
 			ctx.JSON(http.StatusOK, gin.H{
@@ -152,183 +372,1006 @@ func main() {
 		})
 
 		// Route for creating a new document
-		documentRoutes.POST("/createnew", func(ctx *gin.Context) {
+		documentRoutes.POST("/createnew", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
 			// Creating a new document and storing it in MongoDB
 			documentController.CreateNewDocument(ctx)
 		})
 
+		// Route for copying a document the user can read into a new document of theirs
+		documentRoutes.POST("/duplicate", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			documentController.DuplicateDocument(ctx, func(documentID string) error {
+				return flushDocument(ctx.Request.Context(), documentID, documentController)
+			})
+		})
+
 		// Route for getting a specific document
 		documentRoutes.POST("/getone/:id", func(ctx *gin.Context) {
 
-			document, err := initializeDocumentCache(ctx, documentController)
+			document, err := initializeDocumentCache(ctx.Request.Context(), ctx.Param("id"), documentController)
 
 			if err != nil {
-				fmt.Println("Error getting document:", err)
+				requestLogger(ctx).Info("Error getting document", "document_id", ctx.Param("id"), "error", err)
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
 				return
 			}
-			ctx.JSON(http.StatusOK, document)
+
+			principals, err := documentController.Principals(ctx.Request.Context(), ctx.GetString("email"))
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check document access"})
+				return
+			}
+
+			// Respond with a copy carrying the caller's role, the cached document is shared
+			response := snapshotDocument(document)
+			response.Role = service.DocumentRole(&response, principals...)
+			if response.Role == "" {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+				return
+			}
+			response.Breadcrumbs, err = folderController.Breadcrumbs(response.FolderID, ctx.GetString("email"))
+			if err != nil {
+				requestLogger(ctx).Error("Error getting document breadcrumbs", "document_id", document.ID, "error", err)
+			}
+			if labels, err := labelController.GetLabels(document.ID, ctx.GetString("email")); err != nil {
+				requestLogger(ctx).Error("Error getting document labels", "document_id", document.ID, "error", err)
+			} else {
+				response.Starred, response.Labels = labels.Starred, labels.Labels
+			}
+			if err := documentController.RecordOpen(ctx.Request.Context(), document.ID, ctx.GetString("email")); err != nil {
+				requestLogger(ctx).Error("Error recording document open", "document_id", document.ID, "error", err)
+			}
+			ctx.JSON(http.StatusOK, response)
 		})
 
-		documentRoutes.POST("/updatetitle", func(ctx *gin.Context) {
+		documentRoutes.POST("/updatetitle", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
 			// Updating the title of a document
 			title, documentID := documentController.UpdateTitle(ctx)
 			updateDocumentTitleCacheAttribute(documentID, title)
+			if documentID != "" {
+				notifyDocumentWebSockets(documentID, dto.MessageTitleChange, dto.TitlePayload{Title: title})
+			}
+		})
+
+		// Route for the tags shared with every collaborator, editors set them
+		documentRoutes.PATCH("/tags", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			documentID, tags := documentController.UpdateTags(ctx)
+			updateDocumentTagsCacheAttribute(documentID, tags)
 		})
 
-		documentRoutes.POST("/updatecollaborators", func(ctx *gin.Context) {
+		// Routes for the caller's own stars and labels, other collaborators don't see them
+		documentRoutes.PUT("/star", middlewares.RequireWriteScope(), labelController.SetStarred)
+		documentRoutes.PATCH("/labels", middlewares.RequireWriteScope(), labelController.UpdateLabels)
+		documentRoutes.GET("/labels", labelController.ListLabels)
+
+		documentRoutes.POST("/updatecollaborators", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
 			// Adding a collaborator to a document
 			// updating the database
 			document := documentController.UpdateCollaborators(ctx)
 			// updating the cache
-			access := new(dto.Access)
-			access.ID = document.ID
-			access.ReadAccess = document.ReadAccess
-			access.WriteAccess = document.WriteAccess
-			updateDocumentCacheAttribute(document.ID, documentController, *access)
+			refreshDocumentAccess(documentController, document)
+		})
+
+		// Routes for sharing with one principal at a time, concurrent changes don't overwrite each other
+		documentRoutes.POST("/collaborators", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			refreshDocumentAccess(documentController, documentController.AddCollaborator(ctx))
+		})
+
+		documentRoutes.PATCH("/collaborators", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			refreshDocumentAccess(documentController, documentController.ChangeCollaboratorRole(ctx))
+		})
+
+		documentRoutes.DELETE("/collaborators", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			refreshDocumentAccess(documentController, documentController.RemoveCollaborator(ctx))
+		})
+
+		documentRoutes.GET("/invitations", documentController.ListInvitations)
+		documentRoutes.DELETE("/invitations/:invitationId", middlewares.RequireWriteScope(), documentController.RevokeInvitation)
+
+		documentRoutes.POST("/move", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			if document := folderController.MoveDocument(ctx); document != nil {
+				reloadDocumentAccess(ctx.Request.Context(), documentController, []string{document.ID})
+			}
 		})
 
-		// Route for deleting a document
-		documentRoutes.DELETE("/delete/:id", func(ctx *gin.Context) {
-			// Deleting a document from MongoDB
-			documentController.DeleteDocument(ctx)
+		documentRoutes.POST("/transferownership", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			// Making another user the owner, the caller stays on as an editor
+			refreshDocumentAccess(documentController, documentController.TransferOwnership(ctx))
+		})
+
+		// Route for deleting a document, it goes to the trash and its open sessions are closed
+		documentRoutes.DELETE("/delete/:id", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			documentID := documentController.TrashDocument(ctx, trashRetention)
+			if documentID == "" {
+				return
+			}
+			closeTrashedDocument(ctx.Request.Context(), documentID, documentController)
+		})
+
+		// Route for applying one operation to many documents, reporting the outcome of each
+		documentRoutes.POST("/bulk", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			result := bulkController.Apply(ctx, trashRetention)
+			if result == nil {
+				return
+			}
+			var documentIDs []string
+			for _, item := range result.Results {
+				if item.Status == dto.BulkSucceeded {
+					documentIDs = append(documentIDs, item.DocumentID)
+				}
+			}
+			switch result.Operation {
+			case dto.BulkDelete:
+				for _, documentID := range documentIDs {
+					closeTrashedDocument(ctx.Request.Context(), documentID, documentController)
+				}
+			case dto.BulkMove, dto.BulkRetag, dto.BulkTransfer, dto.BulkShare:
+				reloadDocumentAccess(ctx.Request.Context(), documentController, documentIDs)
+			}
+		})
+
+		// Routes for the trash of the user, documents are purged after the retention period
+		documentRoutes.GET("/trash", documentController.ListTrash)
+		documentRoutes.POST("/trash/:id/restore", middlewares.RequireWriteScope(), documentController.RestoreDocument)
+		documentRoutes.DELETE("/trash/:id", middlewares.RequireWriteScope(), documentController.DeleteDocument)
+	}
+
+	// Route for accepting an invitation sent before the invitee had an account
+	server.POST("/invitations/accept", authorize, middlewares.RequireSession(), func(ctx *gin.Context) {
+		refreshDocumentAccess(documentController, documentController.AcceptInvitation(ctx))
+	})
+
+	templateController := controller.NewTemplateController(documentService)
+
+	// Routes for the template gallery, documents are offered as templates by their owners
+	templateRoutes := server.Group("/templates")
+	templateRoutes.Use(authorize, middlewares.RestrictTokenDocuments())
+	{
+		templateRoutes.GET("", templateController.ListTemplates)
+		templateRoutes.POST("", middlewares.RequireWriteScope(), templateController.MarkTemplate)
+		templateRoutes.DELETE("/:id", middlewares.RequireWriteScope(), templateController.UnmarkTemplate)
+		templateRoutes.POST("/:id/use", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			templateController.UseTemplate(ctx, func(documentID string) error {
+				return flushDocument(ctx.Request.Context(), documentID, documentController)
+			})
+		})
+	}
+
+	groupService := service.NewGroupService(mongoClient, "godoc", "groups")
+	groupController := controller.NewGroupController(groupService)
+
+	// Routes for managing groups of collaborators, membership changes apply to open sessions.
+	// Groups grant roles on every document shared with them, so tokens for specific documents
+	// can't manage them.
+	groupRoutes := server.Group("/groups")
+	groupRoutes.Use(authorize, middlewares.RejectDocumentTokens())
+	{
+		groupRoutes.POST("", middlewares.RequireWriteScope(), groupController.CreateGroup)
+		groupRoutes.GET("", groupController.ListGroups)
+		groupRoutes.GET("/:id", groupController.GetGroup)
+
+		groupRoutes.POST("/:id/members", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			refreshUserWebSockets(documentController, groupController.AddMember(ctx))
+		})
+		groupRoutes.DELETE("/:id/members/:email", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			refreshUserWebSockets(documentController, groupController.RemoveMember(ctx))
+		})
+		groupRoutes.DELETE("/:id", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			refreshUserWebSockets(documentController, groupController.DeleteGroup(ctx))
+		})
+	}
+
+	shareLinkService := service.NewShareLinkService(mongoClient, "godoc", "sharelinks")
+	shareLinkController := controller.NewShareLinkController(shareLinkService, documentService)
+
+	// Routes for owners managing the share links of their documents
+	shareLinkRoutes := server.Group("/documents/sharelinks")
+	shareLinkRoutes.Use(authorize, middlewares.RestrictTokenDocuments())
+	{
+		shareLinkRoutes.POST("", middlewares.RequireWriteScope(), shareLinkController.CreateLink)
+		shareLinkRoutes.GET("", shareLinkController.ListLinks)
+		shareLinkRoutes.DELETE("/:linkId", middlewares.RequireWriteScope(), func(ctx *gin.Context) {
+			closeShareLinkWebSockets(shareLinkController.RevokeLink(ctx))
+		})
+	}
+
+	// Routes for opening a document through a share link, signing in is optional
+	shareRoutes := server.Group("/share")
+	shareRoutes.Use(middlewares.OptionalJWT(tokenService))
+	{
+		shareRoutes.POST("/open", func(ctx *gin.Context) {
+			link := shareLinkController.ResolveLink(ctx)
+			if link == nil {
+				return
+			}
+			document, err := initializeDocumentCache(ctx.Request.Context(), link.DocumentID, documentController)
+			if err != nil {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+				return
+			}
+			role, err := shareLinkRole(ctx.Request.Context(), link, ctx.GetString("email"), documentController)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check document access"})
+				return
+			}
+
+			// Link users don't get to see who else the document is shared with
+			response := snapshotDocument(document)
+			response.ACL = nil
+			response.InheritedACL = nil
+			response.FolderID = ""
+			response.Role = role
+			if email := ctx.GetString("email"); email != "" {
+				if err := documentController.RecordOpen(ctx.Request.Context(), document.ID, email); err != nil {
+					requestLogger(ctx).Error("Error recording document open", "document_id", document.ID, "error", err)
+				}
+			}
+			ctx.JSON(http.StatusOK, response)
+		})
+
+		shareRoutes.GET("/handler", func(ctx *gin.Context) {
+			handleShareLinkWebSocket(ctx, shareLinkController, documentController)
+		})
+
+		shareRoutes.GET("/stream", func(ctx *gin.Context) {
+			handleShareLinkEventStream(ctx, shareLinkController, documentController)
+		})
+		shareRoutes.POST("/stream/messages", func(ctx *gin.Context) {
+			postStreamMessage(ctx, true)
 		})
 	}
 
 	// Start the periodic cache update
 	updateDatabaseWithCache(documentController)
 
+	// Start the periodic purge of the trash
+	purgeTrash(documentService)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	server.Run("127.0.0.1:" + port)
+	serve(&http.Server{Addr: "127.0.0.1:" + port, Handler: server}, checker, documentController)
+}
+
+// serve serves requests until SIGINT or SIGTERM, then drains the server: it reports not ready
+// so that no new requests come, closes the realtime sessions, waits for the requests left and
+// saves the cache
+func serve(httpServer *http.Server, checker *health.Checker, documentController controller.DocumentController) {
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error serving requests", "error", err)
+			os.Exit(1)
+		}
+	}()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	<-stop
+
+	slog.Info("Draining server", "delay", drainDelay)
+	checker.Drain()
+	time.Sleep(drainDelay)
+
+	// The clients of the sessions reconnect through the load balancer to a ready server
+	_, clients := documentClients(func(documentID string, client *realtime.Client) bool {
+		return true
+	})
+	for _, client := range clients {
+		client.CloseWith(websocket.CloseGoingAway, "Server shutting down")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down server", "error", err)
+	}
+	if err := syncDatabaseWithCache(documentController); err != nil {
+		slog.Error("Error updating database with cache", "error", err)
+	}
+	slog.Info("Server stopped")
 }
 
 func handleWebSocket(ctx *gin.Context, documentID string, documentController controller.DocumentController) {
-	fmt.Println("Handling WebSocket connection for document:", documentID)
-	fmt.Println("Connection handled by server running on port:", os.Getenv("PORT"))
-	
+	requestLogger(ctx).Debug("Opening WebSocket", "document_id", documentID, "port", os.Getenv("PORT"))
+
+	if client := documentSession(ctx, documentID, documentController); client != nil {
+		serveWebSocket(ctx, documentID, client)
+	}
+}
+
+// handleShareLinkWebSocket opens a session through a share link, anonymous users are read-only
+func handleShareLinkWebSocket(ctx *gin.Context, shareLinkController controller.ShareLinkController, documentController controller.DocumentController) {
+	if client, documentID := shareLinkSession(ctx, shareLinkController, documentController); client != nil {
+		serveWebSocket(ctx, documentID, client)
+	}
+}
+
+func handleEventStream(ctx *gin.Context, documentID string, documentController controller.DocumentController) {
+	if client := documentSession(ctx, documentID, documentController); client != nil {
+		serveEventStream(ctx, documentID, client)
+	}
+}
+
+func handleShareLinkEventStream(ctx *gin.Context, shareLinkController controller.ShareLinkController, documentController controller.DocumentController) {
+	if client, documentID := shareLinkSession(ctx, shareLinkController, documentController); client != nil {
+		serveEventStream(ctx, documentID, client)
+	}
+}
+
+// documentSession prepares the session of a user on a document with their role, it answers
+// the request and returns nil when they can't open it
+func documentSession(ctx *gin.Context, documentID string, documentController controller.DocumentController) *realtime.Client {
+	client := &realtime.Client{Email: ctx.GetString("email"), Scope: ctx.GetString("scope"), Viewer: ctx.Query("mode") == viewerMode}
+	role, err := documentController.GetRole(ctx.Request.Context(), documentID, client.Email)
+	if err != nil || role == "" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return nil
+	}
+	client.Role = role
+	client.CanEdit.Store(clientCanEdit(client, role))
+	return client
+}
+
+// shareLinkSession prepares a session opened through a share link and returns it with the
+// document of the link, it answers the request and returns nil when the link can't be opened
+func shareLinkSession(ctx *gin.Context, shareLinkController controller.ShareLinkController, documentController controller.DocumentController) (*realtime.Client, string) {
+	link := shareLinkController.ResolveLink(ctx)
+	if link == nil {
+		return nil, ""
+	}
+	client := &realtime.Client{Email: ctx.GetString("email"), Scope: ctx.GetString("scope"), ShareLinkID: link.ID, Viewer: ctx.Query("mode") == viewerMode}
+	role, err := shareLinkRole(ctx.Request.Context(), link, client.Email, documentController)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check document access"})
+		return nil, ""
+	}
+	client.Role = role
+	client.CanEdit.Store(clientCanEdit(client, role))
+	return client, link.DocumentID
+}
+
+// shareLinkRole is the role granted by opening a share link: anonymous users are viewers,
+// signed-in users keep their own role when it's better than the link's
+func shareLinkRole(ctx context.Context, link *dto.ShareLink, email string, documentController controller.DocumentController) (string, error) {
+	if email == "" {
+		return dto.RoleViewer, nil
+	}
+	role, err := documentController.GetRole(ctx, link.DocumentID, email)
+	if err != nil {
+		return "", err
+	}
+	if service.RoleAllows(role, link.Role) {
+		return role, nil
+	}
+	return link.Role, nil
+}
+
+func serveWebSocket(ctx *gin.Context, documentID string, client *realtime.Client) {
 	upgrader.CheckOrigin = func(r *http.Request) bool {
 		// Allow any origin (not recommended for production, consider a more restrictive check)
 		return true
 	}
-	
+
+	sessionID, err := realtime.NewSessionID()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open session"})
+		return
+	}
+	client.SessionID = sessionID
+	client.Log = sessionLogger(ctx, documentID, client)
+
 	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
-		log.Println("Error upgrading to WebSocket:", err)
+		client.Logger().Info("Error upgrading to WebSocket", "error", err)
 		return
 	}
 	defer conn.Close()
-	
-	// Get or create a WebSocket instance for the documentID
-	documentWebSocket, ok := documentWebSockets[documentID]
-	if !ok {
-		documentWebSocket = &DocumentWebSocket{Connections: make(map[*websocket.Conn]bool)}
-		documentWebSockets[documentID] = documentWebSocket
+
+	// Editors asking for the realtime protocol get typed messages in the encoding they chose,
+	// the others the legacy ones
+	if encoding := realtime.EncodingOf(conn.Subprotocol()); encoding != nil {
+		client.Protocol = dto.ProtocolVersion
+		client.Encoding = encoding
+	}
+	client.Attach(conn)
+	defer client.Close()
+	if client.Viewer && client.Protocol != dto.ProtocolVersion {
+		client.CloseWith(websocket.ClosePolicyViolation, "Viewers must speak the realtime protocol")
+		return
+	}
+
+	hub, err := joinDocument(documentID, client)
+	if err != nil {
+		client.Logger().Error("Error opening document", "error", err)
+		client.CloseWith(websocket.CloseInternalServerErr, "Document could not be opened")
+		return
 	}
-	fmt.Println("Number of active connections:", len(documentWebSockets[documentID].Connections)+1)
+	defer leaveDocument(hub, client)
 
-	// Add the new connection to the WebSocket instance
-	documentWebSocket.Mutex.Lock()
-	documentWebSocket.Connections[conn] = true
-	documentWebSocket.Mutex.Unlock()
+	err = client.ReadMessages(func(msg []byte) {
+		if client.Protocol == dto.ProtocolVersion {
+			handleProtocolMessage(hub, client, msg)
+			return
+		}
 
-	// Create a channel to signal when a client disconnects
-	disconnectChannel := make(chan *websocket.Conn, 1)
+		if !client.CanEdit.Load() {
+			client.Logger().Info("Ignoring edit from read-only connection")
+			return
+		}
 
-	// Save the source connection
-	sourceConnection := conn
+		var message dto.Message
+		if err := json.Unmarshal(msg, &message); err != nil {
+			client.Logger().Info("Error unmarshalling message", "error", err)
+			return
+		}
 
-	// Start a goroutine to handle disconnection cleanup
-	go func() {
-		select {
-		case <-disconnectChannel:
-			// Remove the connection from the WebSocket instance when the client disconnects
-			documentWebSocket.Mutex.Lock()
-			delete(documentWebSocket.Connections, sourceConnection)
-			if len(documentWebSocket.Connections) == 0 {
-				fmt.Println("No more connections. Cleaning up resources for document:", documentID)
-				documentCache.Delete(documentID)
-				delete(documentWebSockets, documentID)
-			}
-			documentWebSocket.Mutex.Unlock()
+		// Legacy clients always edit the latest revision
+		change, err := json.Marshal(message.Change)
+		if err != nil {
+			client.Logger().Error("Error marshalling message", "error", err)
+			return
 		}
-	}()
+		edit := dto.EditPayload{Data: &message.Data}
+		if err := json.Unmarshal(change, &edit.Change); err != nil {
+			client.Logger().Info("Error unmarshalling change", "error", err)
+			return
+		}
+		applyEdit(hub, client, "", 0, &edit)
+	})
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		client.Logger().Info("Error reading message", "error", err)
+	} else {
+		client.Logger().Debug("WebSocket closed", "reason", err)
+	}
+}
 
-	// Save the source connection
-	// sourceConnection := conn
+// serveEventStream serves a session as a stream of Server-Sent Events. Editors speak the
+// realtime protocol in JSON: the welcome message gives them the ID of the session, which they
+// post their messages to.
+func serveEventStream(ctx *gin.Context, documentID string, client *realtime.Client) {
+	sessionID, err := realtime.NewSessionID()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open session"})
+		return
+	}
+	client.SessionID = sessionID
+	client.Log = sessionLogger(ctx, documentID, client)
+	client.Protocol = dto.ProtocolVersion
+	client.AttachStream()
+	defer client.Close()
+
+	hub, err := joinDocument(documentID, client)
+	if err != nil {
+		client.Logger().Error("Error opening document", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Document could not be opened"})
+		return
+	}
+	defer leaveDocument(hub, client)
+
+	if err := client.Stream(ctx.Request.Context(), ctx.Writer); err != nil {
+		client.Logger().Info("Error writing event stream", "error", err)
+	}
+}
+
+// postStreamMessage hands a message posted by the editor of an event stream to its session,
+// it is answered on the stream like a WebSocket message. Only the user who opened the session
+// may post to it, through the kind of route they opened it with.
+func postStreamMessage(ctx *gin.Context, shareLink bool) {
+	var client *realtime.Client
+	hub, ok := documentHubs.Get(ctx.Query("document_id"))
+	if ok {
+		hub.Mutex.Lock()
+		client = hub.Session(ctx.Query("session_id"))
+		hub.Mutex.Unlock()
+	}
+	if client == nil || !client.Streamed() || client.Email != ctx.GetString("email") || (client.ShareLinkID != "") != shareLink {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	message, err := ctx.GetRawData()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	handleProtocolMessage(hub, client, message)
+	ctx.Status(http.StatusAccepted)
+}
+
+// joinDocument adds a session to the hub of its document, which loads the document on the
+// first one, and welcomes it. Viewers join its audience instead and get a snapshot of the
+// document.
+func joinDocument(documentID string, client *realtime.Client) (*realtime.Hub, error) {
+	var hub *realtime.Hub
+	var err error
+	if client.Viewer {
+		hub, err = documentHubs.Watch(documentID, client, func(hub *realtime.Hub) dto.DocumentData {
+			return cachedDocumentData(hub.DocumentID)
+		})
+	} else {
+		hub, err = documentHubs.Join(documentID, client, func(hub *realtime.Hub) {
+			client.Logger().Debug("Session joined", "sessions", len(hub.Clients))
+			welcomeSession(hub, client)
+		})
+	}
+	if err == nil {
+		sessionMetric(documentID, client).Inc()
+	}
+	return hub, err
+}
+
+// leaveDocument removes a session from its hub and tells the others it left
+func leaveDocument(hub *realtime.Hub, client *realtime.Client) {
+	sessionMetric(hub.DocumentID, client).Dec()
+	if client.Viewer {
+		documentHubs.Unwatch(hub, client)
+		return
+	}
+	documentHubs.Leave(hub, client, func(hub *realtime.Hub) {
+		broadcastPresence(hub, client, dto.PresenceLeft)
+	})
+}
+
+// sessionMetric is the gauge counting the sessions of a document opened like client
+func sessionMetric(documentID string, client *realtime.Client) prometheus.Gauge {
+	transport, mode := "websocket", "edit"
+	if client.Streamed() {
+		transport = "event-stream"
+	}
+	if client.Viewer {
+		mode = viewerMode
+	}
+	return metrics.RealtimeSessions.WithLabelValues(documentID, transport, mode)
+}
+
+// requestLogger returns the logger of a request, carrying its ID
+func requestLogger(ctx *gin.Context) *slog.Logger {
+	return logging.FromContext(ctx.Request.Context())
+}
 
-	for {
-		_, msg, err := conn.ReadMessage()
+// sessionLogger returns the logger of a realtime session, tagged with the ID of its connection
+func sessionLogger(ctx *gin.Context, documentID string, client *realtime.Client) *slog.Logger {
+	return requestLogger(ctx).With("document_id", documentID, "session_id", client.SessionID, "viewer", client.Viewer)
+}
+
+// openDocument loads a document in the cache when its first session opens and returns the
+// revision sessions start from
+func openDocument(documentController controller.DocumentController) func(documentID string) (int64, error) {
+	return func(documentID string) (int64, error) {
+		document, err := initializeDocumentCache(context.Background(), documentID, documentController)
 		if err != nil {
-			log.Println("Error reading message:", err)
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("Error reading message: %v", err)
-			}
-			break
+			return 0, err
 		}
+		return document.Revision, nil
+	}
+}
 
-		var message dto.Message
-		if err := json.Unmarshal(msg, &message); err != nil {
-			log.Println("Error unmarshalling document:", err)
-			continue
+// closeDocument saves the last edits of a document once its last session left and drops it
+// from the cache
+func closeDocument(documentController controller.DocumentController) func(documentID string) {
+	return func(documentID string) {
+		slog.Debug("No more sessions, closing document", "document_id", documentID)
+		if err := flushDocument(context.Background(), documentID, documentController); err != nil {
+			slog.Error("Error updating database for document", "document_id", documentID, "error", err)
 		}
+		documentCache.Delete(documentID)
+		metrics.ForgetDocument(documentID)
+	}
+}
 
-		// Update the document cache
-		if err := updateDocumentCache(documentID, documentController, message.Data); err != nil {
-			log.Println("Error updating document cache:", err)
+// welcomeSession opens the session of a client speaking the realtime protocol: it gets the
+// revision it starts from and the sessions already there, which are told it joined. The
+// caller holds the mutex of the hub.
+func welcomeSession(hub *realtime.Hub, client *realtime.Client) {
+	if client.Protocol != dto.ProtocolVersion {
+		return
+	}
+	welcome := dto.WelcomePayload{SessionID: client.SessionID, Role: client.Role, CanEdit: client.CanEdit.Load()}
+	message, err := client.Encoding.Encode(dto.MessageWelcome, "", hub.Changes.Revision(), welcome)
+	if err != nil {
+		client.Logger().Error("Error marshalling message", "error", err)
+		return
+	}
+	client.Send(message)
+	for peer := range hub.Clients {
+		if peer == client || peer.Protocol != dto.ProtocolVersion {
 			continue
 		}
+		presence := dto.PresencePayload{SessionID: peer.SessionID, Email: peer.Email, State: dto.PresenceJoined}
+		if message, err := client.Encoding.Encode(dto.MessagePresence, "", 0, presence); err == nil {
+			client.Send(message)
+		}
+	}
+	broadcastPresence(hub, client, dto.PresenceJoined)
+}
 
-		// Update the document in the database
-		// if err := documentController.UpdateDocument(documentID, message.Data); err != nil {
-		// 	log.Println("Error updating document in DB:", err)
-		// 	continue
-		// }
+// handleProtocolMessage answers a message from a client speaking the realtime protocol,
+// rejected messages are answered with an error message
+func handleProtocolMessage(hub *realtime.Hub, client *realtime.Client, raw []byte) {
+	envelope, protocolErr := client.Encoding.ParseEnvelope(raw)
+	if protocolErr == nil {
+		protocolErr = handleEnvelope(hub, client, envelope)
+	}
+	if protocolErr == nil {
+		return
+	}
+	messageID := ""
+	if envelope != nil {
+		messageID = envelope.ID
+	}
+	client.Send(client.Encoding.EncodeError(messageID, protocolErr))
+}
 
-		// Broadcast the message to all connected clients for the document
-		documentWebSocket.Mutex.Lock()
-		for conn := range documentWebSocket.Connections {
-			// Skip broadcasting to the source connection
-			if conn == sourceConnection {
-				continue
+func handleEnvelope(hub *realtime.Hub, client *realtime.Client, envelope *dto.Envelope) *realtime.ProtocolError {
+	// Viewers stay apart from the editors, they can only check their session is alive
+	if client.Viewer && envelope.Type != dto.MessagePing {
+		return &realtime.ProtocolError{Code: dto.ErrorReadOnly, Message: "viewers only follow the document"}
+	}
+	switch envelope.Type {
+	case dto.MessagePing:
+		message, _ := client.Encoding.Encode(dto.MessagePong, envelope.ID, 0, nil)
+		client.Send(message)
+	case dto.MessagePresence:
+		presence, protocolErr := client.Encoding.ParsePresence(envelope)
+		if protocolErr != nil {
+			return protocolErr
+		}
+		presence.SessionID, presence.Email = client.SessionID, client.Email
+		message := realtime.NewOutgoing(dto.MessagePresence, "", 0, presence)
+		hub.Mutex.Lock()
+		broadcastMessage(hub, client, nil, message)
+		hub.Mutex.Unlock()
+	case dto.MessageEdit:
+		if !client.CanEdit.Load() {
+			return &realtime.ProtocolError{Code: dto.ErrorReadOnly, Message: "you can't edit this document"}
+		}
+		edit, protocolErr := client.Encoding.ParseEdit(envelope)
+		if protocolErr != nil {
+			return protocolErr
+		}
+		return applyEdit(hub, client, envelope.ID, envelope.Revision, edit)
+	case dto.MessageResume:
+		resume, protocolErr := client.Encoding.ParseResume(envelope)
+		if protocolErr != nil {
+			return protocolErr
+		}
+		return resumeSession(hub, client, envelope, resume)
+	}
+	return nil
+}
+
+// applyEdit saves an edit to the cached document under a new revision, acknowledges it to
+// its author when messageID is set and relays it to the other sessions. Edits made on an older
+// revision are transformed to follow the changes made since, legacy clients always edit the
+// latest one.
+func applyEdit(hub *realtime.Hub, client *realtime.Client, messageID string, revision int64, edit *dto.EditPayload) *realtime.ProtocolError {
+	hub.Mutex.Lock()
+	defer hub.Mutex.Unlock()
+
+	change, data := edit.Change, edit.Data
+	if client.Protocol == dto.ProtocolVersion && revision != hub.Changes.Revision() {
+		missed, ok := hub.Changes.Since(revision)
+		if !ok {
+			return errResyncRequired
+		}
+		// A document sent by the client misses the changes of the others
+		change = realtime.Rebase(missed, change)
+		data = nil
+	}
+	if data == nil {
+		composed := realtime.Compose(cachedDocumentData(hub.DocumentID), change)
+		data = &composed
+	}
+
+	var messageIDs []string
+	if messageID != "" {
+		messageIDs = []string{messageID}
+	}
+	newRevision, err := commitChange(hub, client, change, *data, messageIDs)
+	if err != nil {
+		client.Logger().Error("Error updating document cache", "error", err)
+		return &realtime.ProtocolError{Code: dto.ErrorInternal, Message: "edit could not be applied"}
+	}
+	if messageID != "" {
+		if ack, err := client.Encoding.Encode(dto.MessageAck, messageID, newRevision, nil); err == nil {
+			client.Send(ack)
+		}
+	}
+	return nil
+}
+
+// errResyncRequired rejects the messages of clients behind the changes the server still has
+var errResyncRequired = &realtime.ProtocolError{Code: dto.ErrorResyncRequired, Message: "the changes since this revision are gone, reload the document"}
+
+// resumeSession catches up a client coming back from a lost connection: it gets the changes
+// it missed in a sync message and its pending edits are applied on top of them
+func resumeSession(hub *realtime.Hub, client *realtime.Client, envelope *dto.Envelope, resume *dto.ResumePayload) *realtime.ProtocolError {
+	hub.Mutex.Lock()
+	defer hub.Mutex.Unlock()
+
+	missed, ok := hub.Changes.Since(envelope.Revision)
+	if !ok {
+		return errResyncRequired
+	}
+	catchUp, change, applied := realtime.CatchUp(missed, client.Email, resume.Pending)
+	acked := append([]string{}, applied...)
+	if pending := resume.Pending[len(applied):]; len(pending) > 0 {
+		if !client.CanEdit.Load() {
+			return &realtime.ProtocolError{Code: dto.ErrorReadOnly, Message: "you can't edit this document"}
+		}
+		messageIDs := make([]string, len(pending))
+		for i, edit := range pending {
+			messageIDs[i] = edit.ID
+		}
+		if len(change.Ops) > 0 {
+			data := realtime.Compose(cachedDocumentData(hub.DocumentID), change)
+			if _, err := commitChange(hub, client, change, data, messageIDs); err != nil {
+				client.Logger().Error("Error updating document cache", "error", err)
+				return &realtime.ProtocolError{Code: dto.ErrorInternal, Message: "pending edits could not be applied"}
 			}
+		}
+		acked = append(acked, messageIDs...)
+	}
 
-			data, err := json.Marshal(message.Change)
-			if err != nil {
-				log.Println("Error marshalling message:", err)
-				continue
+	message, err := client.Encoding.Encode(dto.MessageSync, envelope.ID, hub.Changes.Revision(), dto.SyncPayload{Change: catchUp, Acked: acked})
+	if err != nil {
+		client.Logger().Error("Error marshalling message", "error", err)
+		return &realtime.ProtocolError{Code: dto.ErrorInternal, Message: "session could not be resumed"}
+	}
+	client.Send(message)
+	return nil
+}
+
+// commitChange applies a change to the cached document, keeps it for the sessions that will
+// catch up and relays it to the other sessions. The caller holds the mutex of the hub.
+func commitChange(hub *realtime.Hub, client *realtime.Client, change dto.DocumentData, data dto.DocumentData, messageIDs []string) (int64, error) {
+	revision, err := updateDocumentCache(hub.DocumentID, client.Email, data)
+	if err != nil {
+		return 0, err
+	}
+	hub.Changes.Add(realtime.Change{Revision: revision, Delta: change, Author: client.Email, MessageIDs: messageIDs})
+	if hub.Audience != nil {
+		hub.Audience.Publish(revision, change)
+	}
+
+	// Sessions following the edits rebuild the document from the changes, legacy clients get
+	// the bare change
+	legacy, err := json.Marshal(change)
+	if err != nil {
+		return revision, err
+	}
+	relayed := dto.EditPayload{Change: change, Author: client.Email, SessionID: client.SessionID}
+	broadcastMessage(hub, client, legacy, realtime.NewOutgoing(dto.MessageEdit, "", revision, relayed))
+	return revision, nil
+}
+
+// broadcastPresence tells the other sessions speaking the realtime protocol that a client
+// joined or left, the caller holds the mutex of the hub
+func broadcastPresence(hub *realtime.Hub, client *realtime.Client, state string) {
+	if client.Protocol != dto.ProtocolVersion {
+		return
+	}
+	presence := dto.PresencePayload{SessionID: client.SessionID, Email: client.Email, State: state}
+	broadcastMessage(hub, client, nil, realtime.NewOutgoing(dto.MessagePresence, "", 0, presence))
+}
+
+// broadcastMessage queues a message for every session of a document but the source. Legacy
+// clients get the legacy message instead and nothing when it's nil. The caller holds the mutex
+// of the hub.
+func broadcastMessage(hub *realtime.Hub, source *realtime.Client, legacy []byte, message *realtime.Outgoing) {
+	sent := 0
+	hub.Broadcast(source, func(client *realtime.Client) []byte {
+		data := legacy
+		if client.Protocol == dto.ProtocolVersion {
+			data = message.In(client.Encoding)
+		}
+		if data != nil {
+			sent++
+		}
+		return data
+	})
+	metrics.MessagesSent.WithLabelValues(message.Type()).Add(float64(sent))
+}
+
+// notifyDocumentWebSockets sends a message to the sessions of a document speaking the realtime
+// protocol, legacy clients don't get notifications
+func notifyDocumentWebSockets(documentID string, messageType string, payload interface{}) {
+	hub, ok := documentHubs.Get(documentID)
+	if !ok {
+		return
+	}
+	hub.Mutex.Lock()
+	if hub.Changes == nil {
+		hub.Mutex.Unlock()
+		return
+	}
+	message := realtime.NewOutgoing(messageType, "", hub.Changes.Revision(), payload)
+	broadcastMessage(hub, nil, nil, message)
+	audience := hub.Audience
+	hub.Mutex.Unlock()
+
+	if audience != nil {
+		audience.Broadcast(message)
+	}
+}
+
+// clientCanEdit reports whether a connection may send edits: sessions in viewer mode,
+// viewers, commenters and read-only tokens receive the changes of others but can't edit
+func clientCanEdit(client *realtime.Client, role string) bool {
+	return !client.Viewer && service.RoleAllows(role, dto.RoleEditor) && client.Scope != dto.TokenScopeRead
+}
+
+// documentClients returns the sessions accepted by match, with their hubs
+func documentClients(match func(documentID string, client *realtime.Client) bool) ([]*realtime.Hub, []*realtime.Client) {
+	var hubs []*realtime.Hub
+	var clients []*realtime.Client
+	for _, hub := range documentHubs.Hubs() {
+		hub.Mutex.Lock()
+		for client := range hub.Clients {
+			if match(hub.DocumentID, client) {
+				hubs = append(hubs, hub)
+				clients = append(clients, client)
 			}
+		}
+		audience := hub.Audience
+		hub.Mutex.Unlock()
 
-			err = conn.WriteMessage(websocket.TextMessage, data)
-			if err != nil {
-				log.Println("Error writing message:", err)
-				conn.Close()
-				disconnectChannel <- conn // Signal disconnection to the cleanup goroutine
-				delete(documentWebSocket.Connections, conn)
+		if audience == nil {
+			continue
+		}
+		for _, viewer := range audience.Viewers() {
+			if match(hub.DocumentID, viewer) {
+				hubs = append(hubs, hub)
+				clients = append(clients, viewer)
 			}
 		}
-		documentWebSocket.Mutex.Unlock()
 	}
-	close(disconnectChannel)
+	return hubs, clients
+}
+
+// refreshWebSocketAccess re-evaluates the role of the open connections accepted by match,
+// closing those that lost access and toggling editing for the others. It is called whenever
+// an ACL or a group membership changes so that the change applies to live sessions too.
+func refreshWebSocketAccess(documentController controller.DocumentController, match func(documentID string, client *realtime.Client) bool) {
+	hubs, clients := documentClients(func(documentID string, client *realtime.Client) bool {
+		// Share link sessions get their access from the link, not from the ACL
+		return client.ShareLinkID == "" && match(documentID, client)
+	})
+
+	for i, client := range clients {
+		role, err := documentController.GetRole(context.Background(), hubs[i].DocumentID, client.Email)
+		if err != nil {
+			client.Logger().Error("Error refreshing session access", "error", err)
+			continue
+		}
+		if role == "" {
+			// The read loop notices the closed connection and cleans up after it
+			client.Close()
+			continue
+		}
+		client.CanEdit.Store(clientCanEdit(client, role))
+		notifyPermissionChange(hubs[i], client, role)
+	}
+}
+
+// notifyPermissionChange records the new role of a session, telling the client when it speaks
+// the realtime protocol and the role changed
+func notifyPermissionChange(hub *realtime.Hub, client *realtime.Client, role string) {
+	hub.Mutex.Lock()
+	defer hub.Mutex.Unlock()
+	if client.Role == role {
+		return
+	}
+	client.Role = role
+	if client.Protocol != dto.ProtocolVersion {
+		return
+	}
+	payload := dto.PermissionPayload{Role: role, CanEdit: client.CanEdit.Load()}
+	message, err := client.Encoding.Encode(dto.MessagePermissionChange, "", 0, payload)
+	if err != nil {
+		client.Logger().Error("Error marshalling message", "error", err)
+		return
+	}
+	client.Send(message)
+}
+
+// refreshDocumentAccess applies an access list change to the cache and the open sessions,
+// documents without an ID come from failed requests and are ignored
+func refreshDocumentAccess(documentController controller.DocumentController, document dto.Document) {
+	if document.ID == "" {
+		return
+	}
+	updateDocumentCacheAttribute(document.ID, documentController, dto.Access{ID: document.ID, ACL: document.ACL})
+	refreshDocumentWebSockets(documentController, document.ID)
+}
+
+// reloadDocumentAccess reloads the access of documents whose folders changed into the cache
+// and applies it to their open sessions
+func reloadDocumentAccess(ctx context.Context, documentController controller.DocumentController, documentIDs []string) {
+	for _, documentID := range documentIDs {
+		cachedDocument, ok := documentCache.Load(documentID)
+		if !ok {
+			continue
+		}
+		document, err := documentController.GetDocumentByID(ctx, documentID)
+		if err != nil {
+			slog.Error("Error reloading document access", "document_id", documentID, "error", err)
+			continue
+		}
+		// The sessions of the document read its access under the lock of its hub
+		documentHubs.Locked(documentID, func(hub *realtime.Hub) {
+			cached := cachedDocument.(*dto.Document)
+			cached.Author = document.Author
+			cached.ACL = document.ACL
+			cached.FolderID = document.FolderID
+			cached.InheritedACL = document.InheritedACL
+			cached.Tags = document.Tags
+		})
+		refreshDocumentWebSockets(documentController, documentID)
+	}
+}
+
+// refreshUserWebSockets applies access changes of the given users to all their open sessions
+func refreshUserWebSockets(documentController controller.DocumentController, emails []string) {
+	if len(emails) == 0 {
+		return
+	}
+	refreshWebSocketAccess(documentController, func(documentID string, client *realtime.Client) bool {
+		for _, email := range emails {
+			if client.Email == email {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// refreshDocumentWebSockets applies a change of the document's ACL to its open sessions
+func refreshDocumentWebSockets(documentController controller.DocumentController, changedDocumentID string) {
+	if changedDocumentID == "" {
+		return
+	}
+	refreshWebSocketAccess(documentController, func(documentID string, client *realtime.Client) bool {
+		return documentID == changedDocumentID
+	})
+}
+
+// closeShareLinkWebSockets ends the sessions opened through a revoked share link
+func closeShareLinkWebSockets(linkID string) {
+	if linkID == "" {
+		return
+	}
+	_, clients := documentClients(func(documentID string, client *realtime.Client) bool {
+		return client.ShareLinkID == linkID
+	})
+	for _, client := range clients {
+		client.Close()
+	}
 }
 
-func initializeDocumentCache(ctx *gin.Context, documentController controller.DocumentController) (*dto.Document, error) {
-	documentID := ctx.Param("id")
+// closeDocumentWebSockets ends all the sessions of a document, telling the clients why
+func closeDocumentWebSockets(documentID string, reason string) {
+	_, clients := documentClients(func(clientDocumentID string, client *realtime.Client) bool {
+		return clientDocumentID == documentID
+	})
+	for _, client := range clients {
+		// The read loop notices the closed connection and cleans up after it
+		client.CloseWith(documentDeletedCloseCode, reason)
+	}
+}
+
+func initializeDocumentCache(ctx context.Context, documentID string, documentController controller.DocumentController) (*dto.Document, error) {
 	var document *dto.Document
 
 	// Check if the document is already in the cache
 	if cachedDocument, ok := documentCache.Load(documentID); !ok {
 		// Fetch the document from the database
-		document, err := documentController.GetOneDocument(ctx)
+		fetchedDocument, err := documentController.GetDocumentByID(ctx, documentID)
 		if err != nil {
-			fmt.Println("Error getting document:", err)
+			slog.Info("Error getting document", "document_id", documentID, "error", err)
 			return nil, err
 		}
 
 		// Store the document in the cache
-		documentCache.Store(documentID, document)
-		ctx.JSON(http.StatusOK, document)
+		documentCache.Store(documentID, fetchedDocument)
+		document = fetchedDocument
 	} else {
 		// If document is already in cache, retrieve it
 		document = cachedDocument.(*dto.Document)
@@ -336,23 +1379,55 @@ func initializeDocumentCache(ctx *gin.Context, documentController controller.Doc
 	return document, nil
 }
 
-func updateDocumentCache(documentID string, documentController controller.DocumentController, newData dto.DocumentData) error {
+// updateDocumentCache applies an edit to a cached document and returns the revision it got,
+// callers hold the mutex of the document's hub so that revisions follow each other
+func updateDocumentCache(documentID string, editor string, newData dto.DocumentData) (int64, error) {
 	cachedDocument, ok := documentCache.Load(documentID)
 	if !ok {
-		return fmt.Errorf("document not found in cache")
+		return 0, fmt.Errorf("document not found in cache")
 	}
 
 	document := cachedDocument.(*dto.Document)
 	document.Data = newData
+	document.Revision++
 
 	// Update the document in the cache
 	documentCache.Store(documentID, document)
-	return nil
+	dirtyDocuments.Store(documentID, editor)
+	return document.Revision, nil
+}
+
+// countEntries counts the entries of a map of the cache
+func countEntries(entries *sync.Map) int {
+	count := 0
+	entries.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// snapshotDocument copies a cached document under the lock of its hub, which edits and
+// access changes hold while they change it
+func snapshotDocument(document *dto.Document) dto.Document {
+	var snapshot dto.Document
+	documentHubs.Locked(document.ID, func(hub *realtime.Hub) {
+		snapshot = *document
+	})
+	return snapshot
+}
+
+// cachedDocumentData is the body of a cached document
+func cachedDocumentData(documentID string) dto.DocumentData {
+	if cachedDocument, ok := documentCache.Load(documentID); ok {
+		return cachedDocument.(*dto.Document).Data
+	}
+	return dto.DocumentData{}
 }
 
 func updateDatabaseWithCache(documentController controller.DocumentController) {
 	// Create a ticker that ticks every specified duration
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(cacheFlushInterval)
 
 	// Run a goroutine to perform the periodic update
 	go func() {
@@ -362,57 +1437,152 @@ func updateDatabaseWithCache(documentController controller.DocumentController) {
 				// Perform the database update using the cache
 				err := syncDatabaseWithCache(documentController)
 				if err != nil {
-					fmt.Println("Error updating database with cache:", err)
+					slog.Error("Error updating database with cache", "error", err)
 				}
 			}
 		}
 	}()
 }
 
+// purgeTrash deletes for good the documents left in the trash past their retention period,
+// checking every hour
+func purgeTrash(documentService service.DocumentService) {
+	ticker := time.NewTicker(time.Hour)
+
+	go func() {
+		for range ticker.C {
+			documentIDs, err := documentService.PurgeTrash(time.Now().UTC())
+			if err != nil {
+				slog.Error("Error purging trash", "error", err)
+				continue
+			}
+			for _, documentID := range documentIDs {
+				evictDocument(documentID)
+			}
+			if len(documentIDs) > 0 {
+				slog.Info("Purged documents from the trash", "count", len(documentIDs))
+			}
+		}
+	}()
+}
+
 func syncDatabaseWithCache(documentController controller.DocumentController) error {
-	// Iterate over the cache and update the database with each entry
-	documentCache.Range(func(key, value interface{}) bool {
+	started := time.Now()
+	// Each flush is a trace of its own, with a span per document written
+	ctx, span := tracing.Tracer.Start(context.Background(), "syncDatabaseWithCache")
+	defer func() {
+		metrics.CacheFlushDuration.Observe(time.Since(started).Seconds())
+		span.End()
+	}()
+
+	// Only the documents edited since the last sync are written, so that their modification
+	// time stays meaningful
+	failed := false
+	dirtyDocuments.Range(func(key, value interface{}) bool {
 		documentID := key.(string)
-		cachedDocument := value.(*dto.Document)
 
 		// Update the database with the cached document
-		err := documentController.UpdateDocument(documentID, cachedDocument.Data)
+		err := flushDocument(ctx, documentID, documentController)
 		if err != nil {
 			// Log or handle the error accordingly
-			fmt.Printf("Error updating database for document %s: %v\n", documentID, err)
+			slog.Error("Error updating database for document", "document_id", documentID, "error", err)
+			failed = true
 		}
-		// documentCache = sync.Map{}
 		return true
 	})
 
+	// Edits made since the flush started wait for the next one
+	if !failed {
+		lastCacheFlush.Store(started.UnixNano())
+	}
+	return nil
+}
+
+// flushDocument writes a cached document to the database if it was edited since it was
+// last saved, edits made while it's written are saved by the next flush
+func flushDocument(ctx context.Context, documentID string, documentController controller.DocumentController) error {
+	editor, dirty := dirtyDocuments.LoadAndDelete(documentID)
+	if !dirty {
+		return nil
+	}
+	cachedDocument, ok := documentCache.Load(documentID)
+	if !ok {
+		return nil
+	}
+	// Edits change the cached document under the lock of its hub
+	var data dto.DocumentData
+	var revision int64
+	documentHubs.Locked(documentID, func(hub *realtime.Hub) {
+		document := cachedDocument.(*dto.Document)
+		data, revision = document.Data, document.Revision
+	})
+	ctx, span := tracing.Tracer.Start(ctx, "flushDocument", trace.WithAttributes(
+		attribute.String("godoc.document_id", documentID),
+		attribute.Int64("godoc.revision", revision),
+	))
+	defer span.End()
+	if err := documentController.UpdateDocument(ctx, documentID, data, revision, editor.(string)); err != nil {
+		dirtyDocuments.LoadOrStore(documentID, editor)
+		metrics.CacheFlushErrors.Inc()
+		tracing.Fail(span, err)
+		return err
+	}
 	return nil
 }
 
+// closeTrashedDocument ends the sessions of a document moved to the trash and drops it from
+// the cache, saving the last edits first so that a restored document is complete
+func closeTrashedDocument(ctx context.Context, documentID string, documentController controller.DocumentController) {
+	closeDocumentWebSockets(documentID, "Document deleted")
+	if err := flushDocument(ctx, documentID, documentController); err != nil {
+		slog.Error("Error updating database for document", "document_id", documentID, "error", err)
+	}
+	evictDocument(documentID)
+}
+
+// evictDocument drops a deleted document from the cache without saving it
+func evictDocument(documentID string) {
+	dirtyDocuments.Delete(documentID)
+	documentCache.Delete(documentID)
+}
+
 func updateDocumentCacheAttribute(documentID string, documentController controller.DocumentController, newData dto.Access) error {
-	fmt.Print("Updating document cache attribute\n")
+	slog.Debug("Updating document cache attribute", "document_id", documentID)
 	cachedDocument, ok := documentCache.Load(documentID)
 	if !ok {
 		return fmt.Errorf("document not found in cache")
 	}
 
 	document := cachedDocument.(*dto.Document)
-	document.ReadAccess = newData.ReadAccess
-	document.WriteAccess = newData.WriteAccess
+	documentHubs.Locked(documentID, func(hub *realtime.Hub) {
+		document.ACL = newData.ACL
+	})
 
 	// Update the document in the cache
 	documentCache.Store(documentID, document)
 	return nil
 }
 
+// updateDocumentTagsCacheAttribute keeps the tags of a cached document in step with the database
+func updateDocumentTagsCacheAttribute(documentID string, tags []string) {
+	if cachedDocument, ok := documentCache.Load(documentID); ok {
+		documentHubs.Locked(documentID, func(hub *realtime.Hub) {
+			cachedDocument.(*dto.Document).Tags = tags
+		})
+	}
+}
+
 func updateDocumentTitleCacheAttribute(documentID string, newTitle string) error {
-	fmt.Print("Updating document title cache attribute\n", documentID, newTitle)
+	slog.Debug("Updating document title cache attribute", "document_id", documentID)
 	cachedDocument, ok := documentCache.Load(documentID)
 	if !ok {
 		return fmt.Errorf("document not found in cache")
 	}
 
 	document := cachedDocument.(*dto.Document)
-	document.Title = newTitle
+	documentHubs.Locked(documentID, func(hub *realtime.Hub) {
+		document.Title = newTitle
+	})
 
 	// Update the document in the cache
 	documentCache.Store(documentID, document)
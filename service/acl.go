@@ -0,0 +1,117 @@
+package service
+
+import "github.com/khallihub/godoc/dto"
+
+var roleRanks = map[string]int{
+	dto.RoleViewer:    1,
+	dto.RoleCommenter: 2,
+	dto.RoleEditor:    3,
+	dto.RoleOwner:     4,
+}
+
+// ValidRole reports whether role is one of the known document roles
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAllows reports whether role grants at least the privileges of required
+func RoleAllows(role string, required string) bool {
+	return ValidRole(role) && roleRanks[role] >= roleRanks[required]
+}
+
+// RolesAtLeast lists the roles granting at least the privileges of required, for use in queries
+func RolesAtLeast(required string) []string {
+	roles := []string{}
+	for role := range roleRanks {
+		if RoleAllows(role, required) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// EffectiveRole returns the most privileged role any of the principals holds in the ACL,
+// or an empty string when they have no access at all. A user is represented by their
+// email followed by the principals of the groups they belong to.
+func EffectiveRole(acl []dto.ACLEntry, principals ...string) string {
+	role := ""
+	for _, entry := range acl {
+		if roleRanks[entry.Role] > roleRanks[role] && contains(principals, entry.Principal) {
+			role = entry.Role
+		}
+	}
+	return role
+}
+
+// CountOwners returns the number of distinct owners in the ACL
+func CountOwners(acl []dto.ACLEntry) int {
+	owners := map[string]bool{}
+	for _, entry := range acl {
+		if entry.Role == dto.RoleOwner {
+			owners[entry.Principal] = true
+		}
+	}
+	return len(owners)
+}
+
+// LegacyACL converts the former author/readAccess/writeAccess fields into ACL entries
+func LegacyACL(author string, readAccess []string, writeAccess []string) []dto.ACLEntry {
+	acl := []dto.ACLEntry{}
+	seen := map[string]bool{}
+	add := func(principal string, role string) {
+		if principal == "" || seen[principal] {
+			return
+		}
+		seen[principal] = true
+		acl = append(acl, dto.ACLEntry{Principal: principal, Role: role})
+	}
+	add(author, dto.RoleOwner)
+	for _, principal := range writeAccess {
+		add(principal, dto.RoleEditor)
+	}
+	for _, principal := range readAccess {
+		add(principal, dto.RoleViewer)
+	}
+	return acl
+}
+
+// MergeACL combines access lists, keeping the most privileged role of every principal in the
+// order the principals first appear
+func MergeACL(acls ...[]dto.ACLEntry) []dto.ACLEntry {
+	merged := []dto.ACLEntry{}
+	index := map[string]int{}
+	for _, acl := range acls {
+		for _, entry := range acl {
+			i, ok := index[entry.Principal]
+			if !ok {
+				index[entry.Principal] = len(merged)
+				merged = append(merged, entry)
+				continue
+			}
+			if roleRanks[entry.Role] > roleRanks[merged[i].Role] {
+				merged[i].Role = entry.Role
+			}
+		}
+	}
+	return merged
+}
+
+// InheritedACL is the access a folder passes on to the documents in it. Folder owners manage
+// the folder but only edit its documents, ownership of a document is never inherited.
+func InheritedACL(acl []dto.ACLEntry) []dto.ACLEntry {
+	inherited := make([]dto.ACLEntry, len(acl))
+	for i, entry := range acl {
+		inherited[i] = entry
+		if entry.Role == dto.RoleOwner {
+			inherited[i].Role = dto.RoleEditor
+		}
+	}
+	return inherited
+}
+
+// DocumentRole returns the role of the principals on a document, from its own access list or
+// the one inherited from its folders
+func DocumentRole(document *dto.Document, principals ...string) string {
+	return EffectiveRole(MergeACL(document.ACL, document.InheritedACL), principals...)
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrBulkPermissions         = errors.New("insufficient permissions on the document")
+	ErrTransactionsUnsupported = errors.New("the database does not support transactions")
+)
+
+// bulkErrors are the errors reported as they are for a document of a bulk request, others are
+// logged and reported as internal errors
+var bulkErrors = []error{
+	ErrDocumentNotFound, ErrBulkPermissions, ErrACLChanged, ErrLastOwner,
+	ErrPrincipalNotFound, ErrFolderNotFound, ErrFolderPermissions, ErrNotDirectOwner,
+}
+
+type BulkService interface {
+	Apply(ctx context.Context, email string, admin bool, request dto.BulkRequest, retention time.Duration) (*dto.BulkResult, error)
+}
+
+type bulkService struct {
+	client    *mongo.Client
+	documents *mongo.Collection // MongoDB collection
+	folders   *mongo.Collection // MongoDB collection holding the folders documents are moved to
+	groups    *mongo.Collection // MongoDB collection holding the groups documents can be shared with
+	users     *mongo.Collection // MongoDB collection holding the users documents can be shared with
+
+	// transactions tells whether the deployment supports transactions, checked on first use
+	transactions     bool
+	transactionsOnce sync.Once
+}
+
+func NewBulkService(client *mongo.Client, databaseName, collectionName string) BulkService {
+	database := client.Database(databaseName)
+	return &bulkService{
+		client:    client,
+		documents: database.Collection(collectionName),
+		folders:   database.Collection("folders"),
+		groups:    database.Collection("groups"),
+		users:     database.Collection("users"),
+	}
+}
+
+// bulkChange is a bulk operation with its arguments checked once for all the documents
+type bulkChange struct {
+	request    dto.BulkRequest
+	email      string
+	admin      bool
+	principals []string
+	retention  time.Duration
+	// folder is the destination of a move, nil for the root
+	folder *dto.Folder
+}
+
+// Apply runs a bulk operation on every document of the request and reports the outcome of
+// each. Owners act on their documents, administrators on any document. Where the database
+// supports them every document is changed in its own transaction, or all of them in a single
+// one when the request is atomic. The operation runs in ctx, the context of the request.
+func (service *bulkService) Apply(ctx context.Context, email string, admin bool, request dto.BulkRequest, retention time.Duration) (*dto.BulkResult, error) {
+	change, err := service.prepare(ctx, email, admin, request, retention)
+	if err != nil {
+		return nil, err
+	}
+	transactional := service.supportsTransactions(ctx)
+	if request.Atomic && !transactional {
+		return nil, ErrTransactionsUnsupported
+	}
+
+	result := &dto.BulkResult{
+		Operation:     request.Operation,
+		Transactional: transactional,
+		Results:       make([]dto.BulkItemResult, len(request.DocumentIDs)),
+	}
+	if request.Atomic {
+		err = service.applyAtomically(ctx, change, result)
+	} else {
+		for i, documentID := range request.DocumentIDs {
+			result.Results[i] = itemResult(documentID, service.applyOne(ctx, change, documentID, transactional))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range result.Results {
+		if item.Status == dto.BulkSucceeded {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+// prepare checks the arguments shared by all the documents of the request
+func (service *bulkService) prepare(ctx context.Context, email string, admin bool, request dto.BulkRequest, retention time.Duration) (*bulkChange, error) {
+	principals, err := userPrincipals(ctx, service.groups, email)
+	if err != nil {
+		return nil, err
+	}
+	change := &bulkChange{request: request, email: email, admin: admin, principals: principals, retention: retention}
+	if change.request.From == "" {
+		change.request.From = email
+	}
+	// Only administrators hand over the documents of somebody else
+	if request.Operation == dto.BulkTransfer && change.request.From != email && !admin {
+		return nil, ErrBulkPermissions
+	}
+
+	switch request.Operation {
+	case dto.BulkMove:
+		if request.FolderID == "" {
+			break
+		}
+		objectID, err := primitive.ObjectIDFromHex(request.FolderID)
+		if err != nil {
+			return nil, ErrFolderNotFound
+		}
+		var folder dto.Folder
+		err = service.folders.FindOne(ctx, bson.M{"_id": objectID}).Decode(&folder)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrFolderNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		role := folderRole(&folder, principals)
+		if role == "" && !admin {
+			return nil, ErrFolderNotFound
+		}
+		if !RoleAllows(role, dto.RoleEditor) && !admin {
+			return nil, ErrFolderPermissions
+		}
+		change.folder = &folder
+	case dto.BulkTransfer, dto.BulkShare:
+		principal := request.To
+		if request.Operation == dto.BulkShare {
+			principal = request.Principal
+		}
+		exists, err := principalExists(ctx, service.users, service.groups, principal)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrPrincipalNotFound
+		}
+	}
+	return change, nil
+}
+
+// applyOne changes a single document, in a transaction when the database supports them
+func (service *bulkService) applyOne(ctx context.Context, change *bulkChange, documentID string, transactional bool) error {
+	if !transactional {
+		return service.applyDocument(ctx, change, documentID)
+	}
+	session, err := service.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, service.applyDocument(sessionContext, change, documentID)
+	})
+	return err
+}
+
+// applyAtomically changes all the documents in one transaction, which is aborted by the first
+// document that fails. The others are then reported as rolled back or skipped.
+func (service *bulkService) applyAtomically(ctx context.Context, change *bulkChange, result *dto.BulkResult) error {
+	session, err := service.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	documentIDs := change.request.DocumentIDs
+	var failed error
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		// The transaction may be retried, every attempt starts over
+		failed = nil
+		for i, documentID := range documentIDs {
+			if err := service.applyDocument(sessionContext, change, documentID); err != nil {
+				failed = err
+				result.Results[i] = itemResult(documentID, err)
+				for j := range documentIDs[:i] {
+					result.Results[j] = dto.BulkItemResult{DocumentID: documentIDs[j], Status: dto.BulkRolledBack}
+				}
+				for j := i + 1; j < len(documentIDs); j++ {
+					result.Results[j] = dto.BulkItemResult{DocumentID: documentIDs[j], Status: dto.BulkSkipped}
+				}
+				return nil, err
+			}
+			result.Results[i] = itemResult(documentID, nil)
+		}
+		return nil, nil
+	})
+	if failed != nil && errors.Is(err, failed) {
+		return nil
+	}
+	return err
+}
+
+// applyDocument checks the caller's role on a document and applies the change to it
+func (service *bulkService) applyDocument(ctx context.Context, change *bulkChange, documentID string) error {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return ErrDocumentNotFound
+	}
+	var document struct {
+		dto.Document `bson:",inline"`
+		DeletedAt    *time.Time `bson:"deletedAt"`
+	}
+	projection := options.FindOne().SetProjection(bson.M{"acl": 1, "inheritedAcl": 1, "author": 1, "deletedAt": 1})
+	err = service.documents.FindOne(ctx, bson.M{"_id": objectID}, projection).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrDocumentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// Restoring is the only operation on documents in the trash
+	trashed := document.DeletedAt != nil
+	if trashed != (change.request.Operation == dto.BulkRestore) {
+		return ErrDocumentNotFound
+	}
+	role := DocumentRole(&document.Document, change.principals...)
+	if role == "" && !change.admin {
+		return ErrDocumentNotFound
+	}
+	required := dto.RoleOwner
+	if change.request.Operation == dto.BulkRetag {
+		required = dto.RoleEditor
+	}
+	if !RoleAllows(role, required) && !change.admin {
+		return ErrBulkPermissions
+	}
+
+	filter := bson.M{"_id": objectID, "deletedAt": notTrashed}
+	var update interface{}
+	switch change.request.Operation {
+	case dto.BulkDelete:
+		now := time.Now().UTC()
+		update = bson.M{"$set": bson.M{"deletedAt": now, "deletedBy": change.email, "purgeAt": now.Add(change.retention)}}
+	case dto.BulkRestore:
+		filter["deletedAt"] = bson.M{"$exists": true}
+		update = bson.M{"$unset": bson.M{"deletedAt": "", "deletedBy": "", "purgeAt": ""}}
+	case dto.BulkMove:
+		update = bson.M{"$unset": bson.M{"folderId": "", "inheritedAcl": ""}}
+		if change.folder != nil {
+			update = bson.M{"$set": bson.M{
+				"folderId":     change.folder.ID,
+				"inheritedAcl": InheritedACL(MergeACL(change.folder.ACL, change.folder.InheritedACL)),
+			}}
+		}
+	case dto.BulkRetag:
+		update = bson.A{editSet("tags", dto.LabelUpdate{Add: change.request.Add, Remove: change.request.Remove})}
+	case dto.BulkTransfer:
+		if EffectiveRole(document.ACL, change.request.From) != dto.RoleOwner {
+			return ErrNotDirectOwner
+		}
+		// Only apply the change if nobody else modified the ACL in the meantime
+		filter["acl"] = document.ACL
+		acl := transferACL(document.ACL, change.request.From, change.request.To)
+		update = bson.M{"$set": bson.M{"acl": acl, "author": change.request.To}}
+	case dto.BulkShare:
+		acl := sharedACL(document.ACL, change.request.Principal, change.request.Role)
+		if CountOwners(acl) == 0 {
+			return ErrLastOwner
+		}
+		filter["acl"] = document.ACL
+		update = bson.M{"$set": bson.M{"acl": acl}}
+	}
+
+	result, err := service.documents.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 && filter["acl"] != nil {
+		return ErrACLChanged
+	}
+	if result.MatchedCount == 0 {
+		return ErrDocumentNotFound
+	}
+	return nil
+}
+
+// supportsTransactions reports whether the deployment is a replica set or a sharded cluster,
+// the only ones where MongoDB runs transactions
+func (service *bulkService) supportsTransactions(ctx context.Context) bool {
+	service.transactionsOnce.Do(func() {
+		var hello bson.M
+		err := service.client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+		if err != nil {
+			slog.Error("Error checking transaction support", "error", err)
+			return
+		}
+		service.transactions = hello["setName"] != nil || hello["msg"] == "isdbgrid"
+	})
+	return service.transactions
+}
+
+// sharedACL sets the role of a principal on an access list, adding it when it isn't on it
+// yet. An empty role removes the principal.
+func sharedACL(current []dto.ACLEntry, principal string, role string) []dto.ACLEntry {
+	acl := []dto.ACLEntry{}
+	found := false
+	for _, entry := range current {
+		if entry.Principal != principal {
+			acl = append(acl, entry)
+			continue
+		}
+		found = true
+		if role != "" {
+			acl = append(acl, dto.ACLEntry{Principal: principal, Role: role})
+		}
+	}
+	if !found && role != "" {
+		acl = append(acl, dto.ACLEntry{Principal: principal, Role: role})
+	}
+	return acl
+}
+
+func itemResult(documentID string, err error) dto.BulkItemResult {
+	if err == nil {
+		return dto.BulkItemResult{DocumentID: documentID, Status: dto.BulkSucceeded}
+	}
+	for _, known := range bulkErrors {
+		if errors.Is(err, known) {
+			return dto.BulkItemResult{DocumentID: documentID, Status: dto.BulkFailed, Error: known.Error()}
+		}
+	}
+	slog.Error("Error applying bulk operation", "document_id", documentID, "error", err)
+	return dto.BulkItemResult{DocumentID: documentID, Status: dto.BulkFailed, Error: "internal error"}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultPageSize is the number of documents in a page when the query sets no limit
+const defaultPageSize = 50
+
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// documentSorts maps the sort orders of the list to the fields they sort on
+var documentSorts = map[string]string{
+	dto.SortTitle:    "title",
+	dto.SortCreated:  "createdAt",
+	dto.SortModified: "updatedAt",
+	dto.SortOpened:   "lastOpenedAt",
+}
+
+// neverOpened sorts the documents a user never opened before all the others
+var neverOpened = time.Unix(0, 0).UTC()
+
+// pageCursor is the position after the last document of a page: its sort value and its ID,
+// which breaks ties between documents with the same value
+type pageCursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"id"`
+}
+
+// ListDocuments returns a page of the documents the user can access
+func (service *documentService) ListDocuments(email string, query dto.DocumentListQuery) (*dto.DocumentPage, error) {
+	principals, err := service.Principals(email)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := []bson.M{accessFilter(principals)}
+	owned := bson.M{"acl": bson.M{"$elemMatch": bson.M{"principal": bson.M{"$in": principals}, "role": dto.RoleOwner}}}
+	switch query.Filter {
+	case dto.ListOwned:
+		conditions = append(conditions, owned)
+	case dto.ListShared:
+		conditions = append(conditions, bson.M{"$nor": []bson.M{owned}})
+	}
+	if query.Collaborator != "" {
+		conditions = append(conditions, bson.M{"acl.principal": query.Collaborator})
+	}
+	switch query.Folder {
+	case "":
+	case dto.RootFolder:
+		// Documents in folders the user can't see show up at their root
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{"folderId": bson.M{"$exists": false}},
+			{"inheritedAcl.principal": bson.M{"$nin": principals}},
+		}})
+	default:
+		conditions = append(conditions, bson.M{"folderId": query.Folder})
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, bson.M{"tags": query.Tag})
+	}
+	labeled, err := labeledFilter(service.labels, email, query.Starred, query.Label)
+	if err != nil {
+		return nil, err
+	}
+	if labeled != nil {
+		conditions = append(conditions, labeled)
+	}
+
+	field, ok := documentSorts[query.Sort]
+	if !ok {
+		field = documentSorts[dto.SortModified]
+	}
+	// Most recently modified first unless asked otherwise, titles A to Z
+	descending := query.Order == "desc" || (query.Order == "" && query.Sort != dto.SortTitle)
+	direction, comparison := 1, "$gt"
+	if descending {
+		direction, comparison = -1, "$lt"
+	}
+	var after bson.M
+	if query.Cursor != "" {
+		after, err = cursorCondition(query.Cursor, field, comparison)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$and": conditions}}},
+		// The user's own entry of the opens, other users' are not theirs to see
+		{{Key: "$set", Value: bson.M{"lastOpenedAt": bson.M{"$ifNull": bson.A{
+			bson.M{"$max": bson.M{"$map": bson.M{
+				"input": bson.M{"$filter": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$opens", bson.A{}}},
+					"cond":  bson.M{"$eq": bson.A{"$$this.email", email}},
+				}},
+				"in": "$$this.at",
+			}}},
+			neverOpened,
+		}}}}},
+	}
+	if after != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: after}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: field, Value: direction}, {Key: "_id", Value: direction}}}},
+		// One more than asked tells whether there is a next page
+		bson.D{{Key: "$limit", Value: limit + 1}},
+		bson.D{{Key: "$project", Value: bson.M{"data": 0, "body": 0, "opens": 0}}},
+	)
+	cursor, err := service.collection.Aggregate(service.context(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(service.context())
+
+	page := &dto.DocumentPage{Documents: []*dto.DocumentListItem{}}
+	for cursor.Next(service.context()) {
+		if int64(len(page.Documents)) == limit {
+			last := page.Documents[len(page.Documents)-1]
+			page.NextCursor, err = encodeCursor(last, field)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		var document struct {
+			dto.DocumentListItem `bson:",inline"`
+			ACL                  []dto.ACLEntry `bson:"acl"`
+			InheritedACL         []dto.ACLEntry `bson:"inheritedAcl"`
+			Text                 string         `bson:"text"`
+		}
+		if err := cursor.Decode(&document); err != nil {
+			return nil, err
+		}
+		item := document.DocumentListItem
+		if item.LastOpenedAt != nil && item.LastOpenedAt.Equal(neverOpened) {
+			item.LastOpenedAt = nil
+		}
+		item.Role = EffectiveRole(MergeACL(document.ACL, document.InheritedACL), principals...)
+		item.Snippet = Snippet(document.Text, nil)
+		if item.Tags == nil {
+			item.Tags = []string{}
+		}
+		page.Documents = append(page.Documents, &item)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(page.Documents))
+	for i, item := range page.Documents {
+		ids[i] = item.ID
+	}
+	labels, err := userLabels(service.labels, email, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range page.Documents {
+		item.Starred, item.Labels = labels[item.ID].Starred, labels[item.ID].Labels
+	}
+	return page, nil
+}
+
+func encodeCursor(item *dto.DocumentListItem, field string) (string, error) {
+	var value interface{}
+	switch field {
+	case "title":
+		value = item.Title
+	case "createdAt":
+		value = item.CreatedAt
+	case "updatedAt":
+		value = item.UpdatedAt
+	case "lastOpenedAt":
+		value = neverOpened
+		if item.LastOpenedAt != nil {
+			value = *item.LastOpenedAt
+		}
+	}
+	encodedValue, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(pageCursor{Value: encodedValue, ID: item.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// cursorCondition matches the documents after the cursor in the sort order
+func cursorCondition(encoded string, field string, comparison string) (bson.M, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var position pageCursor
+	if err := json.Unmarshal(raw, &position); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	objectID, err := primitive.ObjectIDFromHex(position.ID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var value interface{}
+	if field == "title" {
+		var title string
+		err = json.Unmarshal(position.Value, &title)
+		value = title
+	} else {
+		var at time.Time
+		err = json.Unmarshal(position.Value, &at)
+		value = at
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return bson.M{"$or": []bson.M{
+		{field: bson.M{comparison: value}},
+		{field: value, "_id": bson.M{comparison: objectID}},
+	}}, nil
+}
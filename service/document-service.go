@@ -2,7 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 	// "errors"
 	// "fmt"
 	"github.com/khallihub/godoc/dto"
@@ -10,99 +14,321 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrDocumentNotFound   = errors.New("document not found")
+	ErrACLChanged         = errors.New("document access changed concurrently")
+	ErrPrincipalNotFound  = errors.New("no user or group with that name")
+	ErrCollaboratorExists = errors.New("already a collaborator on the document")
+	ErrNotCollaborator    = errors.New("not a collaborator on the document")
+	ErrLastOwner          = errors.New("a document needs at least one owner")
+	ErrNotDirectOwner     = errors.New("only owners named on the document can transfer it")
 )
 
 type DocumentService interface {
-	GetAllDocuments(email dto.Email) ([]*dto.Document, error)
-	SearchDocuments(email string, searchQuery string) ([]*dto.Document, error)
-	CreateDocument(author string, title string, body interface{}, readAccess []string, writeAccess []string) (string, error)
-	UpdateDocument(documentID string, body dto.DocumentData) error
+	// WithContext returns the service running its MongoDB calls in ctx, which carries the span
+	// they are traced in
+	WithContext(ctx context.Context) DocumentService
+	ListDocuments(email string, query dto.DocumentListQuery) (*dto.DocumentPage, error)
+	SearchDocuments(email string, search dto.Search) ([]*dto.SearchResult, error)
+	CreateDocument(author string, title string, body interface{}, acl []dto.ACLEntry) (string, error)
+	UpdateDocument(documentID string, body dto.DocumentData, revision int64, editor string) error
+	RecordOpen(documentID string, email string) error
 	GetDocumentByID(documentID string) (*dto.Document, error)
+	GetRole(documentID string, email string) (string, error)
+	Principals(email string) ([]string, error)
 	UpdateTitle(documentID string, title string) (string, error)
+	UpdateTags(update dto.LabelUpdate) ([]string, error)
 	UpdateCollaborators(documentID string, collaborators dto.Access) (dto.Document, error)
-	DeleteDocument(documentID string) (bool, error)
+	UnknownPrincipal(acl []dto.ACLEntry) (string, error)
+	AddCollaborator(documentID string, entry dto.ACLEntry) (dto.Document, error)
+	ChangeCollaboratorRole(documentID string, principal string, role string) (dto.Document, error)
+	RemoveCollaborator(documentID string, principal string) (dto.Document, error)
+	TransferOwnership(documentID string, from string, to string) (dto.Document, error)
+	TrashDocument(documentID string, email string, retention time.Duration) error
+	RestoreDocument(documentID string, email string) error
+	DeleteDocument(documentID string, email string) (bool, error)
+	ListTrash(email string) ([]*dto.TrashedDocument, error)
+	DuplicateDocument(documentID string, email string, title string) (string, error)
+	SetTemplate(documentID string, template *dto.Template) error
+	ListTemplates(email string) ([]*dto.TemplateItem, error)
+	CreateFromTemplate(templateID string, email string, title string) (string, error)
+	PurgeTrash(now time.Time) ([]string, error)
+	MigrateAccess() (int64, error)
+	BackfillSearchText() (int64, error)
+	BackfillMetadata() (int64, error)
 }
 
 type documentService struct {
-	collection *mongo.Collection // MongoDB collection
+	collection  *mongo.Collection // MongoDB collection
+	groups      *mongo.Collection // MongoDB collection holding the groups documents can be shared with
+	users       *mongo.Collection // MongoDB collection holding the users documents can be shared with
+	labels      *mongo.Collection // MongoDB collection holding the users' own stars and labels
+	shareLinks  *mongo.Collection // MongoDB collection holding the share links of documents
+	invitations *mongo.Collection // MongoDB collection holding the pending invitations to documents
+	ctx         context.Context   // Context of the MongoDB calls, none for the background
 }
 
+// defaultSearchLimit is the number of search results returned when the request sets no limit
+const defaultSearchLimit = 20
+
 func NewDocumentService(client *mongo.Client, databaseName, collectionName string) DocumentService {
-	collection := client.Database(databaseName).Collection(collectionName)
+	database := client.Database(databaseName)
+	collection := database.Collection(collectionName)
+	// Full-text search over titles and the plain text of bodies, a title match ranks higher
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "title", Value: "text"}, {Key: "text", Value: "text"}},
+		Options: options.Index().SetName("search").SetWeights(bson.M{"title": 5, "text": 1}),
+	})
+	if err != nil {
+		slog.Error("Error creating search index", "error", err)
+	}
+	// Document lists are filtered by access and sorted by these fields
+	var listIndexes []mongo.IndexModel
+	for _, field := range []string{"title", "createdAt", "updatedAt"} {
+		listIndexes = append(listIndexes, mongo.IndexModel{Keys: bson.D{{Key: "acl.principal", Value: 1}, {Key: field, Value: 1}, {Key: "_id", Value: 1}}})
+	}
+	listIndexes = append(listIndexes,
+		mongo.IndexModel{Keys: bson.D{{Key: "inheritedAcl.principal", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "folderId", Value: 1}}},
+	)
+	listIndexes = append(listIndexes, mongo.IndexModel{Keys: bson.D{{Key: "opens.email", Value: 1}, {Key: "opens.at", Value: 1}}})
+	// Only documents in the trash have a purge time and only templates a template scope
+	listIndexes = append(listIndexes,
+		mongo.IndexModel{Keys: bson.D{{Key: "purgeAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+		mongo.IndexModel{Keys: bson.D{{Key: "template.scope", Value: 1}}, Options: options.Index().SetSparse(true)},
+	)
+	if _, err := collection.Indexes().CreateMany(context.Background(), listIndexes); err != nil {
+		slog.Error("Error creating document list indexes", "error", err)
+	}
 	return &documentService{
-		collection: collection,
+		collection:  collection,
+		groups:      database.Collection("groups"),
+		users:       database.Collection("users"),
+		labels:      database.Collection("documentlabels"),
+		shareLinks:  database.Collection("sharelinks"),
+		invitations: database.Collection("invitations"),
+	}
+}
+
+func (service *documentService) WithContext(ctx context.Context) DocumentService {
+	bound := *service
+	bound.ctx = ctx
+	return &bound
+}
+
+func (service *documentService) context() context.Context {
+	if service.ctx == nil {
+		return context.Background()
 	}
+	return service.ctx
+}
+
+// Principals returns the ACL principals that act for a user: their email and their groups
+func (service *documentService) Principals(email string) ([]string, error) {
+	return userPrincipals(service.context(), service.groups, email)
 }
 
-func (service *documentService) GetAllDocuments(email dto.Email) ([]*dto.Document, error) {
-	filter := bson.M{"$or": []bson.M{{"author": email.Email}, {"readAccess": email.Email}, {"writeAccess": email.Email}}}
-	cursor, err := service.collection.Find(context.Background(), filter)
+func userPrincipals(ctx context.Context, groups *mongo.Collection, email string) ([]string, error) {
+	filter := bson.M{"members": email}
+	projection := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := groups.Find(ctx, filter, projection)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(context.Background())
+	var memberships []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &memberships); err != nil {
+		return nil, err
+	}
 
-	var documents []*dto.Document
-	for cursor.Next(context.Background()) {
-		var document dto.Document
-		if err := cursor.Decode(&document); err != nil {
-			return nil, err
+	principals := []string{email}
+	for _, group := range memberships {
+		principals = append(principals, GroupPrincipal(group.ID))
+	}
+	return principals, nil
+}
+
+// SearchDocuments runs a full-text search over the titles and bodies of the documents the
+// user can access, most relevant first unless the search sorts by date
+func (service *documentService) SearchDocuments(email string, search dto.Search) ([]*dto.SearchResult, error) {
+	principals, err := service.Principals(email)
+	if err != nil {
+		return nil, err
+	}
+	limit := search.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	conditions := []bson.M{accessFilter(principals), {"$text": bson.M{"$search": search.SearchQuery}}}
+	if search.Tag != "" {
+		conditions = append(conditions, bson.M{"tags": search.Tag})
+	}
+	labeled, err := labeledFilter(service.labels, email, search.Starred, search.Label)
+	if err != nil {
+		return nil, err
+	}
+	if labeled != nil {
+		conditions = append(conditions, labeled)
+	}
+	score := bson.M{"$meta": "textScore"}
+	sort := bson.D{{Key: "score", Value: score}}
+	switch search.Sort {
+	case dto.SortCreated:
+		sort = bson.D{{Key: "createdAt", Value: -1}}
+	case dto.SortModified:
+		sort = bson.D{{Key: "updatedAt", Value: -1}}
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"data": 0, "body": 0, "opens": 0, "score": score}).
+		SetSort(sort).
+		SetLimit(limit)
+	cursor, err := service.collection.Find(service.context(), bson.M{"$and": conditions}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(service.context())
+
+	terms := SearchTerms(search.SearchQuery)
+	results := []*dto.SearchResult{}
+	for cursor.Next(service.context()) {
+		var match struct {
+			dto.SearchResult `bson:",inline"`
+			Text             string         `bson:"text"`
+			ACL              []dto.ACLEntry `bson:"acl"`
+			InheritedACL     []dto.ACLEntry `bson:"inheritedAcl"`
 		}
-		documentDTO := &dto.Document{
-			ID:    document.ID,
-			Title: document.Title,
+		if err := cursor.Decode(&match); err != nil {
+			return nil, err
 		}
+		result := match.SearchResult
+		result.Role = EffectiveRole(MergeACL(match.ACL, match.InheritedACL), principals...)
+		result.Snippet = Snippet(match.Text, terms)
+		results = append(results, &result)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
 
-		documents = append(documents, documentDTO)
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
 	}
-	return documents, nil
+	labels, err := userLabels(service.labels, email, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		result.Starred, result.Labels = labels[result.ID].Starred, labels[result.ID].Labels
+		if result.Tags == nil {
+			result.Tags = []string{}
+		}
+	}
+	return results, nil
 }
 
-func (service *documentService) SearchDocuments(email string, searchQuery string) ([]*dto.Document, error) {
-	filter := bson.M{
-		"$or": []bson.M{
-			{"author": email},
-			{"readAccess": email},
-			{"writeAccess": email},
-		},
-		"title": bson.M{
-			"$regex":   searchQuery,
-			"$options": "i",
-		},
+// BackfillMetadata dates documents saved before creation and modification times were
+// recorded from their creation, returning the number of updated documents
+func (service *documentService) BackfillMetadata() (int64, error) {
+	ctx := service.context()
+	var updated int64
+	for _, field := range []string{"createdAt", "updatedAt"} {
+		filter := bson.M{field: bson.M{"$exists": false}}
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.M{field: bson.M{"$toDate": "$_id"}}}}}
+		result, err := service.collection.UpdateMany(ctx, filter, update)
+		if err != nil {
+			return updated, err
+		}
+		updated += result.ModifiedCount
 	}
-	cursor, err := service.collection.Find(context.Background(), filter)
+	return updated, nil
+}
+
+// BackfillSearchText stores the plain text and counts of documents saved before bodies were
+// indexed, returning the number of updated documents
+func (service *documentService) BackfillSearchText() (int64, error) {
+	ctx := service.context()
+	filter := bson.M{"$or": []bson.M{
+		{"text": bson.M{"$exists": false}},
+		{"wordCount": bson.M{"$exists": false}},
+	}}
+	projection := options.Find().SetProjection(bson.M{"data": 1})
+	cursor, err := service.collection.Find(ctx, filter, projection)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	var documents []*dto.Document
-	for cursor.Next(context.Background()) {
-		var document dto.Document
+	var updated int64
+	for cursor.Next(ctx) {
+		var document struct {
+			ID   primitive.ObjectID `bson:"_id"`
+			Data dto.DocumentData   `bson:"data"`
+		}
 		if err := cursor.Decode(&document); err != nil {
-			return nil, err
+			return updated, err
 		}
-		documentDTO := &dto.Document{
-			ID:    document.ID,
-			Title: document.Title,
+		update := bson.M{"$set": textFields(document.Data)}
+		if _, err := service.collection.UpdateByID(ctx, document.ID, update); err != nil {
+			return updated, err
 		}
+		updated++
+	}
+	return updated, cursor.Err()
+}
+
+// textFields are the fields derived from a document body: its plain text for the search
+// index and its word and character counts
+func textFields(data dto.DocumentData) bson.M {
+	text := PlainText(data)
+	words, chars := CountText(text)
+	return bson.M{"text": text, "wordCount": words, "charCount": chars}
+}
 
-		documents = append(documents, documentDTO)
+// RecordOpen remembers when the user last opened the document, replacing their previous
+// entry in a single update
+func (service *documentService) RecordOpen(documentID string, email string) error {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return ErrDocumentNotFound
 	}
-	return documents, nil
+	others := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$opens", bson.A{}}},
+		"cond":  bson.M{"$ne": bson.A{"$$this.email", email}},
+	}}
+	opened := bson.A{bson.M{"email": email, "at": time.Now().UTC()}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{"opens": bson.M{"$concatArrays": bson.A{others, opened}}}}}}
+	_, err = service.collection.UpdateOne(service.context(), bson.M{"_id": objectID}, update)
+	return err
 }
 
-func (service *documentService) CreateDocument(author string, title string, body interface{}, readAccess []string, writeAccess []string) (string, error) {
+func (service *documentService) CreateDocument(author string, title string, body interface{}, acl []dto.ACLEntry) (string, error) {
+	// The author always owns the document they create
+	if EffectiveRole(acl, author) != dto.RoleOwner {
+		acl = append([]dto.ACLEntry{{Principal: author, Role: dto.RoleOwner}}, acl...)
+	}
+
 	// Implement logic to create a document in the MongoDB collection
+	now := time.Now().UTC()
 	newDocument := bson.D{
 		{Key: "author", Value: author},
-		{Key: "readAccess", Value: readAccess},
-		{Key: "writeAccess", Value: writeAccess},
+		{Key: "acl", Value: acl},
 		{Key: "title", Value: title},
 		{Key: "body", Value: body},
+		{Key: "createdAt", Value: now},
+		{Key: "updatedAt", Value: now},
+		{Key: "lastEditedBy", Value: author},
+	}
+	if data, ok := body.(dto.DocumentData); ok {
+		for key, value := range textFields(data) {
+			newDocument = append(newDocument, bson.E{Key: key, Value: value})
+		}
 	}
 
-	document, err := service.collection.InsertOne(context.Background(), newDocument)
+	document, err := service.collection.InsertOne(service.context(), newDocument)
 	if err != nil {
 		return "", err
 	}
@@ -115,15 +341,28 @@ func (service *documentService) CreateDocument(author string, title string, body
 	return insertedID.Hex(), nil
 }
 
-func (service *documentService) UpdateDocument(documentID string, incomingData dto.DocumentData) error {
+// UpdateDocument saves the body of a document at a revision, editor is the user who last
+// changed it. The stored revision never goes back.
+func (service *documentService) UpdateDocument(documentID string, incomingData dto.DocumentData, revision int64, editor string) error {
 	objectID, err := primitive.ObjectIDFromHex(documentID)
 	if err != nil {
 		return err
 	}
 
-	update := bson.M{"$set": bson.M{"data.ops": incomingData.Ops}}
-	filter := bson.M{"_id": objectID}
-	_, err = service.collection.UpdateOne(context.Background(), filter, update)
+	fields := textFields(incomingData)
+	fields["data.ops"] = incomingData.Ops
+	fields["updatedAt"] = time.Now().UTC()
+	if editor != "" {
+		fields["lastEditedBy"] = editor
+	}
+	fields["revision"] = revision
+	update := bson.M{"$set": fields}
+	// Flushes of the same document may overlap, an older revision never replaces a newer one
+	filter := bson.M{"_id": objectID, "$or": []bson.M{
+		{"revision": bson.M{"$lte": revision}},
+		{"revision": bson.M{"$exists": false}},
+	}}
+	_, err = service.collection.UpdateOne(service.context(), filter, update)
 	return err
 }
 
@@ -135,8 +374,8 @@ func (service *documentService) GetDocumentByID(documentID string) (*dto.Documen
 		return nil, err
 	}
 
-	filter := bson.M{"_id": objectID}
-	err = service.collection.FindOne(context.Background(), filter).Decode(&document)
+	filter := bson.M{"_id": objectID, "deletedAt": notTrashed}
+	err = service.collection.FindOne(service.context(), filter).Decode(&document)
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +383,29 @@ func (service *documentService) GetDocumentByID(documentID string) (*dto.Documen
 	return &document, nil
 }
 
+func (service *documentService) GetRole(documentID string, email string) (string, error) {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return "", ErrDocumentNotFound
+	}
+
+	var document dto.Document
+	filter := bson.M{"_id": objectID, "deletedAt": notTrashed}
+	projection := options.FindOne().SetProjection(bson.M{"acl": 1, "inheritedAcl": 1})
+	err = service.collection.FindOne(service.context(), filter, projection).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrDocumentNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	principals, err := service.Principals(email)
+	if err != nil {
+		return "", err
+	}
+	return DocumentRole(&document, principals...), nil
+}
+
 func (service *documentService) UpdateTitle(documentID string, title string) (string, error) {
 	// Implement logic to update the title of a document in the MongoDB collection
 	objectID, err := primitive.ObjectIDFromHex(documentID)
@@ -151,47 +413,311 @@ func (service *documentService) UpdateTitle(documentID string, title string) (st
 		return "", err
 	}
 	filter := bson.M{"_id": objectID}
-	update := bson.M{"$set": bson.M{"title": title}}
-	_, err = service.collection.UpdateOne(context.Background(), filter, update)
+	update := bson.M{"$set": bson.M{"title": title, "updatedAt": time.Now().UTC()}}
+	_, err = service.collection.UpdateOne(service.context(), filter, update)
 	return "", err
 }
 
+// UpdateTags adds and removes shared tags of a document, returning its tags after the change
+func (service *documentService) UpdateTags(update dto.LabelUpdate) ([]string, error) {
+	objectID, err := primitive.ObjectIDFromHex(update.DocumentID)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	opts := options.FindOneAndUpdate().
+		SetProjection(bson.M{"tags": 1}).
+		SetReturnDocument(options.After)
+	var document struct {
+		Tags []string `bson:"tags"`
+	}
+	err = service.collection.FindOneAndUpdate(service.context(), bson.M{"_id": objectID}, bson.A{editSet("tags", update)}, opts).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if document.Tags == nil {
+		document.Tags = []string{}
+	}
+	return document.Tags, nil
+}
+
 func (service *documentService) UpdateCollaborators(documentID string, collaborators dto.Access) (dto.Document, error) {
     objectID, err := primitive.ObjectIDFromHex(documentID)
     if err != nil {
-        fmt.Print(err)
         return dto.Document{}, err
     }
 
     filter := bson.M{"_id": objectID}
-    update := bson.M{"$set": bson.M{"readAccess": collaborators.ReadAccess, "writeAccess": collaborators.WriteAccess}}
+    update := bson.M{"$set": bson.M{"acl": collaborators.ACL}}
 
     // Perform the update operation
-    _, err = service.collection.UpdateOne(context.Background(), filter, update)
+    _, err = service.collection.UpdateOne(service.context(), filter, update)
     if err != nil {
         return dto.Document{}, err
     }
 
     // Retrieve the updated document
     var updatedDocument dto.Document
-    err = service.collection.FindOne(context.Background(), filter).Decode(&updatedDocument)
+    err = service.collection.FindOne(service.context(), filter).Decode(&updatedDocument)
     if err != nil {
         return dto.Document{}, err
     }
     return updatedDocument, nil
 }
 
-func (service *documentService) DeleteDocument(documentID string) (bool, error) {
+// AddCollaborator grants a role to a principal that isn't on the document yet. The check and
+// the push happen in a single update so that concurrent shares don't overwrite each other.
+func (service *documentService) AddCollaborator(documentID string, entry dto.ACLEntry) (dto.Document, error) {
 	objectID, err := primitive.ObjectIDFromHex(documentID)
 	if err != nil {
-		return false, err
+		return dto.Document{}, ErrDocumentNotFound
+	}
+	exists, err := service.principalExists(entry.Principal)
+	if err != nil {
+		return dto.Document{}, err
+	}
+	if !exists {
+		return dto.Document{}, ErrPrincipalNotFound
 	}
 
-	filter := bson.M{"_id": objectID}
-	result, err := service.collection.DeleteOne(context.Background(), filter)
+	filter := bson.M{"_id": objectID, "acl.principal": bson.M{"$ne": entry.Principal}}
+	update := bson.M{"$push": bson.M{"acl": entry}}
+	document, err := service.updateACL(filter, update)
+	if err == mongo.ErrNoDocuments {
+		if _, err := service.currentACL(objectID); err != nil {
+			return dto.Document{}, err
+		}
+		return dto.Document{}, ErrCollaboratorExists
+	}
+	return document, err
+}
+
+// ChangeCollaboratorRole sets the role of a principal already on the document. Demoting an
+// owner only succeeds while another owner remains.
+func (service *documentService) ChangeCollaboratorRole(documentID string, principal string, role string) (dto.Document, error) {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return dto.Document{}, ErrDocumentNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "acl.principal": principal}
+	if role != dto.RoleOwner {
+		filter["acl"] = otherOwner(principal)
+	}
+	update := bson.M{"$set": bson.M{"acl.$[entry].role": role}}
+	arrayFilters := options.ArrayFilters{Filters: []interface{}{bson.M{"entry.principal": principal}}}
+	document, err := service.updateACL(filter, update, arrayFilters)
+	if err == mongo.ErrNoDocuments {
+		return dto.Document{}, service.collaboratorError(objectID, principal)
+	}
+	return document, err
+}
+
+// RemoveCollaborator takes a principal off the document, unless it's the last owner
+func (service *documentService) RemoveCollaborator(documentID string, principal string) (dto.Document, error) {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return dto.Document{}, ErrDocumentNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "acl.principal": principal, "acl": otherOwner(principal)}
+	update := bson.M{"$pull": bson.M{"acl": bson.M{"principal": principal}}}
+	document, err := service.updateACL(filter, update)
+	if err == mongo.ErrNoDocuments {
+		return dto.Document{}, service.collaboratorError(objectID, principal)
+	}
+	return document, err
+}
+
+// accessFilter matches the documents or folders the principals have a role on, directly or
+// through a parent folder. Documents in the trash are left out.
+func accessFilter(principals []string) bson.M {
+	return bson.M{
+		"$or": []bson.M{
+			{"acl.principal": bson.M{"$in": principals}},
+			{"inheritedAcl.principal": bson.M{"$in": principals}},
+		},
+		"deletedAt": notTrashed,
+	}
+}
+
+// otherOwner matches access lists with an owner besides the principal
+func otherOwner(principal string) bson.M {
+	return bson.M{"$elemMatch": bson.M{"role": dto.RoleOwner, "principal": bson.M{"$ne": principal}}}
+}
+
+func (service *documentService) updateACL(filter bson.M, update bson.M, arrayFilters ...options.ArrayFilters) (dto.Document, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if len(arrayFilters) > 0 {
+		opts.SetArrayFilters(arrayFilters[0])
+	}
+	var document dto.Document
+	err := service.collection.FindOneAndUpdate(service.context(), filter, update, opts).Decode(&document)
+	return document, err
+}
+
+func (service *documentService) currentACL(objectID primitive.ObjectID) ([]dto.ACLEntry, error) {
+	var document dto.Document
+	projection := options.FindOne().SetProjection(bson.M{"acl": 1})
+	err := service.collection.FindOne(service.context(), bson.M{"_id": objectID}, projection).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrDocumentNotFound
+	}
+	return document.ACL, err
+}
+
+// collaboratorError explains why an update guarded on a principal's entry matched nothing
+func (service *documentService) collaboratorError(objectID primitive.ObjectID, principal string) error {
+	acl, err := service.currentACL(objectID)
 	if err != nil {
-		return false, err
+		return err
+	}
+	if EffectiveRole(acl, principal) == "" {
+		return ErrNotCollaborator
+	}
+	return ErrLastOwner
+}
+
+// principalExists checks that a user or group principal refers to an existing account or group
+func (service *documentService) principalExists(principal string) (bool, error) {
+	return principalExists(service.context(), service.users, service.groups, principal)
+}
+
+// UnknownPrincipal returns the first principal of an access list naming no user or group,
+// or an empty string when they all exist
+func (service *documentService) UnknownPrincipal(acl []dto.ACLEntry) (string, error) {
+	for _, entry := range acl {
+		exists, err := service.principalExists(entry.Principal)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return entry.Principal, nil
+		}
+	}
+	return "", nil
+}
+
+// principalExists reports whether a principal names an existing user or group
+func principalExists(ctx context.Context, users *mongo.Collection, groups *mongo.Collection, principal string) (bool, error) {
+	collection, filter := users, bson.M{"email": principal}
+	if groupID, ok := strings.CutPrefix(principal, dto.GroupPrincipalPrefix); ok {
+		objectID, err := primitive.ObjectIDFromHex(groupID)
+		if err != nil {
+			return false, nil
+		}
+		collection, filter = groups, bson.M{"_id": objectID}
+	}
+	count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+func (service *documentService) TransferOwnership(documentID string, from string, to string) (dto.Document, error) {
+	document, err := service.GetDocumentByID(documentID)
+	if err != nil {
+		return dto.Document{}, err
 	}
+	// Owners through a group or a folder can't step down without demoting everyone else
+	// sharing that entry, the transfer would leave them owners
+	if EffectiveRole(document.ACL, from) != dto.RoleOwner {
+		return dto.Document{}, ErrNotDirectOwner
+	}
+	// The previous owner is demoted, a new owner nobody can act as would leave the document
+	// without one
+	exists, err := service.principalExists(to)
+	if err != nil {
+		return dto.Document{}, err
+	}
+	if !exists {
+		return dto.Document{}, ErrPrincipalNotFound
+	}
+
+	acl := transferACL(document.ACL, from, to)
 
-	return result.DeletedCount > 0, nil
+	// Only apply the change if nobody else modified the ACL in the meantime
+	objectID, _ := primitive.ObjectIDFromHex(documentID)
+	filter := bson.M{"_id": objectID, "acl": document.ACL}
+	update := bson.M{"$set": bson.M{"acl": acl, "author": to}}
+	result, err := service.collection.UpdateOne(service.context(), filter, update)
+	if err != nil {
+		return dto.Document{}, err
+	}
+	if result.MatchedCount == 0 {
+		return dto.Document{}, ErrACLChanged
+	}
+
+	document.ACL = acl
+	document.Author = to
+	return *document, nil
+}
+
+// transferACL makes to the owner of a document in place of from. The new owner replaces any
+// role it held, the previous owner stays on as an editor.
+func transferACL(current []dto.ACLEntry, from string, to string) []dto.ACLEntry {
+	acl := []dto.ACLEntry{{Principal: to, Role: dto.RoleOwner}}
+	for _, entry := range current {
+		switch entry.Principal {
+		case to:
+			continue
+		case from:
+			acl = append(acl, dto.ACLEntry{Principal: from, Role: dto.RoleEditor})
+		default:
+			acl = append(acl, entry)
+		}
+	}
+	return acl
+}
+
+// MigrateAccess converts documents still using the former author/readAccess/writeAccess
+// fields to the ACL model, returning the number of migrated documents
+func (service *documentService) MigrateAccess() (int64, error) {
+	ctx := service.context()
+	filter := bson.M{"$or": []bson.M{
+		{"acl": bson.M{"$exists": false}},
+		{"readAccess": bson.M{"$exists": true}},
+		{"writeAccess": bson.M{"$exists": true}},
+	}}
+	cursor, err := service.collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID          primitive.ObjectID `bson:"_id"`
+			Author      string             `bson:"author"`
+			ACL         []dto.ACLEntry     `bson:"acl"`
+			ReadAccess  []string           `bson:"readAccess"`
+			WriteAccess []string           `bson:"writeAccess"`
+		}
+		if err := cursor.Decode(&legacy); err != nil {
+			return migrated, err
+		}
+
+		// The author only becomes the owner of documents whose ACL names none, ownership may
+		// have moved on since
+		author := legacy.Author
+		if CountOwners(legacy.ACL) > 0 {
+			author = ""
+		}
+		acl := LegacyACL(author, legacy.ReadAccess, legacy.WriteAccess)
+		for _, entry := range legacy.ACL {
+			if EffectiveRole(acl, entry.Principal) == "" {
+				acl = append(acl, entry)
+			}
+		}
+		update := bson.M{
+			"$set":   bson.M{"acl": acl},
+			"$unset": bson.M{"readAccess": "", "writeAccess": ""},
+		}
+		if _, err := service.collection.UpdateOne(ctx, bson.M{"_id": legacy.ID}, update); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, cursor.Err()
 }
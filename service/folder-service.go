@@ -0,0 +1,527 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrFolderNotFound    = errors.New("folder not found")
+	ErrFolderPermissions = errors.New("insufficient permissions on folder")
+	ErrFolderCycle       = errors.New("a folder can't be moved into itself")
+	ErrInvalidRole       = errors.New("invalid role")
+)
+
+type FolderService interface {
+	CreateFolder(email string, request dto.CreateFolder) (*dto.Folder, error)
+	GetContents(folderID string, email string) (*dto.FolderContents, error)
+	Breadcrumbs(folderID string, email string) ([]dto.Breadcrumb, error)
+	RenameFolder(folderID string, email string, name string) (*dto.Folder, error)
+	MoveFolder(folderID string, email string, parentID string) ([]string, error)
+	ShareFolder(folderID string, email string, share dto.FolderShare) ([]string, error)
+	DeleteFolder(folderID string, email string) ([]string, error)
+	MoveDocument(email string, move dto.MoveDocument) (*dto.Document, error)
+}
+
+type folderService struct {
+	collection *mongo.Collection // MongoDB collection holding the folders
+	documents  *mongo.Collection // MongoDB collection holding the documents filed in the folders
+	groups     *mongo.Collection // MongoDB collection holding the groups folders can be shared with
+}
+
+func NewFolderService(client *mongo.Client, databaseName, collectionName string) FolderService {
+	database := client.Database(databaseName)
+	collection := database.Collection(collectionName)
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "parentId", Value: 1}}},
+		{Keys: bson.D{{Key: "ancestors", Value: 1}}},
+	})
+	if err != nil {
+		slog.Error("Error creating folder indexes", "error", err)
+	}
+	return &folderService{
+		collection: collection,
+		documents:  database.Collection("documents"),
+		groups:     database.Collection("groups"),
+	}
+}
+
+func (service *folderService) CreateFolder(email string, request dto.CreateFolder) (*dto.Folder, error) {
+	folder := &dto.Folder{
+		Name:      request.Name,
+		Ancestors: []string{},
+		ACL:       []dto.ACLEntry{{Principal: email, Role: dto.RoleOwner}},
+		CreatedAt: time.Now().UTC(),
+	}
+	if request.ParentID != "" {
+		parent, err := service.authorizedFolder(request.ParentID, email, dto.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+		folder.ParentID = parent.ID
+		folder.Ancestors = append(parent.Ancestors, parent.ID)
+		folder.InheritedACL = MergeACL(parent.ACL, parent.InheritedACL)
+	}
+
+	result, err := service.collection.InsertOne(context.Background(), folder)
+	if err != nil {
+		return nil, err
+	}
+	folder.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	folder.Role = dto.RoleOwner
+	return folder, nil
+}
+
+// GetContents returns a folder with its subfolders. Without a folder ID it returns the top
+// level of the user, which also holds the folders shared with them whose parent they can't see.
+func (service *folderService) GetContents(folderID string, email string) (*dto.FolderContents, error) {
+	principals, err := userPrincipals(context.Background(), service.groups, email)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := &dto.FolderContents{Breadcrumbs: []dto.Breadcrumb{}}
+	filter := bson.M{"$and": []bson.M{
+		accessFilter(principals),
+		{"$or": []bson.M{
+			{"parentId": bson.M{"$exists": false}},
+			{"inheritedAcl.principal": bson.M{"$nin": principals}},
+		}},
+	}}
+	if folderID != "" {
+		folder, err := service.authorizedFolder(folderID, email, dto.RoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		contents.Folder = folder
+		contents.Breadcrumbs, err = service.breadcrumbs(folder, principals)
+		if err != nil {
+			return nil, err
+		}
+		// Everything in a folder inherits its access
+		filter = bson.M{"parentId": folder.ID}
+	}
+
+	cursor, err := service.collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+	contents.Folders = []*dto.Folder{}
+	if err := cursor.All(context.Background(), &contents.Folders); err != nil {
+		return nil, err
+	}
+	for _, folder := range contents.Folders {
+		folder.Role = folderRole(folder, principals)
+	}
+	return contents, nil
+}
+
+// Breadcrumbs returns the path to a folder, the folder included, leaving out the folders the
+// user can't see
+func (service *folderService) Breadcrumbs(folderID string, email string) ([]dto.Breadcrumb, error) {
+	if folderID == "" {
+		return []dto.Breadcrumb{}, nil
+	}
+	principals, err := userPrincipals(context.Background(), service.groups, email)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := service.findFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	return service.breadcrumbs(folder, principals)
+}
+
+func (service *folderService) breadcrumbs(folder *dto.Folder, principals []string) ([]dto.Breadcrumb, error) {
+	ancestors, err := service.findFolders(folder.Ancestors)
+	if err != nil {
+		return nil, err
+	}
+
+	breadcrumbs := []dto.Breadcrumb{}
+	for _, ancestor := range append(ancestors, folder) {
+		if folderRole(ancestor, principals) != "" {
+			breadcrumbs = append(breadcrumbs, dto.Breadcrumb{ID: ancestor.ID, Name: ancestor.Name})
+		}
+	}
+	return breadcrumbs, nil
+}
+
+func (service *folderService) RenameFolder(folderID string, email string, name string) (*dto.Folder, error) {
+	folder, err := service.authorizedFolder(folderID, email, dto.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	objectID, _ := primitive.ObjectIDFromHex(folder.ID)
+	update := bson.M{"$set": bson.M{"name": name}}
+	if _, err := service.collection.UpdateByID(context.Background(), objectID, update); err != nil {
+		return nil, err
+	}
+	folder.Name = name
+	return folder, nil
+}
+
+// MoveFolder moves a folder with everything in it under another folder, returning the IDs of
+// the documents whose inherited access changed
+func (service *folderService) MoveFolder(folderID string, email string, parentID string) ([]string, error) {
+	folder, err := service.authorizedFolder(folderID, email, dto.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	ancestors := []string{}
+	if parentID != "" {
+		parent, err := service.authorizedFolder(parentID, email, dto.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+		if parent.ID == folder.ID || contains(parent.Ancestors, folder.ID) {
+			return nil, ErrFolderCycle
+		}
+		ancestors = append(parent.Ancestors, parent.ID)
+	}
+
+	if err := service.reparent(folder, parentID, ancestors); err != nil {
+		return nil, err
+	}
+	return service.propagate(folder.ID)
+}
+
+// ShareFolder sets the role of a principal on a folder and on everything in it, returning the
+// IDs of the documents whose inherited access changed
+func (service *folderService) ShareFolder(folderID string, email string, share dto.FolderShare) ([]string, error) {
+	if share.Role != "" && !ValidRole(share.Role) {
+		return nil, ErrInvalidRole
+	}
+	folder, err := service.authorizedFolder(folderID, email, dto.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	acl := []dto.ACLEntry{}
+	for _, entry := range folder.ACL {
+		if entry.Principal != share.Principal {
+			acl = append(acl, entry)
+		}
+	}
+	if share.Role != "" {
+		acl = append(acl, dto.ACLEntry{Principal: share.Principal, Role: share.Role})
+	}
+	// Owners of a parent folder manage its subfolders, a top level folder needs its own
+	if CountOwners(acl) == 0 && CountOwners(folder.InheritedACL) == 0 {
+		return nil, ErrLastOwner
+	}
+
+	// Only apply the change if nobody else modified the ACL in the meantime
+	objectID, _ := primitive.ObjectIDFromHex(folder.ID)
+	filter := bson.M{"_id": objectID, "acl": folder.ACL}
+	result, err := service.collection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"acl": acl}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrACLChanged
+	}
+	return service.propagate(folder.ID)
+}
+
+// DeleteFolder deletes a folder, its documents and subfolders move up to its parent. Returns the
+// IDs of the documents whose inherited access changed.
+func (service *folderService) DeleteFolder(folderID string, email string) ([]string, error) {
+	folder, err := service.authorizedFolder(folderID, email, dto.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+
+	documentIDs, err := service.documentIDs([]string{folder.ID})
+	if err != nil {
+		return nil, err
+	}
+	update := bson.M{"$unset": bson.M{"folderId": "", "inheritedAcl": ""}}
+	if folder.ParentID != "" {
+		update = bson.M{"$set": bson.M{"folderId": folder.ParentID}}
+	}
+	if _, err := service.documents.UpdateMany(ctx, bson.M{"folderId": folder.ID}, update); err != nil {
+		return nil, err
+	}
+
+	children, err := service.children(folder.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if err := service.reparent(child, folder.ParentID, folder.Ancestors); err != nil {
+			return nil, err
+		}
+	}
+	objectID, _ := primitive.ObjectIDFromHex(folder.ID)
+	if _, err := service.collection.DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+		return nil, err
+	}
+
+	// Everything that moved up no longer inherits from the deleted folder
+	roots := []string{folder.ParentID}
+	if folder.ParentID == "" {
+		roots = nil
+		for _, child := range children {
+			roots = append(roots, child.ID)
+		}
+	}
+	for _, root := range roots {
+		changed, err := service.propagate(root)
+		if err != nil {
+			return nil, err
+		}
+		documentIDs = append(documentIDs, changed...)
+	}
+	return documentIDs, nil
+}
+
+// MoveDocument files a document into a folder. Filing it shares it with the folder's
+// collaborators, so it takes an owner of the document and an editor of the folder.
+func (service *folderService) MoveDocument(email string, move dto.MoveDocument) (*dto.Document, error) {
+	principals, err := userPrincipals(context.Background(), service.groups, email)
+	if err != nil {
+		return nil, err
+	}
+	objectID, err := primitive.ObjectIDFromHex(move.ID)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	var document dto.Document
+	projection := options.FindOne().SetProjection(bson.M{"acl": 1, "inheritedAcl": 1})
+	err = service.documents.FindOne(context.Background(), bson.M{"_id": objectID, "deletedAt": notTrashed}, projection).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	role := DocumentRole(&document, principals...)
+	if role == "" {
+		return nil, ErrDocumentNotFound
+	}
+	if role != dto.RoleOwner {
+		return nil, ErrFolderPermissions
+	}
+
+	update := bson.M{"$unset": bson.M{"folderId": "", "inheritedAcl": ""}}
+	if move.FolderID != "" {
+		folder, err := service.authorizedFolder(move.FolderID, email, dto.RoleEditor)
+		if err != nil {
+			return nil, err
+		}
+		update = bson.M{"$set": bson.M{
+			"folderId":     folder.ID,
+			"inheritedAcl": InheritedACL(MergeACL(folder.ACL, folder.InheritedACL)),
+		}}
+	}
+
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"data": 0, "body": 0, "opens": 0, "text": 0})
+	var moved dto.Document
+	err = service.documents.FindOneAndUpdate(context.Background(), bson.M{"_id": objectID}, update, after).Decode(&moved)
+	if err != nil {
+		return nil, err
+	}
+	return &moved, nil
+}
+
+// reparent moves a folder under a new parent, rewriting the ancestors of its descendants
+func (service *folderService) reparent(folder *dto.Folder, parentID string, ancestors []string) error {
+	ctx := context.Background()
+	objectID, _ := primitive.ObjectIDFromHex(folder.ID)
+	update := bson.M{"$set": bson.M{"ancestors": ancestors}, "$unset": bson.M{"parentId": ""}}
+	if parentID != "" {
+		update = bson.M{"$set": bson.M{"ancestors": ancestors, "parentId": parentID}}
+	}
+	if _, err := service.collection.UpdateByID(ctx, objectID, update); err != nil {
+		return err
+	}
+
+	descendants, err := service.descendants(folder.ID)
+	if err != nil {
+		return err
+	}
+	prefix := append(append([]string{}, ancestors...), folder.ID)
+	for _, descendant := range descendants {
+		// Keep the part of the path below the moved folder
+		below := descendant.Ancestors
+		for i, ancestor := range descendant.Ancestors {
+			if ancestor == folder.ID {
+				below = descendant.Ancestors[i+1:]
+				break
+			}
+		}
+		descendantID, _ := primitive.ObjectIDFromHex(descendant.ID)
+		path := append(append([]string{}, prefix...), below...)
+		if _, err := service.collection.UpdateByID(ctx, descendantID, bson.M{"$set": bson.M{"ancestors": path}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// propagate recomputes the access inherited by a folder, its descendants and all their
+// documents, returning the IDs of those documents
+func (service *folderService) propagate(folderID string) ([]string, error) {
+	ctx := context.Background()
+	folder, err := service.findFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	descendants, err := service.descendants(folder.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parents come before their children when sorted by depth
+	tree := append([]*dto.Folder{folder}, descendants...)
+	sort.SliceStable(tree, func(i, j int) bool { return len(tree[i].Ancestors) < len(tree[j].Ancestors) })
+	granted := map[string][]dto.ACLEntry{}
+	folderIDs := []string{}
+	for _, current := range tree {
+		var inherited []dto.ACLEntry
+		if current.ParentID != "" {
+			parentACL, ok := granted[current.ParentID]
+			if !ok {
+				parent, err := service.findFolder(current.ParentID)
+				if err != nil {
+					return nil, err
+				}
+				parentACL = MergeACL(parent.ACL, parent.InheritedACL)
+			}
+			inherited = parentACL
+		}
+		granted[current.ID] = MergeACL(current.ACL, inherited)
+		folderIDs = append(folderIDs, current.ID)
+
+		objectID, _ := primitive.ObjectIDFromHex(current.ID)
+		update := bson.M{"$set": bson.M{"inheritedAcl": inherited}}
+		if len(inherited) == 0 {
+			update = bson.M{"$unset": bson.M{"inheritedAcl": ""}}
+		}
+		if _, err := service.collection.UpdateByID(ctx, objectID, update); err != nil {
+			return nil, err
+		}
+		update = bson.M{"$set": bson.M{"inheritedAcl": InheritedACL(granted[current.ID])}}
+		if _, err := service.documents.UpdateMany(ctx, bson.M{"folderId": current.ID}, update); err != nil {
+			return nil, err
+		}
+	}
+	return service.documentIDs(folderIDs)
+}
+
+func (service *folderService) documentIDs(folderIDs []string) ([]string, error) {
+	projection := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := service.documents.Find(context.Background(), bson.M{"folderId": bson.M{"$in": folderIDs}}, projection)
+	if err != nil {
+		return nil, err
+	}
+	var documents []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(context.Background(), &documents); err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, document := range documents {
+		ids = append(ids, document.ID)
+	}
+	return ids, nil
+}
+
+// authorizedFolder returns the folder if the user holds at least the required role on it
+func (service *folderService) authorizedFolder(folderID string, email string, required string) (*dto.Folder, error) {
+	folder, err := service.findFolder(folderID)
+	if err != nil {
+		return nil, err
+	}
+	principals, err := userPrincipals(context.Background(), service.groups, email)
+	if err != nil {
+		return nil, err
+	}
+	folder.Role = folderRole(folder, principals)
+	if folder.Role == "" {
+		return nil, ErrFolderNotFound
+	}
+	if !RoleAllows(folder.Role, required) {
+		return nil, ErrFolderPermissions
+	}
+	return folder, nil
+}
+
+func (service *folderService) findFolder(folderID string) (*dto.Folder, error) {
+	objectID, err := primitive.ObjectIDFromHex(folderID)
+	if err != nil {
+		return nil, ErrFolderNotFound
+	}
+	var folder dto.Folder
+	err = service.collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&folder)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrFolderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// findFolders returns the folders with the given IDs in the same order
+func (service *folderService) findFolders(folderIDs []string) ([]*dto.Folder, error) {
+	objectIDs := []primitive.ObjectID{}
+	for _, folderID := range folderIDs {
+		if objectID, err := primitive.ObjectIDFromHex(folderID); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	found, err := service.findMany(bson.M{"_id": bson.M{"$in": objectIDs}})
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]*dto.Folder{}
+	for _, folder := range found {
+		byID[folder.ID] = folder
+	}
+	folders := []*dto.Folder{}
+	for _, folderID := range folderIDs {
+		if folder, ok := byID[folderID]; ok {
+			folders = append(folders, folder)
+		}
+	}
+	return folders, nil
+}
+
+func (service *folderService) children(folderID string) ([]*dto.Folder, error) {
+	return service.findMany(bson.M{"parentId": folderID})
+}
+
+func (service *folderService) descendants(folderID string) ([]*dto.Folder, error) {
+	return service.findMany(bson.M{"ancestors": folderID})
+}
+
+func (service *folderService) findMany(filter bson.M) ([]*dto.Folder, error) {
+	cursor, err := service.collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	folders := []*dto.Folder{}
+	if err := cursor.All(context.Background(), &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+func folderRole(folder *dto.Folder, principals []string) string {
+	return EffectiveRole(MergeACL(folder.ACL, folder.InheritedACL), principals...)
+}
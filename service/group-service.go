@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrNotGroupAdmin  = errors.New("only group admins can manage the group")
+	ErrLastGroupAdmin = errors.New("a group needs at least one admin")
+)
+
+type GroupService interface {
+	CreateGroup(creator string, name string) (*dto.Group, error)
+	GetGroup(groupID string, email string) (*dto.Group, error)
+	ListGroups(email string) ([]*dto.Group, error)
+	AddMember(groupID string, email string, member dto.GroupMember) (*dto.Group, error)
+	RemoveMember(groupID string, email string, member string) (*dto.Group, error)
+	DeleteGroup(groupID string, email string) (*dto.Group, error)
+}
+
+type groupService struct {
+	collection *mongo.Collection // MongoDB collection holding the groups
+	documents  *mongo.Collection // MongoDB collection holding the documents groups are granted roles on
+	folders    *mongo.Collection // MongoDB collection holding the folders groups are granted roles on
+	users      *mongo.Collection // MongoDB collection holding the users who may join groups
+}
+
+func NewGroupService(client *mongo.Client, databaseName, collectionName string) GroupService {
+	database := client.Database(databaseName)
+	return &groupService{
+		collection: database.Collection(collectionName),
+		documents:  database.Collection("documents"),
+		folders:    database.Collection("folders"),
+		users:      database.Collection("users"),
+	}
+}
+
+// GroupPrincipal returns the ACL principal granting a role to every member of the group
+func GroupPrincipal(groupID string) string {
+	return dto.GroupPrincipalPrefix + groupID
+}
+
+func (service *groupService) CreateGroup(creator string, name string) (*dto.Group, error) {
+	group := &dto.Group{
+		Name:    name,
+		Members: []string{creator},
+		Admins:  []string{creator},
+	}
+	result, err := service.collection.InsertOne(context.Background(), group)
+	if err != nil {
+		return nil, err
+	}
+	group.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	return group, nil
+}
+
+func (service *groupService) GetGroup(groupID string, email string) (*dto.Group, error) {
+	group, err := service.findGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	// Groups are only visible to their members
+	if !contains(group.Members, email) {
+		return nil, ErrGroupNotFound
+	}
+	return group, nil
+}
+
+func (service *groupService) ListGroups(email string) ([]*dto.Group, error) {
+	filter := bson.M{"members": email}
+	cursor, err := service.collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	groups := []*dto.Group{}
+	if err := cursor.All(context.Background(), &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (service *groupService) AddMember(groupID string, email string, member dto.GroupMember) (*dto.Group, error) {
+	group, err := service.adminGroup(groupID, email)
+	if err != nil {
+		return nil, err
+	}
+	// Members are users, groups don't nest
+	if strings.HasPrefix(member.Email, dto.GroupPrincipalPrefix) {
+		return nil, ErrPrincipalNotFound
+	}
+	exists, err := principalExists(context.Background(), service.users, service.collection, member.Email)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrPrincipalNotFound
+	}
+
+	update := bson.M{"$addToSet": bson.M{"members": member.Email}}
+	if member.Admin {
+		update["$addToSet"] = bson.M{"members": member.Email, "admins": member.Email}
+	} else if contains(group.Admins, member.Email) {
+		// Re-adding an admin without the flag demotes them
+		update["$pull"] = bson.M{"admins": member.Email}
+		return service.updateGroupKeepingAdmin(groupID, member.Email, update)
+	}
+	return service.updateGroup(groupID, bson.M{}, update)
+}
+
+func (service *groupService) RemoveMember(groupID string, email string, member string) (*dto.Group, error) {
+	group, err := service.findGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	// Members may always leave, everything else needs an admin
+	if member != email && !contains(group.Admins, email) {
+		if !contains(group.Members, email) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, ErrNotGroupAdmin
+	}
+
+	update := bson.M{"$pull": bson.M{"members": member, "admins": member}}
+	return service.updateGroupKeepingAdmin(groupID, member, update)
+}
+
+func (service *groupService) DeleteGroup(groupID string, email string) (*dto.Group, error) {
+	group, err := service.adminGroup(groupID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	objectID, _ := primitive.ObjectIDFromHex(groupID)
+	if _, err := service.collection.DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+		return nil, err
+	}
+
+	// Revoke every role the group held
+	principal := GroupPrincipal(groupID)
+	if err := revokePrincipal(ctx, principal, service.documents, service.folders); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (service *groupService) findGroup(groupID string) (*dto.Group, error) {
+	objectID, err := primitive.ObjectIDFromHex(groupID)
+	if err != nil {
+		return nil, ErrGroupNotFound
+	}
+
+	var group dto.Group
+	err = service.collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (service *groupService) adminGroup(groupID string, email string) (*dto.Group, error) {
+	group, err := service.findGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(group.Admins, email) {
+		if !contains(group.Members, email) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, ErrNotGroupAdmin
+	}
+	return group, nil
+}
+
+// updateGroupKeepingAdmin applies an update taking admin away from a member unless they are
+// the last admin of the group. The count is checked in the filter of the update, so that
+// admins leaving at the same time can't leave the group without any.
+func (service *groupService) updateGroupKeepingAdmin(groupID string, admin string, update bson.M) (*dto.Group, error) {
+	condition := bson.M{"$or": bson.A{
+		bson.M{"admins": bson.M{"$ne": admin}},
+		bson.M{"admins.1": bson.M{"$exists": true}},
+	}}
+	group, err := service.updateGroup(groupID, condition, update)
+	if err != ErrGroupNotFound {
+		return group, err
+	}
+	// Nothing matched either because the group is gone or because of the condition
+	if _, err := service.findGroup(groupID); err != nil {
+		return nil, err
+	}
+	return nil, ErrLastGroupAdmin
+}
+
+// updateGroup applies an update to the group if it matches condition
+func (service *groupService) updateGroup(groupID string, condition bson.M, update bson.M) (*dto.Group, error) {
+	objectID, _ := primitive.ObjectIDFromHex(groupID)
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	filter := bson.M{"_id": objectID}
+	for key, value := range condition {
+		filter[key] = value
+	}
+	var group dto.Group
+	err := service.collection.FindOneAndUpdate(context.Background(), filter, update, after).Decode(&group)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// revokePrincipal removes a principal from the access lists of the documents and folders, the
+// ones they have of their own and the ones inherited from folders
+func revokePrincipal(ctx context.Context, principal string, collections ...*mongo.Collection) error {
+	for _, field := range []string{"acl", "inheritedAcl"} {
+		filter := bson.M{field + ".principal": principal}
+		update := bson.M{"$pull": bson.M{field: bson.M{"principal": principal}}}
+		for _, collection := range collections {
+			if _, err := collection.UpdateMany(ctx, filter, update); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const invitationLifetime = 7 * 24 * time.Hour
+
+var (
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+)
+
+type InvitationService interface {
+	CreateInvitation(documentID string, invitedBy string, email string, role string) (*dto.Invitation, error)
+	ListInvitations(documentID string) ([]*dto.Invitation, error)
+	RevokeInvitation(documentID string, invitationID string) error
+	AcceptInvitation(token string, email string) (*dto.Invitation, error)
+}
+
+type invitationService struct {
+	collection *mongo.Collection // MongoDB collection
+	mail       MailService
+}
+
+func NewInvitationService(client *mongo.Client, databaseName, collectionName string, mail MailService) InvitationService {
+	collection := client.Database(databaseName).Collection(collectionName)
+	return &invitationService{
+		collection: collection,
+		mail:       mail,
+	}
+}
+
+// CreateInvitation invites an email to a document, inviting the same email again replaces
+// the pending invitation with a fresh token and role
+func (service *invitationService) CreateInvitation(documentID string, invitedBy string, email string, role string) (*dto.Invitation, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(raw)
+
+	invitation := &dto.Invitation{
+		DocumentID: documentID,
+		Email:      strings.ToLower(email),
+		Role:       role,
+		InvitedBy:  invitedBy,
+		TokenHash:  hashToken(token),
+		CreatedAt:  time.Now().UTC(),
+	}
+	invitation.ExpiresAt = invitation.CreatedAt.Add(invitationLifetime)
+
+	filter := bson.M{"documentId": documentID, "email": invitation.Email}
+	opts := options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.After)
+	if err := service.collection.FindOneAndReplace(context.Background(), filter, invitation, opts).Decode(invitation); err != nil {
+		return nil, err
+	}
+
+	body := invitedBy + " shared a GoDoc document with you. Sign up with this email address, then open the following link to access it:\n" +
+		os.Getenv("FRONTEND_URL") + "/invitations/accept?token=" + token
+	if err := service.mail.Send(invitation.Email, "A document was shared with you", body); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+func (service *invitationService) ListInvitations(documentID string) ([]*dto.Invitation, error) {
+	filter := bson.M{"documentId": documentID, "expiresAt": bson.M{"$gt": time.Now()}}
+	cursor, err := service.collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	invitations := []*dto.Invitation{}
+	if err := cursor.All(context.Background(), &invitations); err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+func (service *invitationService) RevokeInvitation(documentID string, invitationID string) error {
+	objectID, err := primitive.ObjectIDFromHex(invitationID)
+	if err != nil {
+		return ErrInvitationNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "documentId": documentID}
+	result, err := service.collection.DeleteOne(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptInvitation consumes the invitation matching the token. It has to be accepted from the
+// invited address, the token proving that the account owner received the mail.
+func (service *invitationService) AcceptInvitation(token string, email string) (*dto.Invitation, error) {
+	var invitation dto.Invitation
+	filter := bson.M{
+		"tokenHash": hashToken(token),
+		"email":     strings.ToLower(email),
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+	err := service.collection.FindOneAndDelete(context.Background(), filter).Decode(&invitation)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidInvitation
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
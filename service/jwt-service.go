@@ -7,15 +7,21 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
+// MFAPendingPurpose marks tokens that only prove the password step of a two-factor login
+const MFAPendingPurpose = "mfa_pending"
+
 type JWTService interface {
 	GenerateToken(name string, admin bool) string
+	GenerateMFAToken(name string) string
 	ValidateToken(tokenString string) (*jwt.Token, error)
+	ValidateMFAToken(tokenString string) (string, error)
 }
 
 // jwtCustomClaims are custom claims extending default ones.
 type jwtCustomClaims struct {
-	Name  string `json:"name"`
-	Admin bool   `json:"admin"`
+	Name    string `json:"name"`
+	Admin   bool   `json:"admin"`
+	Purpose string `json:"purpose,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -43,15 +49,35 @@ func (jwtSrv *jwtService) GenerateToken(username string, admin bool) string {
 
 	// Set custom and standard claims
 	claims := &jwtCustomClaims{
-		username,
-		admin,
-		jwt.StandardClaims{
+		Name:  username,
+		Admin: admin,
+		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(time.Hour * 72).Unix(),
 			Issuer:    jwtSrv.issuer,
 			IssuedAt:  time.Now().Unix(),
 		},
 	}
 
+	return jwtSrv.sign(claims)
+}
+
+// GenerateMFAToken issues a short-lived token that can only be exchanged for a session token
+// together with a valid second factor
+func (jwtSrv *jwtService) GenerateMFAToken(username string) string {
+	claims := &jwtCustomClaims{
+		Name:    username,
+		Purpose: MFAPendingPurpose,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Minute * 5).Unix(),
+			Issuer:    jwtSrv.issuer,
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+
+	return jwtSrv.sign(claims)
+}
+
+func (jwtSrv *jwtService) sign(claims *jwtCustomClaims) string {
 	// Create token with claims
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -73,3 +99,17 @@ func (jwtSrv *jwtService) ValidateToken(tokenString string) (*jwt.Token, error)
 		return []byte(jwtSrv.secretKey), nil
 	})
 }
+
+// ValidateMFAToken returns the user name of a valid MFA pending token
+func (jwtSrv *jwtService) ValidateMFAToken(tokenString string) (string, error) {
+	token, err := jwtSrv.ValidateToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != MFAPendingPurpose {
+		return "", fmt.Errorf("not an MFA pending token")
+	}
+	name, _ := claims["name"].(string)
+	return name, nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LabelService keeps the stars and labels users put on documents. They are stored apart from
+// the documents, one entry per user and document, so that collaborators never see each other's.
+type LabelService interface {
+	GetLabels(documentID string, email string) (*dto.DocumentLabels, error)
+	SetStarred(documentID string, email string, starred bool) (*dto.DocumentLabels, error)
+	UpdateLabels(email string, update dto.LabelUpdate) (*dto.DocumentLabels, error)
+	ListLabels(email string) ([]*dto.LabelCount, error)
+}
+
+type labelService struct {
+	collection *mongo.Collection // MongoDB collection
+}
+
+func NewLabelService(client *mongo.Client, databaseName, collectionName string) LabelService {
+	collection := client.Database(databaseName).Collection(collectionName)
+	_, err := collection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "documentId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "labels", Value: 1}}},
+	})
+	if err != nil {
+		slog.Error("Error creating label indexes", "error", err)
+	}
+	return &labelService{
+		collection: collection,
+	}
+}
+
+func (service *labelService) GetLabels(documentID string, email string) (*dto.DocumentLabels, error) {
+	labels, err := userLabels(service.collection, email, []string{documentID})
+	if err != nil {
+		return nil, err
+	}
+	return labels[documentID], nil
+}
+
+func (service *labelService) SetStarred(documentID string, email string, starred bool) (*dto.DocumentLabels, error) {
+	return service.update(documentID, email, bson.A{bson.M{"$set": bson.M{"starred": starred}}})
+}
+
+func (service *labelService) UpdateLabels(email string, update dto.LabelUpdate) (*dto.DocumentLabels, error) {
+	return service.update(update.DocumentID, email, bson.A{editSet("labels", update)})
+}
+
+// update applies an update pipeline to the user's entry for the document, creating it when
+// needed, and drops the entry once it no longer marks the document
+func (service *labelService) update(documentID string, email string, pipeline bson.A) (*dto.DocumentLabels, error) {
+	ctx := context.Background()
+	filter := bson.M{"email": email, "documentId": documentID}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var labels dto.DocumentLabels
+	if err := service.collection.FindOneAndUpdate(ctx, filter, pipeline, opts).Decode(&labels); err != nil {
+		return nil, err
+	}
+	if labels.Labels == nil {
+		labels.Labels = []string{}
+	}
+	if !labels.Starred && len(labels.Labels) == 0 {
+		filter["starred"] = bson.M{"$ne": true}
+		filter["labels"] = bson.M{"$size": 0}
+		if _, err := service.collection.DeleteOne(ctx, filter); err != nil {
+			return nil, err
+		}
+	}
+	return &labels, nil
+}
+
+// ListLabels returns the labels the user applied, with the number of documents carrying each
+func (service *labelService) ListLabels(email string) ([]*dto.LabelCount, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"email": email}}},
+		{{Key: "$unwind", Value: "$labels"}},
+		{{Key: "$group", Value: bson.M{"_id": "$labels", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := service.collection.Aggregate(context.Background(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+	counts := []*dto.LabelCount{}
+	if err := cursor.All(context.Background(), &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// NormalizeLabels trims labels and drops empty and repeated ones, keeping their order
+func NormalizeLabels(labels []string) []string {
+	normalized := []string{}
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label != "" && !contains(normalized, label) {
+			normalized = append(normalized, label)
+		}
+	}
+	return normalized
+}
+
+// editSet is an update pipeline stage removing and then adding values to an array field in
+// one atomic change. Kept values stay in place and added ones go at the end. The values are
+// passed as literals, a label starting with $ would otherwise read a field of the document.
+func editSet(field string, update dto.LabelUpdate) bson.M {
+	remove := NormalizeLabels(update.Remove)
+	add := []string{}
+	for _, label := range NormalizeLabels(update.Add) {
+		if !contains(remove, label) {
+			add = append(add, label)
+		}
+	}
+	kept := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$" + field, bson.A{}}},
+		"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this", bson.M{"$literal": remove}}}}},
+	}}
+	return bson.M{"$set": bson.M{field: bson.M{"$let": bson.M{
+		"vars": bson.M{"kept": kept},
+		"in": bson.M{"$concatArrays": bson.A{"$$kept", bson.M{"$filter": bson.M{
+			"input": bson.M{"$literal": add},
+			"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this", "$$kept"}}}},
+		}}}},
+	}}}}
+}
+
+// userLabels returns the user's marks on the documents, by document ID. Documents the user
+// never marked get an empty entry.
+func userLabels(collection *mongo.Collection, email string, documentIDs []string) (map[string]*dto.DocumentLabels, error) {
+	filter := bson.M{"email": email, "documentId": bson.M{"$in": documentIDs}}
+	cursor, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*dto.DocumentLabels
+	if err := cursor.All(context.Background(), &entries); err != nil {
+		return nil, err
+	}
+	labels := map[string]*dto.DocumentLabels{}
+	for _, documentID := range documentIDs {
+		labels[documentID] = &dto.DocumentLabels{DocumentID: documentID, Labels: []string{}}
+	}
+	for _, entry := range entries {
+		if entry.Labels == nil {
+			entry.Labels = []string{}
+		}
+		labels[entry.DocumentID] = entry
+	}
+	return labels, nil
+}
+
+// labeledFilter matches the documents the user starred or labelled, nil when neither is asked
+func labeledFilter(collection *mongo.Collection, email string, starred bool, label string) (bson.M, error) {
+	if !starred && label == "" {
+		return nil, nil
+	}
+	filter := bson.M{"email": email}
+	if starred {
+		filter["starred"] = true
+	}
+	if label != "" {
+		filter["labels"] = label
+	}
+	projection := options.Find().SetProjection(bson.M{"documentId": 1})
+	cursor, err := collection.Find(context.Background(), filter, projection)
+	if err != nil {
+		return nil, err
+	}
+	var entries []dto.DocumentLabels
+	if err := cursor.All(context.Background(), &entries); err != nil {
+		return nil, err
+	}
+	ids := []primitive.ObjectID{}
+	for _, entry := range entries {
+		if objectID, err := primitive.ObjectIDFromHex(entry.DocumentID); err == nil {
+			ids = append(ids, objectID)
+		}
+	}
+	return bson.M{"_id": bson.M{"$in": ids}}, nil
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"log/slog"
 	"golang.org/x/crypto/bcrypt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -10,6 +11,7 @@ import (
 
 type LoginService interface {
 	Login(username string, password string) bool
+	IsAdmin(email string) bool
 }
 
 type loginService struct {
@@ -24,7 +26,6 @@ func NewLoginService(client *mongo.Client, databaseName, collectionName string)
 }
 
 func (service *loginService) Login(email string, password string) bool {
-	print("LoginService.Login() called\n")
 	filter := bson.D{{Key: "email", Value: email}}
 
 	var result struct {
@@ -34,7 +35,7 @@ func (service *loginService) Login(email string, password string) bool {
 	err := service.collection.FindOne(context.Background(), filter).Decode(&result)
 	if err != nil {
 		// Handle error (e.g., user not found)
-		print("LoginService.Login() error: " + err.Error() + "\n")
+		slog.Debug("Login failed", "error", err)
 		return false
 	}
 
@@ -42,10 +43,24 @@ func (service *loginService) Login(email string, password string) bool {
 	err = bcrypt.CompareHashAndPassword([]byte(result.PasswordHash), []byte(password))
 	if err != nil {
 		// Passwords don't match
-		print("LoginService.Login() passwords don't match\n")
+		slog.Debug("Login failed, the password doesn't match")
 		return false
 	}
 
 	// Passwords match
 	return true
 }
+
+func (service *loginService) IsAdmin(email string) bool {
+	filter := bson.D{{Key: "email", Value: email}}
+
+	var result struct {
+		Admin bool `bson:"admin"`
+	}
+
+	err := service.collection.FindOne(context.Background(), filter).Decode(&result)
+	if err != nil {
+		return false
+	}
+	return result.Admin
+}
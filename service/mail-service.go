@@ -0,0 +1,56 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"os"
+)
+
+type MailService interface {
+	Send(to string, subject string, body string) error
+}
+
+type mailService struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewMailService sends mail through the SMTP server configured by the SMTP_* environment
+// variables. Without SMTP_HOST the messages are only written to the log, which is enough
+// for local development.
+func NewMailService() MailService {
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@khallihub.com"
+	}
+	return &mailService{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     port,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+	}
+}
+
+func (service *mailService) Send(to string, subject string, body string) error {
+	if service.host == "" {
+		// The body may carry a verification token, it isn't logged
+		slog.Info("Mail not sent, SMTP_HOST isn't set", "to", to, "subject", subject)
+		return nil
+	}
+
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", service.from, to, subject, body)
+	var auth smtp.Auth
+	if service.username != "" {
+		auth = smtp.PlainAuth("", service.username, service.password, service.host)
+	}
+	return smtp.SendMail(service.host+":"+service.port, auth, service.from, []string{to}, []byte(message))
+}
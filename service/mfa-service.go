@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	mfaIssuer          = "GoDoc"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	mfaPolicyID        = "mfa"
+)
+
+var (
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANoPending      = errors.New("no pending two-factor enrollment")
+	ErrMFAInvalidCode    = errors.New("invalid two-factor code")
+	ErrMFAPolicyRequired = errors.New("two-factor authentication is required by policy")
+)
+
+type MFAService interface {
+	IsEnabled(email string) bool
+	IsRequired() bool
+	Enroll(email string) (dto.MFAEnrollment, error)
+	ConfirmEnrollment(email string, code string) ([]string, error)
+	Verify(email string, code string) bool
+	RegenerateRecoveryCodes(email string, code string) ([]string, error)
+	Disable(email string, code string) error
+	GetPolicy() (dto.MFAPolicy, error)
+	SetPolicy(policy dto.MFAPolicy) error
+}
+
+type mfaService struct {
+	collection *mongo.Collection // MongoDB collection holding the users
+	settings   *mongo.Collection // MongoDB collection holding server wide settings
+}
+
+func NewMFAService(client *mongo.Client, databaseName, collectionName string) MFAService {
+	database := client.Database(databaseName)
+	return &mfaService{
+		collection: database.Collection(collectionName),
+		settings:   database.Collection("settings"),
+	}
+}
+
+func (service *mfaService) findMFA(email string) (dto.MFA, error) {
+	var result struct {
+		MFA dto.MFA `bson:"mfa"`
+	}
+	filter := bson.M{"email": email}
+	err := service.collection.FindOne(context.Background(), filter).Decode(&result)
+	return result.MFA, err
+}
+
+func (service *mfaService) IsEnabled(email string) bool {
+	mfa, err := service.findMFA(email)
+	return err == nil && mfa.Enabled
+}
+
+func (service *mfaService) IsRequired() bool {
+	policy, err := service.GetPolicy()
+	return err == nil && policy.Required
+}
+
+func (service *mfaService) Enroll(email string) (dto.MFAEnrollment, error) {
+	mfa, err := service.findMFA(email)
+	if err != nil {
+		return dto.MFAEnrollment{}, err
+	}
+	if mfa.Enabled {
+		return dto.MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return dto.MFAEnrollment{}, err
+	}
+
+	// The secret only becomes active once the user proves they can generate codes for it
+	filter := bson.M{"email": email}
+	update := bson.M{"$set": bson.M{"mfa.pendingSecret": secret}}
+	if _, err := service.collection.UpdateOne(context.Background(), filter, update); err != nil {
+		return dto.MFAEnrollment{}, err
+	}
+
+	return dto.MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: TOTPProvisioningURI(mfaIssuer, email, secret),
+	}, nil
+}
+
+func (service *mfaService) ConfirmEnrollment(email string, code string) ([]string, error) {
+	mfa, err := service.findMFA(email)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if mfa.PendingSecret == "" {
+		return nil, ErrMFANoPending
+	}
+	step, ok := ValidateTOTPCode(mfa.PendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrMFAInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"email": email, "mfa.pendingSecret": mfa.PendingSecret}
+	update := bson.M{
+		"$set": bson.M{
+			"mfa.enabled":       true,
+			"mfa.secret":        mfa.PendingSecret,
+			"mfa.recoveryCodes": hashes,
+			"mfa.lastUsedStep":  step,
+		},
+		"$unset": bson.M{"mfa.pendingSecret": ""},
+	}
+	result, err := service.collection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrMFANoPending
+	}
+	return codes, nil
+}
+
+func (service *mfaService) Verify(email string, code string) bool {
+	mfa, err := service.findMFA(email)
+	if err != nil || !mfa.Enabled {
+		return false
+	}
+
+	if step, ok := ValidateTOTPCode(mfa.Secret, code, time.Now()); ok {
+		// Only accept each time step once so an intercepted code can't be replayed
+		filter := bson.M{"email": email, "mfa.lastUsedStep": bson.M{"$lt": step}}
+		update := bson.M{"$set": bson.M{"mfa.lastUsedStep": step}}
+		result, err := service.collection.UpdateOne(context.Background(), filter, update)
+		return err == nil && result.ModifiedCount == 1
+	}
+
+	// Fall back to the recovery codes, each of which can only be used once
+	filter := bson.M{"email": email, "mfa.recoveryCodes": hashRecoveryCode(code)}
+	update := bson.M{"$pull": bson.M{"mfa.recoveryCodes": hashRecoveryCode(code)}}
+	result, err := service.collection.UpdateOne(context.Background(), filter, update)
+	return err == nil && result.ModifiedCount == 1
+}
+
+func (service *mfaService) RegenerateRecoveryCodes(email string, code string) ([]string, error) {
+	if !service.Verify(email, code) {
+		return nil, ErrMFAInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"email": email}
+	update := bson.M{"$set": bson.M{"mfa.recoveryCodes": hashes}}
+	if _, err := service.collection.UpdateOne(context.Background(), filter, update); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (service *mfaService) Disable(email string, code string) error {
+	if !service.IsEnabled(email) {
+		return ErrMFANotEnabled
+	}
+	if service.IsRequired() {
+		return ErrMFAPolicyRequired
+	}
+	if !service.Verify(email, code) {
+		return ErrMFAInvalidCode
+	}
+
+	filter := bson.M{"email": email}
+	update := bson.M{"$unset": bson.M{"mfa": ""}}
+	_, err := service.collection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+func (service *mfaService) GetPolicy() (dto.MFAPolicy, error) {
+	var policy dto.MFAPolicy
+	filter := bson.M{"_id": mfaPolicyID}
+	err := service.settings.FindOne(context.Background(), filter).Decode(&policy)
+	if err == mongo.ErrNoDocuments {
+		return dto.MFAPolicy{}, nil
+	}
+	return policy, err
+}
+
+func (service *mfaService) SetPolicy(policy dto.MFAPolicy) error {
+	filter := bson.M{"_id": mfaPolicyID}
+	update := bson.M{"$set": bson.M{"required": policy.Required}}
+	_, err := service.settings.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// generateRecoveryCodes returns the plain codes to show the user once, and the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		// Each character is drawn uniformly, a byte modulo the alphabet would favor its start
+		raw := make([]byte, recoveryCodeLength)
+		for j := range raw {
+			index, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return nil, nil, err
+			}
+			raw[j] = alphabet[index.Int64()]
+		}
+		codes[i] = string(raw[:recoveryCodeLength/2]) + "-" + string(raw[recoveryCodeLength/2:])
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/khallihub/godoc/dto"
+)
+
+// snippetLength is the number of characters of body text shown around the first match
+const snippetLength = 160
+
+// PlainText extracts the text of a document body from its delta ops, embeds such as images
+// carry no text and are skipped
+func PlainText(data dto.DocumentData) string {
+	var text strings.Builder
+	for _, op := range data.Ops {
+		if insert, ok := op["insert"].(string); ok {
+			text.WriteString(insert)
+		}
+	}
+	return text.String()
+}
+
+// CountText returns the number of words and characters of a text, line breaks aside
+func CountText(text string) (int, int) {
+	chars := 0
+	for _, r := range text {
+		if r != '\n' && r != '\r' {
+			chars++
+		}
+	}
+	return len(strings.Fields(text)), chars
+}
+
+// SearchTerms splits a search query into the lower-cased words it looks for, leaving out
+// quotes and the terms the query excludes with a leading '-'
+func SearchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") {
+			continue
+		}
+		term := strings.ToLower(strings.Trim(field, "\""))
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Snippet returns an excerpt of text around the first occurrence of any term, HTML escaped
+// with every occurrence highlighted. Without a match it is the start of the text.
+func Snippet(text string, terms []string) string {
+	// Line breaks and indentation mean nothing in a one line excerpt
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		// Lower-casing changed the length, fall back to matching the text as is
+		lower = runes
+	}
+
+	matches := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		pattern := []rune(term)
+		for i := 0; i+len(pattern) <= len(lower); i++ {
+			if !hasRunePrefix(lower[i:], pattern) {
+				continue
+			}
+			for j := i; j < i+len(pattern); j++ {
+				matches[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start := 0
+	if first > snippetLength/4 {
+		start = first - snippetLength/4
+		// Don't cut the excerpt in the middle of a word
+		for start < first && !unicode.IsSpace(runes[start]) {
+			start++
+		}
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var snippet strings.Builder
+	if start > 0 {
+		snippet.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && matches[j] == matches[i] {
+			j++
+		}
+		part := html.EscapeString(string(runes[i:j]))
+		if matches[i] {
+			part = "<mark>" + part + "</mark>"
+		}
+		snippet.WriteString(part)
+		i = j
+	}
+	if end < len(runes) {
+		snippet.WriteString("…")
+	}
+	return snippet.String()
+}
+
+func hasRunePrefix(runes []rune, prefix []rune) bool {
+	if len(prefix) == 0 || len(runes) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if runes[i] != r {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrShareLinkNotFound = errors.New("share link not found or expired")
+	ErrShareLinkPassword = errors.New("share link password required or invalid")
+	ErrShareLinkDomain   = errors.New("share link is restricted to another domain")
+	ErrShareLinkSignIn   = errors.New("share link requires signing in")
+)
+
+type ShareLinkService interface {
+	CreateLink(createdBy string, request dto.CreateShareLink) (string, *dto.ShareLink, error)
+	ListLinks(documentID string) ([]*dto.ShareLink, error)
+	RevokeLink(documentID string, linkID string) error
+	Resolve(token string, password string, email string) (*dto.ShareLink, error)
+}
+
+type shareLinkService struct {
+	collection *mongo.Collection // MongoDB collection
+}
+
+func NewShareLinkService(client *mongo.Client, databaseName, collectionName string) ShareLinkService {
+	collection := client.Database(databaseName).Collection(collectionName)
+	return &shareLinkService{
+		collection: collection,
+	}
+}
+
+func (service *shareLinkService) CreateLink(createdBy string, request dto.CreateShareLink) (string, *dto.ShareLink, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	link := &dto.ShareLink{
+		DocumentID: request.DocumentID,
+		TokenHash:  hashToken(token),
+		Role:       request.Role,
+		CreatedBy:  createdBy,
+		CreatedAt:  time.Now().UTC(),
+		Domain:     strings.ToLower(strings.TrimPrefix(request.Domain, "@")),
+	}
+	if request.ExpiresInHours > 0 {
+		expiresAt := link.CreatedAt.Add(time.Duration(request.ExpiresInHours) * time.Hour)
+		link.ExpiresAt = &expiresAt
+	}
+	if request.Password != "" {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", nil, err
+		}
+		link.PasswordHash = string(hashedPassword)
+		link.HasPassword = true
+	}
+
+	result, err := service.collection.InsertOne(context.Background(), link)
+	if err != nil {
+		return "", nil, err
+	}
+	link.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	return token, link, nil
+}
+
+func (service *shareLinkService) ListLinks(documentID string) ([]*dto.ShareLink, error) {
+	filter := bson.M{"documentId": documentID}
+	cursor, err := service.collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	links := []*dto.ShareLink{}
+	if err := cursor.All(context.Background(), &links); err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		link.HasPassword = link.PasswordHash != ""
+	}
+	return links, nil
+}
+
+func (service *shareLinkService) RevokeLink(documentID string, linkID string) error {
+	objectID, err := primitive.ObjectIDFromHex(linkID)
+	if err != nil {
+		return ErrShareLinkNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "documentId": documentID}
+	result, err := service.collection.DeleteOne(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+// Resolve returns the link matching the token if the caller may use it. Email is empty
+// for anonymous callers.
+func (service *shareLinkService) Resolve(token string, password string, email string) (*dto.ShareLink, error) {
+	var link dto.ShareLink
+	filter := bson.M{"tokenHash": hashToken(token)}
+	err := service.collection.FindOne(context.Background(), filter).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrShareLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if link.ExpiresAt != nil && link.ExpiresAt.Before(time.Now()) {
+		return nil, ErrShareLinkNotFound
+	}
+	if link.PasswordHash != "" {
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			return nil, ErrShareLinkPassword
+		}
+		link.HasPassword = true
+	}
+	if link.Domain != "" {
+		if email == "" {
+			return nil, ErrShareLinkSignIn
+		}
+		if !strings.HasSuffix(strings.ToLower(email), "@"+link.Domain) {
+			return nil, ErrShareLinkDomain
+		}
+	}
+	return &link, nil
+}
@@ -25,8 +25,6 @@ func NewSignupService(client *mongo.Client, databaseName, collectionName string)
 }
 
 func (service *signupService) Signup(username string, email string, password string) error {
-	print("SignupService.Signup called\n") 
-
 	// Check if the username already exists
 	filter := bson.D{{Key: "email", Value: email}}
 	var existingUser struct{}
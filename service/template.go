@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+// placeholderDateFormat is how {{date}} is filled in documents created from templates
+const placeholderDateFormat = "2006-01-02"
+
+// SetTemplate offers a document as a template or, with a nil template, withdraws it
+func (service *documentService) SetTemplate(documentID string, template *dto.Template) error {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return ErrDocumentNotFound
+	}
+	update := bson.M{"$unset": bson.M{"template": ""}}
+	if template != nil {
+		update = bson.M{"$set": bson.M{"template": template}}
+	}
+	result, err := service.collection.UpdateOne(service.context(), bson.M{"_id": objectID, "deletedAt": notTrashed}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDocumentNotFound
+	}
+	return nil
+}
+
+// ListTemplates returns the templates offered to the user, by title
+func (service *documentService) ListTemplates(email string) ([]*dto.TemplateItem, error) {
+	filter, err := service.templateFilter(email)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().
+		SetProjection(bson.M{"title": 1, "template": 1, "updatedAt": 1}).
+		SetSort(bson.D{{Key: "title", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := service.collection.Find(service.context(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	templates := []*dto.TemplateItem{}
+	if err := cursor.All(service.context(), &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// CreateFromTemplate starts a new document owned by the user from a template offered to them,
+// filling the placeholders of its title and body
+func (service *documentService) CreateFromTemplate(templateID string, email string, title string) (string, error) {
+	objectID, err := primitive.ObjectIDFromHex(templateID)
+	if err != nil {
+		return "", ErrTemplateNotFound
+	}
+	filter, err := service.templateFilter(email)
+	if err != nil {
+		return "", err
+	}
+	filter["_id"] = objectID
+	var template dto.Document
+	err = service.collection.FindOne(service.context(), filter).Decode(&template)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", ErrTemplateNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if title == "" {
+		title = template.Title
+	}
+	values, err := service.placeholderValues(email, time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	return service.createCopy(email, FillPlaceholders(title, values), FillDataPlaceholders(template.Data, values), template.Tags)
+}
+
+// DuplicateDocument copies the title, body and tags of a document into a new document owned
+// by the user. Nothing else carries over: the copy is shared with nobody and has no opens,
+// labels or template marking.
+func (service *documentService) DuplicateDocument(documentID string, email string, title string) (string, error) {
+	document, err := service.GetDocumentByID(documentID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", ErrDocumentNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if title == "" {
+		title = "Copy of " + document.Title
+	}
+	return service.createCopy(email, title, document.Data, document.Tags)
+}
+
+func (service *documentService) createCopy(author string, title string, data dto.DocumentData, tags []string) (string, error) {
+	now := time.Now().UTC()
+	fields := textFields(data)
+	newDocument := bson.D{
+		{Key: "author", Value: author},
+		{Key: "acl", Value: []dto.ACLEntry{{Principal: author, Role: dto.RoleOwner}}},
+		{Key: "title", Value: title},
+		{Key: "data", Value: data},
+		{Key: "createdAt", Value: now},
+		{Key: "updatedAt", Value: now},
+		{Key: "lastEditedBy", Value: author},
+		{Key: "text", Value: fields["text"]},
+		{Key: "wordCount", Value: fields["wordCount"]},
+		{Key: "charCount", Value: fields["charCount"]},
+	}
+	if len(tags) > 0 {
+		newDocument = append(newDocument, bson.E{Key: "tags", Value: tags})
+	}
+	result, err := service.collection.InsertOne(service.context(), newDocument)
+	if err != nil {
+		return "", err
+	}
+	insertedID, ok := result.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("failed to convert InsertedID to string")
+	}
+	return insertedID.Hex(), nil
+}
+
+// templateFilter matches the templates offered to the user: theirs, their groups' and the
+// global ones
+func (service *documentService) templateFilter(email string) (bson.M, error) {
+	principals, err := service.Principals(email)
+	if err != nil {
+		return nil, err
+	}
+	groupIDs := []string{}
+	for _, principal := range principals {
+		if strings.HasPrefix(principal, dto.GroupPrincipalPrefix) {
+			groupIDs = append(groupIDs, strings.TrimPrefix(principal, dto.GroupPrincipalPrefix))
+		}
+	}
+	return bson.M{
+		"deletedAt": notTrashed,
+		"$or": []bson.M{
+			{"template.scope": dto.TemplateScopeGlobal},
+			{"template.scope": dto.TemplateScopeTeam, "template.groupId": bson.M{"$in": groupIDs}},
+			{"template.scope": dto.TemplateScopeUser, "template.markedBy": email},
+		},
+	}, nil
+}
+
+// placeholderValues are the values of the placeholders for a document the user creates: the
+// date and their display name, or their email when they have none
+func (service *documentService) placeholderValues(email string, now time.Time) (map[string]string, error) {
+	var user dto.Profile
+	err := service.users.FindOne(service.context(), bson.M{"email": email}).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	author := user.DisplayName
+	if author == "" {
+		author = email
+	}
+	return map[string]string{
+		"date":   now.Format(placeholderDateFormat),
+		"author": author,
+		"email":  email,
+	}, nil
+}
+
+// FillPlaceholders replaces the {{name}} placeholders of a text with their values, unknown
+// placeholders are left as they are
+func FillPlaceholders(text string, values map[string]string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+	replacements := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		replacements = append(replacements, "{{"+name+"}}", value)
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// FillDataPlaceholders fills the placeholders of the text inserted by a document body. A
+// placeholder split across differently formatted runs of text is not recognized.
+func FillDataPlaceholders(data dto.DocumentData, values map[string]string) dto.DocumentData {
+	filled := dto.DocumentData{Ops: make([]map[string]interface{}, len(data.Ops))}
+	for i, op := range data.Ops {
+		copied := make(map[string]interface{}, len(op))
+		for key, value := range op {
+			copied[key] = value
+		}
+		if text, ok := op["insert"].(string); ok {
+			copied["insert"] = FillPlaceholders(text, values)
+		}
+		filled.Ops[i] = copied
+	}
+	return filled
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PersonalAccessTokenPrefix distinguishes personal access tokens from session JWTs
+const PersonalAccessTokenPrefix = "gdp_"
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrInvalidToken  = errors.New("invalid or expired token")
+)
+
+type TokenService interface {
+	CreateToken(owner string, request dto.CreateToken) (string, *dto.PersonalAccessToken, error)
+	ListTokens(owner string) ([]*dto.PersonalAccessToken, error)
+	RevokeToken(owner string, tokenID string) error
+	Authenticate(token string) (*dto.PersonalAccessToken, error)
+}
+
+type tokenService struct {
+	collection *mongo.Collection // MongoDB collection
+	users      *mongo.Collection // MongoDB collection holding the owners of the tokens
+}
+
+func NewTokenService(client *mongo.Client, databaseName, collectionName string) TokenService {
+	database := client.Database(databaseName)
+	collection := database.Collection(collectionName)
+	// Every authenticated request looks a token up by its hash
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		slog.Error("Error creating token index", "error", err)
+	}
+	return &tokenService{
+		collection: collection,
+		users:      database.Collection("users"),
+	}
+}
+
+func (service *tokenService) CreateToken(owner string, request dto.CreateToken) (string, *dto.PersonalAccessToken, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, err
+	}
+	secret := PersonalAccessTokenPrefix + hex.EncodeToString(raw)
+
+	token := &dto.PersonalAccessToken{
+		Owner:     owner,
+		Name:      request.Name,
+		Prefix:    secret[:len(PersonalAccessTokenPrefix)+6],
+		TokenHash: hashToken(secret),
+		Scope:     request.Scope,
+		Documents: request.Documents,
+		CreatedAt: time.Now().UTC(),
+	}
+	if request.ExpiresInDays > 0 {
+		expiresAt := token.CreatedAt.Add(time.Duration(request.ExpiresInDays) * 24 * time.Hour)
+		token.ExpiresAt = &expiresAt
+	}
+
+	result, err := service.collection.InsertOne(context.Background(), token)
+	if err != nil {
+		return "", nil, err
+	}
+	token.ID = result.InsertedID.(primitive.ObjectID).Hex()
+
+	// The plain token is only ever returned here, afterwards only its hash is known
+	return secret, token, nil
+}
+
+func (service *tokenService) ListTokens(owner string) ([]*dto.PersonalAccessToken, error) {
+	filter := bson.M{"owner": owner}
+	cursor, err := service.collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	tokens := []*dto.PersonalAccessToken{}
+	if err := cursor.All(context.Background(), &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (service *tokenService) RevokeToken(owner string, tokenID string) error {
+	objectID, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return ErrTokenNotFound
+	}
+
+	filter := bson.M{"_id": objectID, "owner": owner}
+	result, err := service.collection.DeleteOne(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+func (service *tokenService) Authenticate(secret string) (*dto.PersonalAccessToken, error) {
+	if !strings.HasPrefix(secret, PersonalAccessTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	var token dto.PersonalAccessToken
+	filter := bson.M{"tokenHash": hashToken(secret)}
+	err := service.collection.FindOne(context.Background(), filter).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+	// Tokens are deleted with their owner, this also catches those left behind
+	owners, err := service.users.CountDocuments(context.Background(), bson.M{"email": token.Owner}, options.Count().SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if owners == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	update := bson.M{"$set": bson.M{"lastUsedAt": time.Now().UTC()}}
+	if _, err := service.collection.UpdateOne(context.Background(), filter, update); err != nil {
+		slog.Error("Error updating token usage", "error", err)
+	}
+	return &token, nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notTrashed matches the documents outside of the trash, the only ones anybody can open
+var notTrashed = bson.M{"$exists": false}
+
+// TrashDocument moves a document to the trash of its owners, where it stays for the retention
+// period unless it's restored
+func (service *documentService) TrashDocument(documentID string, email string, retention time.Duration) error {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return ErrDocumentNotFound
+	}
+	now := time.Now().UTC()
+	filter := bson.M{"_id": objectID, "deletedAt": notTrashed}
+	update := bson.M{"$set": bson.M{"deletedAt": now, "deletedBy": email, "purgeAt": now.Add(retention)}}
+	result, err := service.collection.UpdateOne(service.context(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDocumentNotFound
+	}
+	return nil
+}
+
+// RestoreDocument takes a document the user owns out of the trash
+func (service *documentService) RestoreDocument(documentID string, email string) error {
+	filter, err := service.trashedFilter(documentID, email)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$unset": bson.M{"deletedAt": "", "deletedBy": "", "purgeAt": ""}}
+	result, err := service.collection.UpdateOne(service.context(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDocumentNotFound
+	}
+	return nil
+}
+
+// DeleteDocument deletes a document the user owns from the trash for good
+func (service *documentService) DeleteDocument(documentID string, email string) (bool, error) {
+	filter, err := service.trashedFilter(documentID, email)
+	if errors.Is(err, ErrDocumentNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	result, err := service.collection.DeleteOne(service.context(), filter)
+	if err != nil {
+		return false, err
+	}
+	if result.DeletedCount == 0 {
+		return false, nil
+	}
+	return true, service.deleteDependents(service.context(), []string{documentID})
+}
+
+// ListTrash returns the documents in the trash of the user, most recently deleted first
+func (service *documentService) ListTrash(email string) ([]*dto.TrashedDocument, error) {
+	principals, err := service.Principals(email)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"deletedAt": bson.M{"$exists": true}, "acl": ownedBy(principals)}
+	opts := options.Find().
+		SetProjection(bson.M{"title": 1, "author": 1, "deletedAt": 1, "deletedBy": 1, "purgeAt": 1}).
+		SetSort(bson.D{{Key: "deletedAt", Value: -1}})
+	cursor, err := service.collection.Find(service.context(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	documents := []*dto.TrashedDocument{}
+	if err := cursor.All(service.context(), &documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// PurgeTrash deletes for good the documents whose retention period is over, returning their IDs
+func (service *documentService) PurgeTrash(now time.Time) ([]string, error) {
+	ctx := service.context()
+	filter := bson.M{"purgeAt": bson.M{"$lte": now}}
+	cursor, err := service.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var expired []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &expired); err != nil {
+		return nil, err
+	}
+	if len(expired) == 0 {
+		return []string{}, nil
+	}
+
+	objectIDs := make([]primitive.ObjectID, len(expired))
+	documentIDs := make([]string, len(expired))
+	for i, document := range expired {
+		objectIDs[i] = document.ID
+		documentIDs[i] = document.ID.Hex()
+	}
+	// A document restored in the meantime has no purge time any more and is kept
+	filter = bson.M{"_id": bson.M{"$in": objectIDs}, "purgeAt": bson.M{"$lte": now}}
+	if _, err := service.collection.DeleteMany(ctx, filter); err != nil {
+		return nil, err
+	}
+	return documentIDs, service.deleteDependents(ctx, documentIDs)
+}
+
+// deleteDependents removes what only made sense with the deleted documents: the users' stars
+// and labels, share links and pending invitations
+func (service *documentService) deleteDependents(ctx context.Context, documentIDs []string) error {
+	filter := bson.M{"documentId": bson.M{"$in": documentIDs}}
+	for _, collection := range []*mongo.Collection{service.labels, service.shareLinks, service.invitations} {
+		if _, err := collection.DeleteMany(ctx, filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trashedFilter matches the document in the trash when the user is one of its owners
+func (service *documentService) trashedFilter(documentID string, email string) (bson.M, error) {
+	objectID, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return nil, ErrDocumentNotFound
+	}
+	principals, err := service.Principals(email)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"_id": objectID, "deletedAt": bson.M{"$exists": true}, "acl": ownedBy(principals)}, nil
+}
+
+// ownedBy matches access lists where one of the principals is an owner
+func ownedBy(principals []string) bson.M {
+	return bson.M{"$elemMatch": bson.M{"principal": bson.M{"$in": principals}, "role": dto.RoleOwner}}
+}
@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const emailChangeLifetime = 24 * time.Hour
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidPassword    = errors.New("invalid password")
+	ErrEmailTaken         = errors.New("email is already in use")
+	ErrInvalidVerifyToken = errors.New("invalid or expired verification token")
+)
+
+type UserService interface {
+	GetUser(email string) (*dto.User, error)
+	GetProfile(email string) (*dto.Profile, error)
+	UpdateProfile(email string, update dto.ProfileUpdate) (*dto.User, error)
+	RequestEmailChange(email string, password string, newEmail string) error
+	VerifyEmailChange(token string) (string, error)
+	DeleteUser(email string, password string, transferTo string) ([]string, error)
+}
+
+type userService struct {
+	collection *mongo.Collection // MongoDB collection holding the users
+	documents  *mongo.Collection // MongoDB collection holding the documents the users collaborate on
+	groups     *mongo.Collection // MongoDB collection holding the groups users are members of
+	folders    *mongo.Collection // MongoDB collection holding the folders users organize documents in
+	labels     *mongo.Collection // MongoDB collection holding the users' own stars and labels
+	tokens     *mongo.Collection // MongoDB collection holding the users' personal access tokens
+	mail       MailService
+}
+
+func NewUserService(client *mongo.Client, databaseName, collectionName string, mail MailService) UserService {
+	database := client.Database(databaseName)
+	return &userService{
+		collection: database.Collection(collectionName),
+		documents:  database.Collection("documents"),
+		groups:     database.Collection("groups"),
+		folders:    database.Collection("folders"),
+		labels:     database.Collection("documentlabels"),
+		tokens:     database.Collection("tokens"),
+		mail:       mail,
+	}
+}
+
+func (service *userService) GetUser(email string) (*dto.User, error) {
+	var user dto.User
+	filter := bson.M{"email": email}
+	err := service.collection.FindOne(context.Background(), filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (service *userService) GetProfile(email string) (*dto.Profile, error) {
+	var profile dto.Profile
+	filter := bson.M{"email": email}
+	// Only project the public fields so the password hash never leaves the database
+	projection := options.FindOne().SetProjection(bson.M{"email": 1, "username": 1, "avatarUrl": 1})
+	err := service.collection.FindOne(context.Background(), filter, projection).Decode(&profile)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+func (service *userService) UpdateProfile(email string, update dto.ProfileUpdate) (*dto.User, error) {
+	fields := bson.M{}
+	if update.DisplayName != nil {
+		fields["username"] = *update.DisplayName
+	}
+	if update.AvatarURL != nil {
+		fields["avatarUrl"] = *update.AvatarURL
+	}
+	if len(fields) > 0 {
+		filter := bson.M{"email": email}
+		result, err := service.collection.UpdateOne(context.Background(), filter, bson.M{"$set": fields})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrUserNotFound
+		}
+	}
+	return service.GetUser(email)
+}
+
+func (service *userService) RequestEmailChange(email string, password string, newEmail string) error {
+	if err := service.checkPassword(email, password); err != nil {
+		return err
+	}
+	if _, err := service.GetUser(newEmail); err == nil {
+		return ErrEmailTaken
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(raw)
+
+	change := dto.EmailChange{
+		Email:     newEmail,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(emailChangeLifetime),
+	}
+	filter := bson.M{"email": email}
+	update := bson.M{"$set": bson.M{"emailChange": change}}
+	if _, err := service.collection.UpdateOne(context.Background(), filter, update); err != nil {
+		return err
+	}
+
+	// The change only takes effect once the owner of the new address proves they received this
+	body := "Confirm your new GoDoc email address with the following link:\n" +
+		os.Getenv("FRONTEND_URL") + "/verify-email?token=" + token
+	return service.mail.Send(newEmail, "Confirm your new email address", body)
+}
+
+func (service *userService) VerifyEmailChange(token string) (string, error) {
+	var user dto.User
+	filter := bson.M{
+		"emailChange.tokenHash": hashToken(token),
+		"emailChange.expiresAt": bson.M{"$gt": time.Now()},
+	}
+	err := service.collection.FindOne(context.Background(), filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrInvalidVerifyToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	oldEmail, newEmail := user.Email, user.EmailChange.Email
+	if _, err := service.GetUser(newEmail); err == nil {
+		return "", ErrEmailTaken
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"email": newEmail},
+		"$unset": bson.M{"emailChange": ""},
+	}
+	if _, err := service.collection.UpdateOne(context.Background(), filter, update); err != nil {
+		return "", err
+	}
+
+	// Documents reference users by email, so follow the account to its new address
+	if err := service.renameCollaborator(oldEmail, newEmail); err != nil {
+		return "", err
+	}
+	return newEmail, nil
+}
+
+func (service *userService) DeleteUser(email string, password string, transferTo string) ([]string, error) {
+	if err := service.checkPassword(email, password); err != nil {
+		return nil, err
+	}
+	if transferTo != "" {
+		if _, err := service.GetUser(transferTo); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	owned := bson.M{"acl": bson.M{"$elemMatch": bson.M{"principal": email, "role": dto.RoleOwner}}}
+	cursor, err := service.documents.Find(ctx, owned, options.Find().SetProjection(bson.M{"acl": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var ownedDocuments []dto.Document
+	if err := cursor.All(ctx, &ownedDocuments); err != nil {
+		return nil, err
+	}
+
+	documentIDs := []string{}
+	for _, document := range ownedDocuments {
+		// Documents with other owners simply lose this one below
+		if CountOwners(document.ACL) > 1 {
+			continue
+		}
+		objectID, err := primitive.ObjectIDFromHex(document.ID)
+		if err != nil {
+			return nil, err
+		}
+		if transferTo == "" {
+			if _, err := service.documents.DeleteOne(ctx, bson.M{"_id": objectID}); err != nil {
+				return nil, err
+			}
+			documentIDs = append(documentIDs, document.ID)
+			continue
+		}
+
+		acl := []dto.ACLEntry{{Principal: transferTo, Role: dto.RoleOwner}}
+		for _, entry := range document.ACL {
+			if entry.Principal != transferTo {
+				acl = append(acl, entry)
+			}
+		}
+		update := bson.M{"$set": bson.M{"acl": acl, "author": transferTo}}
+		if _, err := service.documents.UpdateOne(ctx, bson.M{"_id": objectID}, update); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := revokePrincipal(ctx, email, service.documents, service.folders); err != nil {
+		return nil, err
+	}
+	opened := bson.M{"opens.email": email}
+	update := bson.M{"$pull": bson.M{"opens": bson.M{"email": email}}}
+	if _, err := service.documents.UpdateMany(ctx, opened, update); err != nil {
+		return nil, err
+	}
+	if _, err := service.labels.DeleteMany(ctx, bson.M{"email": email}); err != nil {
+		return nil, err
+	}
+	if _, err := service.tokens.DeleteMany(ctx, bson.M{"owner": email}); err != nil {
+		return nil, err
+	}
+
+	memberships := bson.M{"members": email}
+	update = bson.M{"$pull": bson.M{"members": email, "admins": email}}
+	if _, err := service.groups.UpdateMany(ctx, memberships, update); err != nil {
+		return nil, err
+	}
+
+	if _, err := service.collection.DeleteOne(ctx, bson.M{"email": email}); err != nil {
+		return nil, err
+	}
+	return documentIDs, nil
+}
+
+func (service *userService) checkPassword(email string, password string) error {
+	user, err := service.GetUser(email)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+func (service *userService) renameCollaborator(oldEmail string, newEmail string) error {
+	ctx := context.Background()
+	if _, err := service.documents.UpdateMany(ctx, bson.M{"author": oldEmail}, bson.M{"$set": bson.M{"author": newEmail}}); err != nil {
+		return err
+	}
+	arrayFilters := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"entry.principal": oldEmail}},
+	})
+	for _, field := range []string{"acl", "inheritedAcl"} {
+		filter := bson.M{field + ".principal": oldEmail}
+		update := bson.M{"$set": bson.M{field + ".$[entry].principal": newEmail}}
+		for _, collection := range []*mongo.Collection{service.documents, service.folders} {
+			if _, err := collection.UpdateMany(ctx, filter, update, arrayFilters); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := service.documents.UpdateMany(ctx, bson.M{"lastEditedBy": oldEmail}, bson.M{"$set": bson.M{"lastEditedBy": newEmail}}); err != nil {
+		return err
+	}
+	filter := bson.M{"opens.email": oldEmail}
+	update := bson.M{"$set": bson.M{"opens.$[open].email": newEmail}}
+	arrayFilters = options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"open.email": oldEmail}},
+	})
+	if _, err := service.documents.UpdateMany(ctx, filter, update, arrayFilters); err != nil {
+		return err
+	}
+	if _, err := service.labels.UpdateMany(ctx, bson.M{"email": oldEmail}, bson.M{"$set": bson.M{"email": newEmail}}); err != nil {
+		return err
+	}
+	// Tokens keep acting for the account, not for whoever registers the old address next
+	if _, err := service.tokens.UpdateMany(ctx, bson.M{"owner": oldEmail}, bson.M{"$set": bson.M{"owner": newEmail}}); err != nil {
+		return err
+	}
+
+	for _, field := range []string{"members", "admins"} {
+		filter := bson.M{field: oldEmail}
+		update := bson.M{"$set": bson.M{field + ".$": newEmail}}
+		if _, err := service.groups.UpdateMany(ctx, filter, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -224,11 +224,13 @@ func (s *DocumentEndpointsSuite) TestCreateDocument() {
 
 	// Prepare the payload for the request
 	payload := map[string]interface{}{
-		"author":      EMAIL,
-		"title":       TITLE,
-		"body":        BODY,
-		"readAccess":  []string{"readUser1@test.com", "readUser2@test.com"},
-		"writeAccess": []string{"writeUser1@test.com", "writeUser2@test.com"},
+		"author": EMAIL,
+		"title":  TITLE,
+		"body":   BODY,
+		"acl": []map[string]string{
+			{"principal": "readUser1@test.com", "role": "viewer"},
+			{"principal": "writeUser1@test.com", "role": "editor"},
+		},
 	}
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -473,11 +475,13 @@ func (s *DocumentEndpointsSuite) TestUpdateCollaborators() {
 
 	// Prepare the payload for the request
 	payload := map[string]interface{}{
-		"author":      EMAIL,
-		"title":       TITLE,
-		"body":        BODY,
-		"readAccess":  []string{"readUser1@test.com", "readUser2@test.com"},
-		"writeAccess": []string{"writeUser1@test.com", "writeUser2@test.com"},
+		"author": EMAIL,
+		"title":  TITLE,
+		"body":   BODY,
+		"acl": []map[string]string{
+			{"principal": "readUser1@test.com", "role": "viewer"},
+			{"principal": "writeUser1@test.com", "role": "editor"},
+		},
 	}
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -536,8 +540,11 @@ func (s *DocumentEndpointsSuite) TestUpdateCollaborators() {
 	// Prepare the payload for the request
 	payload = map[string]interface{}{
 		"document_id": ID,
-		"readAccess":  []string{"test@example.com"},
-		"writeAccess": []string{"test2@example.com"},
+		"acl": []map[string]string{
+			{"principal": EMAIL, "role": "owner"},
+			{"principal": "test@example.com", "role": "viewer"},
+			{"principal": "test2@example.com", "role": "editor"},
+		},
 	}
 
 	payloadBytes, err = json.Marshal(payload)
@@ -607,11 +614,13 @@ func (s *DocumentEndpointsSuite) TestDeleteDocument() {
 
 	// Prepare the payload for the request
 	payload := map[string]interface{}{
-		"author":      EMAIL,
-		"title":       TITLE,
-		"body":        BODY,
-		"readAccess":  []string{"readUser1@test.com", "readUser2@test.com"},
-		"writeAccess": []string{"writeUser1@test.com", "writeUser2@test.com"},
+		"author": EMAIL,
+		"title":  TITLE,
+		"body":   BODY,
+		"acl": []map[string]string{
+			{"principal": "readUser1@test.com", "role": "viewer"},
+			{"principal": "writeUser1@test.com", "role": "editor"},
+		},
 	}
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
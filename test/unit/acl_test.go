@@ -0,0 +1,87 @@
+package unit_tests
+
+import (
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+)
+
+type ACLTestSuite struct {
+	suite.Suite
+	acl []dto.ACLEntry
+}
+
+func TestACLTestSuite(t *testing.T) {
+	suite.Run(t, &ACLTestSuite{})
+}
+
+func (uts *ACLTestSuite) SetupTest() {
+	uts.acl = []dto.ACLEntry{
+		{Principal: "owner@test.com", Role: dto.RoleOwner},
+		{Principal: "editor@test.com", Role: dto.RoleViewer},
+		{Principal: "editor@test.com", Role: dto.RoleEditor},
+		{Principal: "viewer@test.com", Role: dto.RoleViewer},
+	}
+}
+
+func (uts *ACLTestSuite) TestEffectiveRoleUsesMostPrivilegedEntry() {
+	uts.Equal(dto.RoleOwner, service.EffectiveRole(uts.acl, "owner@test.com"))
+	uts.Equal(dto.RoleEditor, service.EffectiveRole(uts.acl, "editor@test.com"))
+	uts.Equal(dto.RoleViewer, service.EffectiveRole(uts.acl, "viewer@test.com"))
+	uts.Equal("", service.EffectiveRole(uts.acl, "stranger@test.com"))
+}
+
+func (uts *ACLTestSuite) TestRoleAllows() {
+	uts.True(service.RoleAllows(dto.RoleOwner, dto.RoleEditor))
+	uts.True(service.RoleAllows(dto.RoleCommenter, dto.RoleViewer))
+	uts.False(service.RoleAllows(dto.RoleCommenter, dto.RoleEditor))
+	uts.False(service.RoleAllows("", dto.RoleViewer))
+	uts.ElementsMatch([]string{dto.RoleEditor, dto.RoleOwner}, service.RolesAtLeast(dto.RoleEditor))
+}
+
+func (uts *ACLTestSuite) TestLegacyACL() {
+	acl := service.LegacyACL("author@test.com", []string{"author@test.com", "reader@test.com", "writer@test.com"}, []string{"writer@test.com"})
+
+	uts.Equal([]dto.ACLEntry{
+		{Principal: "author@test.com", Role: dto.RoleOwner},
+		{Principal: "writer@test.com", Role: dto.RoleEditor},
+		{Principal: "reader@test.com", Role: dto.RoleViewer},
+	}, acl)
+	uts.Equal(1, service.CountOwners(acl))
+}
+
+func (uts *ACLTestSuite) TestEffectiveRoleThroughGroup() {
+	acl := append(uts.acl, dto.ACLEntry{Principal: service.GroupPrincipal("team"), Role: dto.RoleEditor})
+
+	// Members of a group get the group's role unless they hold a better one themselves
+	uts.Equal(dto.RoleEditor, service.EffectiveRole(acl, "viewer@test.com", service.GroupPrincipal("team")))
+	uts.Equal(dto.RoleOwner, service.EffectiveRole(acl, "owner@test.com", service.GroupPrincipal("team")))
+	uts.Equal("", service.EffectiveRole(acl, "stranger@test.com", service.GroupPrincipal("other")))
+}
+
+func (uts *ACLTestSuite) TestMergeACLKeepsBestRole() {
+	merged := service.MergeACL(
+		[]dto.ACLEntry{{Principal: "a@test.com", Role: dto.RoleViewer}},
+		[]dto.ACLEntry{{Principal: "b@test.com", Role: dto.RoleEditor}, {Principal: "a@test.com", Role: dto.RoleOwner}},
+	)
+
+	uts.Equal([]dto.ACLEntry{
+		{Principal: "a@test.com", Role: dto.RoleOwner},
+		{Principal: "b@test.com", Role: dto.RoleEditor},
+	}, merged)
+}
+
+func (uts *ACLTestSuite) TestDocumentRoleThroughFolder() {
+	document := &dto.Document{
+		ACL:          []dto.ACLEntry{{Principal: "owner@test.com", Role: dto.RoleOwner}},
+		InheritedACL: service.InheritedACL([]dto.ACLEntry{{Principal: "folder-owner@test.com", Role: dto.RoleOwner}, {Principal: "viewer@test.com", Role: dto.RoleViewer}}),
+	}
+
+	// Folder owners edit the documents in it but never own them
+	uts.Equal(dto.RoleEditor, service.DocumentRole(document, "folder-owner@test.com"))
+	uts.Equal(dto.RoleViewer, service.DocumentRole(document, "viewer@test.com"))
+	uts.Equal(dto.RoleOwner, service.DocumentRole(document, "owner@test.com"))
+	uts.Equal("", service.DocumentRole(document, "stranger@test.com"))
+}
@@ -0,0 +1,235 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/realtime"
+	"github.com/stretchr/testify/suite"
+)
+
+// loadViewers is how many viewers the load test connects, more than a presentation to the
+// whole company gets
+const loadViewers = 500
+
+type AudienceTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+	conns  chan *websocket.Conn
+	closed []string
+}
+
+func TestAudienceTestSuite(t *testing.T) {
+	suite.Run(t, &AudienceTestSuite{})
+}
+
+func (uts *AudienceTestSuite) SetupSuite() {
+	// Setup code before running the tests in the suite
+	upgrader := websocket.Upgrader{Subprotocols: realtime.Subprotocols()}
+	uts.conns = make(chan *websocket.Conn, 1)
+	uts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			uts.conns <- conn
+		}
+	}))
+}
+
+func (uts *AudienceTestSuite) SetupTest() {
+	// Setup code before each test
+	uts.closed = nil
+}
+
+func (uts *AudienceTestSuite) TearDownSuite() {
+	// Teardown code after running all the tests in the suite
+	uts.server.Close()
+}
+
+func (uts *AudienceTestSuite) registry() *realtime.Registry {
+	registry := realtime.NewRegistry(10, func(documentID string) (int64, error) {
+		return 7, nil
+	}, func(documentID string) {
+		uts.closed = append(uts.closed, documentID)
+	})
+	registry.ViewerInterval = 20 * time.Millisecond
+	return registry
+}
+
+// watch connects a viewer to the audience of a document and returns the remote end
+func (uts *AudienceTestSuite) watch(registry *realtime.Registry, document dto.DocumentData) (*realtime.Hub, *realtime.Client, *websocket.Conn) {
+	dialer := websocket.Dialer{Subprotocols: []string{dto.ProtocolName}}
+	remote, _, err := dialer.Dial("ws"+strings.TrimPrefix(uts.server.URL, "http"), nil)
+	uts.Require().NoError(err)
+	client := &realtime.Client{Viewer: true, Protocol: dto.ProtocolVersion}
+	client.Attach(<-uts.conns)
+	hub, err := registry.Watch("doc", client, func(hub *realtime.Hub) dto.DocumentData { return document })
+	uts.Require().NoError(err)
+	return hub, client, remote
+}
+
+// publish makes edits the way editors do, under the mutex of the hub
+func publish(hub *realtime.Hub, revision int64, change dto.DocumentData) {
+	hub.Mutex.Lock()
+	hub.Changes.Add(realtime.Change{Revision: revision, Delta: change})
+	hub.Audience.Publish(revision, change)
+	hub.Mutex.Unlock()
+}
+
+// follow reads the messages of a viewer until it's at a revision and returns its document
+// with the number of edits it got
+func follow(remote *websocket.Conn, revision int64) (dto.DocumentData, int, error) {
+	var document dto.DocumentData
+	edits := 0
+	for {
+		remote.SetReadDeadline(time.Now().Add(10 * time.Second))
+		_, raw, err := remote.ReadMessage()
+		if err != nil {
+			return document, edits, err
+		}
+		var envelope dto.Envelope
+		if err := json.Unmarshal(raw, &envelope); err != nil {
+			return document, edits, err
+		}
+		switch envelope.Type {
+		case dto.MessageSnapshot:
+			var snapshot dto.SnapshotPayload
+			if err := json.Unmarshal(envelope.Payload, &snapshot); err != nil {
+				return document, edits, err
+			}
+			document = snapshot.Data
+		case dto.MessageEdit:
+			var edit dto.EditPayload
+			if err := json.Unmarshal(envelope.Payload, &edit); err != nil {
+				return document, edits, err
+			}
+			document = realtime.Compose(document, edit.Change)
+			edits++
+		}
+		if envelope.Revision >= revision {
+			return document, edits, nil
+		}
+	}
+}
+
+func text(document dto.DocumentData) string {
+	var builder strings.Builder
+	for _, op := range document.Ops {
+		builder.WriteString(op["insert"].(string))
+	}
+	return builder.String()
+}
+
+func (uts *AudienceTestSuite) TestViewersFollowEdits() {
+	registry := uts.registry()
+	document := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "abc\n"}}}
+	hub, viewer, remote := uts.watch(registry, document)
+	defer remote.Close()
+	// Viewers aren't among the editors
+	uts.Empty(hub.Clients)
+
+	publish(hub, 8, dto.DocumentData{Ops: []map[string]interface{}{{"retain": 3}, {"insert": "d"}}})
+	publish(hub, 9, dto.DocumentData{Ops: []map[string]interface{}{{"retain": 4}, {"insert": "e"}}})
+	followed, _, err := follow(remote, 9)
+	uts.Require().NoError(err)
+	uts.Equal("abcde\n", text(followed))
+
+	// Viewers joining later start from the edits already sent
+	_, late, lateRemote := uts.watch(registry, document)
+	defer lateRemote.Close()
+	followed, edits, err := follow(lateRemote, 9)
+	uts.Require().NoError(err)
+	uts.Equal(0, edits)
+	uts.Equal("abcde\n", text(followed))
+
+	registry.Unwatch(hub, viewer)
+	uts.Empty(uts.closed)
+	registry.Unwatch(hub, late)
+	uts.Equal([]string{"doc"}, uts.closed)
+}
+
+func (uts *AudienceTestSuite) TestViewersCantEditOrMeetEditors() {
+	registry := uts.registry()
+	hub, viewer, remote := uts.watch(registry, dto.DocumentData{Ops: []map[string]interface{}{{"insert": "\n"}}})
+	defer remote.Close()
+	defer registry.Unwatch(hub, viewer)
+
+	editor := &realtime.Client{}
+	_, err := registry.Join("doc", editor, nil)
+	uts.Require().NoError(err)
+	hub.Mutex.Lock()
+	hub.Broadcast(editor, func(client *realtime.Client) []byte { return []byte("presence") })
+	hub.Mutex.Unlock()
+
+	// The viewer gets its snapshot and nothing of the editors
+	_, _, err = follow(remote, 7)
+	uts.Require().NoError(err)
+	remote.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = remote.ReadMessage()
+	uts.Error(err)
+}
+
+// TestViewerLoad presents a document to loadViewers viewers while it's edited a thousand
+// times: the editors never wait for the viewers and each viewer gets the edits coalesced.
+func (uts *AudienceTestSuite) TestViewerLoad() {
+	if testing.Short() {
+		uts.T().Skip("load test")
+	}
+	registry := uts.registry()
+	document := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "\n"}}}
+	var hub *realtime.Hub
+	remotes := make([]*websocket.Conn, loadViewers)
+	viewers := make([]*realtime.Client, loadViewers)
+	for i := range remotes {
+		hub, viewers[i], remotes[i] = uts.watch(registry, document)
+		defer remotes[i].Close()
+	}
+
+	const edits = 1000
+	var wait sync.WaitGroup
+	results := make([]string, loadViewers)
+	received := make([]int, loadViewers)
+	errs := make([]error, loadViewers)
+	for i, remote := range remotes {
+		wait.Add(1)
+		go func(i int, remote *websocket.Conn) {
+			defer wait.Done()
+			followed, count, err := follow(remote, 7+edits)
+			results[i], received[i], errs[i] = text(followed), count, err
+		}(i, remote)
+	}
+
+	started := time.Now()
+	var slowest time.Duration
+	for revision := int64(8); revision <= 7+edits; revision++ {
+		publishing := time.Now()
+		publish(hub, revision, dto.DocumentData{Ops: []map[string]interface{}{{"insert": "x"}}})
+		slowest = max(slowest, time.Since(publishing))
+		time.Sleep(100 * time.Microsecond)
+	}
+	wait.Wait()
+
+	expected := strings.Repeat("x", edits) + "\n"
+	most := 0
+	for i := range remotes {
+		uts.Require().NoError(errs[i])
+		uts.Equal(expected, results[i])
+		most = max(most, received[i])
+	}
+	// The edits are sent once an interval at most, whatever the pace of the editors
+	elapsed := time.Since(started)
+	uts.LessOrEqual(most, int(elapsed/registry.ViewerInterval)+1)
+	uts.T().Logf("%d viewers followed %d edits in %v, at most %d messages each, slowest publish %v",
+		loadViewers, edits, elapsed, most, slowest)
+
+	for _, viewer := range viewers {
+		registry.Unwatch(hub, viewer)
+	}
+	uts.Equal([]string{"doc"}, uts.closed)
+}
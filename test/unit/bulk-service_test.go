@@ -0,0 +1,131 @@
+package unit_tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type BulkServiceSuite struct {
+	suite.Suite
+	service   service.BulkService
+	documents service.DocumentService
+	client    *mongo.Client
+}
+
+func TestBulkServiceSuite(t *testing.T) {
+	suite.Run(t, new(BulkServiceSuite))
+}
+
+func (s *BulkServiceSuite) SetupSuite() {
+	// Setup MongoDB connection
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update with your MongoDB URI
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.client = client
+
+	// Initialize the bulk service, it changes the documents of the "documents" collection
+	s.service = service.NewBulkService(client, "testdb", "documents")
+	s.documents = service.NewDocumentService(client, "testdb", "documents")
+}
+
+func (s *BulkServiceSuite) SetupTest() {
+	// Cleanup existing data in the test database
+	for _, collection := range []string{"documents", "users"} {
+		_, err := s.client.Database("testdb").Collection(collection).DeleteMany(context.Background(), bson.M{})
+		if err != nil {
+			s.T().Fatal(err)
+		}
+	}
+}
+
+func (s *BulkServiceSuite) TearDownSuite() {
+	// Close MongoDB connection after all tests
+	if err := s.client.Disconnect(context.Background()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *BulkServiceSuite) create(author string, title string) string {
+	documentID, err := s.documents.CreateDocument(author, title, "", nil)
+	s.Require().NoError(err)
+	return documentID
+}
+
+func (s *BulkServiceSuite) TestDeleteReportsEveryDocument() {
+	mine := s.create("owner@test.com", "Mine")
+	theirs := s.create("other@test.com", "Theirs")
+
+	request := dto.BulkRequest{Operation: dto.BulkDelete, DocumentIDs: []string{mine, theirs, "not-an-id"}}
+	result, err := s.service.Apply(context.Background(), "owner@test.com", false, request, time.Hour)
+	s.Require().NoError(err)
+
+	s.Equal(1, result.Succeeded)
+	s.Equal(2, result.Failed)
+	s.Equal(dto.BulkItemResult{DocumentID: mine, Status: dto.BulkSucceeded}, result.Results[0])
+	s.Equal(dto.BulkFailed, result.Results[1].Status)
+	s.Equal(service.ErrDocumentNotFound.Error(), result.Results[1].Error)
+	s.Equal(dto.BulkFailed, result.Results[2].Status)
+
+	trash, err := s.documents.ListTrash("owner@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(trash, 1)
+	s.Equal(mine, trash[0].ID)
+
+	request.Operation = dto.BulkRestore
+	result, err = s.service.Apply(context.Background(), "owner@test.com", false, request, time.Hour)
+	s.Require().NoError(err)
+	s.Equal(1, result.Succeeded)
+	_, err = s.documents.GetDocumentByID(mine)
+	s.NoError(err)
+}
+
+func (s *BulkServiceSuite) TestAdminTransfersDocumentsOfDepartingUser() {
+	first := s.create("leaving@test.com", "Plan")
+	second := s.create("leaving@test.com", "Budget")
+	_, err := s.client.Database("testdb").Collection("users").InsertOne(context.Background(), bson.M{"email": "manager@test.com"})
+	s.Require().NoError(err)
+
+	request := dto.BulkRequest{Operation: dto.BulkTransfer, DocumentIDs: []string{first, second}, From: "leaving@test.com", To: "manager@test.com"}
+	_, err = s.service.Apply(context.Background(), "owner@test.com", false, request, time.Hour)
+	s.ErrorIs(err, service.ErrBulkPermissions)
+
+	result, err := s.service.Apply(context.Background(), "admin@test.com", true, request, time.Hour)
+	s.Require().NoError(err)
+	s.Equal(2, result.Succeeded)
+	role, err := s.documents.GetRole(second, "manager@test.com")
+	s.Require().NoError(err)
+	s.Equal(dto.RoleOwner, role)
+	role, err = s.documents.GetRole(second, "leaving@test.com")
+	s.Require().NoError(err)
+	s.Equal(dto.RoleEditor, role)
+}
+
+func (s *BulkServiceSuite) TestShareAndRetag() {
+	documentID := s.create("owner@test.com", "Spec")
+	_, err := s.client.Database("testdb").Collection("users").InsertOne(context.Background(), bson.M{"email": "owner@test.com"})
+	s.Require().NoError(err)
+
+	// Removing the only owner is refused for that document
+	request := dto.BulkRequest{Operation: dto.BulkShare, DocumentIDs: []string{documentID}, Principal: "owner@test.com"}
+	result, err := s.service.Apply(context.Background(), "owner@test.com", false, request, time.Hour)
+	s.Require().NoError(err)
+	s.Equal(service.ErrLastOwner.Error(), result.Results[0].Error)
+
+	request = dto.BulkRequest{Operation: dto.BulkRetag, DocumentIDs: []string{documentID}, Add: []string{"specs"}}
+	result, err = s.service.Apply(context.Background(), "owner@test.com", false, request, time.Hour)
+	s.Require().NoError(err)
+	s.Equal(1, result.Succeeded)
+	document, err := s.documents.GetDocumentByID(documentID)
+	s.Require().NoError(err)
+	s.Equal([]string{"specs"}, document.Tags)
+}
@@ -0,0 +1,122 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/realtime"
+	"github.com/stretchr/testify/suite"
+)
+
+type DeltaTestSuite struct {
+	suite.Suite
+}
+
+func TestDeltaTestSuite(t *testing.T) {
+	suite.Run(t, &DeltaTestSuite{})
+}
+
+// delta decodes a delta written as JSON, the way it comes from editors
+func (uts *DeltaTestSuite) delta(raw string) dto.DocumentData {
+	var data dto.DocumentData
+	uts.Require().NoError(json.Unmarshal([]byte(raw), &data))
+	return data
+}
+
+func (uts *DeltaTestSuite) equalDelta(expected string, actual dto.DocumentData) {
+	raw, err := json.Marshal(actual)
+	uts.Require().NoError(err)
+	uts.JSONEq(expected, string(raw))
+}
+
+func (uts *DeltaTestSuite) TestCompose() {
+	document := uts.delta(`{"ops":[{"insert":"Hello world\n"}]}`)
+	change := uts.delta(`{"ops":[{"retain":6},{"delete":5},{"insert":"there","attributes":{"bold":true}}]}`)
+
+	uts.equalDelta(`{"ops":[{"insert":"Hello "},{"insert":"there","attributes":{"bold":true}},{"insert":"\n"}]}`, realtime.Compose(document, change))
+}
+
+func (uts *DeltaTestSuite) TestComposeFormatting() {
+	document := uts.delta(`{"ops":[{"insert":"ab","attributes":{"bold":true}}]}`)
+	change := uts.delta(`{"ops":[{"retain":1,"attributes":{"bold":null,"italic":true}}]}`)
+
+	uts.equalDelta(`{"ops":[{"insert":"a","attributes":{"italic":true}},{"insert":"b","attributes":{"bold":true}}]}`, realtime.Compose(document, change))
+}
+
+func (uts *DeltaTestSuite) TestComposeCountsUTF16() {
+	// The emoji takes two positions in the editor
+	document := uts.delta(`{"ops":[{"insert":"a😀b"}]}`)
+	change := uts.delta(`{"ops":[{"retain":3},{"insert":"!"}]}`)
+
+	uts.equalDelta(`{"ops":[{"insert":"a😀!b"}]}`, realtime.Compose(document, change))
+}
+
+func (uts *DeltaTestSuite) TestTransformConverges() {
+	document := uts.delta(`{"ops":[{"insert":"abc\n"}]}`)
+	a := uts.delta(`{"ops":[{"retain":1},{"insert":"X"},{"delete":1}]}`)
+	b := uts.delta(`{"ops":[{"retain":1},{"insert":"Y"},{"retain":1},{"delete":1}]}`)
+
+	first := realtime.Compose(realtime.Compose(document, a), realtime.Transform(a, b, true))
+	second := realtime.Compose(realtime.Compose(document, b), realtime.Transform(b, a, false))
+	uts.Equal(first, second)
+	// The change that happened first keeps its text first
+	uts.equalDelta(`{"ops":[{"insert":"aXY\n"}]}`, first)
+}
+
+func (uts *DeltaTestSuite) TestChangeBufferSince() {
+	buffer := realtime.NewChangeBuffer(2, 10)
+	for revision := int64(11); revision <= 13; revision++ {
+		buffer.Add(realtime.Change{Revision: revision})
+	}
+
+	changes, ok := buffer.Since(11)
+	uts.True(ok)
+	uts.Len(changes, 2)
+	changes, ok = buffer.Since(13)
+	uts.True(ok)
+	uts.Empty(changes)
+
+	// Revision 11 was dropped, and the buffer doesn't know revisions ahead of it
+	_, ok = buffer.Since(10)
+	uts.False(ok)
+	_, ok = buffer.Since(14)
+	uts.False(ok)
+}
+
+func (uts *DeltaTestSuite) TestCatchUp() {
+	// The client saw "ab\n" and typed "X" at the end, while somebody typed "Y" at the start
+	document := uts.delta(`{"ops":[{"insert":"ab\n"}]}`)
+	other := uts.delta(`{"ops":[{"insert":"Y"}]}`)
+	pending := []dto.PendingEdit{{ID: "m1", Change: uts.delta(`{"ops":[{"retain":2},{"insert":"X"}]}`)}}
+	missed := []realtime.Change{{Revision: 1, Delta: other, Author: "other@test.com"}}
+
+	client, server, applied := realtime.CatchUp(missed, "author@test.com", pending)
+	uts.Empty(applied)
+
+	onServer := realtime.Compose(realtime.Compose(document, other), server)
+	onClient := realtime.Compose(realtime.Compose(document, pending[0].Change), client)
+	uts.equalDelta(`{"ops":[{"insert":"YabX\n"}]}`, onServer)
+	uts.Equal(onServer, onClient)
+}
+
+func (uts *DeltaTestSuite) TestCatchUpSkipsAppliedEdits() {
+	// The first pending edit was applied after a change of somebody else, but its ack was lost
+	document := uts.delta(`{"ops":[{"insert":"ab\n"}]}`)
+	other := uts.delta(`{"ops":[{"insert":"Y"}]}`)
+	first := uts.delta(`{"ops":[{"retain":2},{"insert":"X"}]}`)
+	second := uts.delta(`{"ops":[{"retain":3},{"insert":"Z"}]}`)
+	pending := []dto.PendingEdit{{ID: "m1", Change: first}, {ID: "m2", Change: second}}
+	missed := []realtime.Change{
+		{Revision: 1, Delta: other, Author: "other@test.com"},
+		{Revision: 2, Delta: realtime.Transform(other, first, true), Author: "author@test.com", MessageIDs: []string{"m1"}},
+	}
+
+	client, server, applied := realtime.CatchUp(missed, "author@test.com", pending)
+	uts.Equal([]string{"m1"}, applied)
+
+	onServer := realtime.ComposeAll(document, other, missed[1].Delta, server)
+	onClient := realtime.ComposeAll(document, first, second, client)
+	uts.equalDelta(`{"ops":[{"insert":"YabXZ\n"}]}`, onServer)
+	uts.Equal(onServer, onClient)
+}
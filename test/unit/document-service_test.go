@@ -3,11 +3,13 @@ package unit_tests
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/khallihub/godoc/dto"
 	"github.com/khallihub/godoc/service"
 	"github.com/stretchr/testify/suite"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -57,22 +59,95 @@ func (s *DocumentServiceSuite) cleanupDatabase() {
 }
 
 func (s *DocumentServiceSuite) prepareTestData() {
-	_, err := s.service.CreateDocument("author@test.com", "Test Document", "Test body", []string{"read@test.com"}, []string{"write@test.com"})
+	acl := []dto.ACLEntry{{Principal: "read@test.com", Role: dto.RoleViewer}, {Principal: "write@test.com", Role: dto.RoleEditor}}
+	_, err := s.service.CreateDocument("author@test.com", "Test Document", "Test body", acl)
 	if err != nil {
 		s.T().Fatal(err)
 	}
 }
 
-func (s *DocumentServiceSuite) TestGetAllDocuments() {
-	email := dto.Email{Email: "author@test.com"}
+// listDocuments lists the documents a user can access
+func (s *DocumentServiceSuite) listDocuments(email string) ([]*dto.DocumentListItem, error) {
+	page, err := s.service.ListDocuments(email, dto.DocumentListQuery{})
+	if err != nil {
+		return nil, err
+	}
+	return page.Documents, nil
+}
 
+func (s *DocumentServiceSuite) TestListDocuments() {
 	// Call the method under test
-	documents, err := s.service.GetAllDocuments(email)
+	documents, err := s.listDocuments("author@test.com")
 
 	// Assertions
 	s.NoError(err)
 	s.Len(documents, 1)
 	s.Equal("Test Document", documents[0].Title)
+	s.Equal(dto.RoleOwner, documents[0].Role)
+}
+
+func (s *DocumentServiceSuite) TestListDocumentsSharedWithViewer() {
+	documents, err := s.listDocuments("read@test.com")
+
+	s.NoError(err)
+	s.Len(documents, 1)
+	s.Equal(dto.RoleViewer, documents[0].Role)
+}
+
+func (s *DocumentServiceSuite) TestListDocumentsPages() {
+	// Prepare test data
+	for _, title := range []string{"Beta", "Alpha", "Gamma"} {
+		_, err := s.service.CreateDocument("author@test.com", title, "Test body", nil)
+		s.Require().NoError(err)
+	}
+	query := dto.DocumentListQuery{Sort: dto.SortTitle, Limit: 2}
+
+	// Call the method under test
+	page, err := s.service.ListDocuments("author@test.com", query)
+
+	// Assertions
+	s.Require().NoError(err)
+	s.Require().Len(page.Documents, 2)
+	s.Equal("Alpha", page.Documents[0].Title)
+	s.Equal("Beta", page.Documents[1].Title)
+	s.Equal("author@test.com", page.Documents[0].Owner)
+	s.Equal(dto.RoleOwner, page.Documents[0].Role)
+	s.NotEmpty(page.NextCursor)
+
+	query.Cursor = page.NextCursor
+	page, err = s.service.ListDocuments("author@test.com", query)
+	s.Require().NoError(err)
+	s.Require().Len(page.Documents, 2)
+	s.Equal("Gamma", page.Documents[0].Title)
+	s.Equal("Test Document", page.Documents[1].Title)
+	s.Empty(page.NextCursor)
+
+	query.Cursor = "not a cursor"
+	_, err = s.service.ListDocuments("author@test.com", query)
+	s.ErrorIs(err, service.ErrInvalidCursor)
+}
+
+func (s *DocumentServiceSuite) TestListDocumentsFilters() {
+	// Prepare test data
+	acl := []dto.ACLEntry{{Principal: "author@test.com", Role: dto.RoleViewer}}
+	_, err := s.service.CreateDocument("other@test.com", "Shared Document", "Test body", acl)
+	s.Require().NoError(err)
+
+	owned, err := s.service.ListDocuments("author@test.com", dto.DocumentListQuery{Filter: dto.ListOwned})
+	s.Require().NoError(err)
+	s.Require().Len(owned.Documents, 1)
+	s.Equal("Test Document", owned.Documents[0].Title)
+
+	shared, err := s.service.ListDocuments("author@test.com", dto.DocumentListQuery{Filter: dto.ListShared})
+	s.Require().NoError(err)
+	s.Require().Len(shared.Documents, 1)
+	s.Equal("Shared Document", shared.Documents[0].Title)
+	s.Equal(dto.RoleViewer, shared.Documents[0].Role)
+
+	byCollaborator, err := s.service.ListDocuments("author@test.com", dto.DocumentListQuery{Collaborator: "write@test.com"})
+	s.Require().NoError(err)
+	s.Require().Len(byCollaborator.Documents, 1)
+	s.Equal("Test Document", byCollaborator.Documents[0].Title)
 }
 
 func (s *DocumentServiceSuite) TestSearchDocuments() {
@@ -80,24 +155,47 @@ func (s *DocumentServiceSuite) TestSearchDocuments() {
 	searchQuery := "Test"
 
 	// Call the method under test
-	documents, err := s.service.SearchDocuments(email, searchQuery)
+	documents, err := s.service.SearchDocuments(email, dto.Search{SearchQuery: searchQuery})
 
 	// Assertions
 	s.NoError(err)
 	s.Len(documents, 1)
 	s.Equal("Test Document", documents[0].Title)
+	s.Equal(dto.RoleOwner, documents[0].Role)
 	// Add more assertions based on your use case
 }
 
+func (s *DocumentServiceSuite) TestSearchDocumentBodies() {
+	// Prepare test data
+	documents, err := s.listDocuments("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	body := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "Quarterly report on giraffes\n"}}}
+	s.Require().NoError(s.service.UpdateDocument(documents[0].ID, body, 1, "write@test.com"))
+
+	// Call the method under test
+	results, err := s.service.SearchDocuments("read@test.com", dto.Search{SearchQuery: "giraffes"})
+
+	// Assertions
+	s.NoError(err)
+	s.Require().Len(results, 1)
+	s.Equal(dto.RoleViewer, results[0].Role)
+	s.Contains(results[0].Snippet, "<mark>giraffes</mark>")
+
+	// Documents the user can't access never show up
+	results, err = s.service.SearchDocuments("stranger@test.com", dto.Search{SearchQuery: "giraffes"})
+	s.NoError(err)
+	s.Empty(results)
+}
+
 func (s *DocumentServiceSuite) TestCreateDocument() {
 	author := "new_author@test.com"
 	title := "New Test Document"
 	body := "New Test Body"
-	readAccess := []string{"read@test.com"}
-	writeAccess := []string{"write@test.com"}
+	acl := []dto.ACLEntry{{Principal: "read@test.com", Role: dto.RoleViewer}, {Principal: "write@test.com", Role: dto.RoleEditor}}
 
 	// Call the method under test
-	documentID, err := s.service.CreateDocument(author, title, body, readAccess, writeAccess)
+	documentID, err := s.service.CreateDocument(author, title, body, acl)
 
 	// Assertions
 	s.NoError(err)
@@ -107,7 +205,7 @@ func (s *DocumentServiceSuite) TestCreateDocument() {
 
 func (s *DocumentServiceSuite) TestUpdateDocument() {
 	// Prepare test data
-	documents, err := s.service.GetAllDocuments(dto.Email{Email: "author@test.com"})
+	documents, err := s.listDocuments("author@test.com")
 	s.Require().NoError(err)
 	s.Require().Len(documents, 1)
 	documentID := documents[0].ID
@@ -125,16 +223,105 @@ func (s *DocumentServiceSuite) TestUpdateDocument() {
 	}
 
 	// Call the method under test
-	err = s.service.UpdateDocument(documentID, incomingData)
+	err = s.service.UpdateDocument(documentID, incomingData, 1, "write@test.com")
 
 	// Assertions
 	s.NoError(err)
 	// Add more assertions based on your use case
 }
 
+func (s *DocumentServiceSuite) TestUpdateDocumentKeepsNewerRevision() {
+	// Prepare test data
+	documents, err := s.listDocuments("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	documentID := documents[0].ID
+	newer := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "Newer\n"}}}
+	older := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "Older\n"}}}
+
+	// Call the method under test, the flush of the older revision finishing last
+	s.Require().NoError(s.service.UpdateDocument(documentID, newer, 5, "write@test.com"))
+	s.Require().NoError(s.service.UpdateDocument(documentID, older, 4, "write@test.com"))
+
+	// Assertions
+	document, err := s.service.GetDocumentByID(documentID)
+	s.Require().NoError(err)
+	s.Equal(int64(5), document.Revision)
+	s.Equal("Newer\n", document.Data.Ops[0]["insert"])
+}
+
+func (s *DocumentServiceSuite) TestUpdateDocumentRecordsMetadata() {
+	// Prepare test data
+	documents, err := s.listDocuments("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	created, err := s.service.GetDocumentByID(documents[0].ID)
+	s.Require().NoError(err)
+	s.False(created.CreatedAt.IsZero())
+	s.Equal("author@test.com", created.LastEditedBy)
+
+	// Call the method under test
+	body := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "Three small words\n"}}}
+	s.Require().NoError(s.service.UpdateDocument(created.ID, body, 1, "write@test.com"))
+
+	// Assertions
+	document, err := s.service.GetDocumentByID(created.ID)
+	s.Require().NoError(err)
+	s.Equal("write@test.com", document.LastEditedBy)
+	s.Equal(3, document.WordCount)
+	s.Equal(17, document.CharCount)
+	s.Equal(created.CreatedAt, document.CreatedAt)
+	s.False(document.UpdatedAt.Before(created.UpdatedAt))
+}
+
+func (s *DocumentServiceSuite) TestUpdateDocumentKeepsLatestRevision() {
+	// Prepare test data
+	documents, err := s.listDocuments("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	body := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "Text\n"}}}
+
+	// Call the method under test, a late write of an older revision doesn't roll it back
+	s.Require().NoError(s.service.UpdateDocument(documents[0].ID, body, 5, "write@test.com"))
+	s.Require().NoError(s.service.UpdateDocument(documents[0].ID, body, 3, "write@test.com"))
+
+	// Assertions
+	document, err := s.service.GetDocumentByID(documents[0].ID)
+	s.Require().NoError(err)
+	s.Equal(int64(5), document.Revision)
+}
+
+func (s *DocumentServiceSuite) TestListDocumentsByLastOpened() {
+	// Prepare test data
+	first, err := s.service.CreateDocument("author@test.com", "First", "Test body", nil)
+	s.Require().NoError(err)
+	second, err := s.service.CreateDocument("author@test.com", "Second", "Test body", nil)
+	s.Require().NoError(err)
+	s.Require().NoError(s.service.RecordOpen(second, "author@test.com"))
+	s.Require().NoError(s.service.RecordOpen(first, "author@test.com"))
+	// Opens by other users don't change the order
+	s.Require().NoError(s.service.RecordOpen(second, "write@test.com"))
+
+	// Call the method under test
+	page, err := s.service.ListDocuments("author@test.com", dto.DocumentListQuery{Sort: dto.SortOpened, Limit: 2})
+
+	// Assertions
+	s.Require().NoError(err)
+	s.Require().Len(page.Documents, 2)
+	s.Equal("First", page.Documents[0].Title)
+	s.Equal("Second", page.Documents[1].Title)
+	s.NotNil(page.Documents[0].LastOpenedAt)
+
+	page, err = s.service.ListDocuments("author@test.com", dto.DocumentListQuery{Sort: dto.SortOpened, Limit: 2, Cursor: page.NextCursor})
+	s.Require().NoError(err)
+	s.Require().Len(page.Documents, 1)
+	s.Equal("Test Document", page.Documents[0].Title)
+	s.Nil(page.Documents[0].LastOpenedAt)
+}
+
 func (s *DocumentServiceSuite) TestGetDocumentByID() {
 	// Prepare test data
-	documents, err := s.service.GetAllDocuments(dto.Email{Email: "author@test.com"})
+	documents, err := s.listDocuments("author@test.com")
 	s.Require().NoError(err)
 	s.Require().Len(documents, 1)
 	documentID := documents[0].ID
@@ -151,7 +338,7 @@ func (s *DocumentServiceSuite) TestGetDocumentByID() {
 
 func (s *DocumentServiceSuite) TestUpdateTitle() {
 	// Prepare test data
-	documents, err := s.service.GetAllDocuments(dto.Email{Email: "author@test.com"})
+	documents, err := s.listDocuments("author@test.com")
 	s.Require().NoError(err)
 	s.Require().Len(documents, 1)
 	documentID := documents[0].ID
@@ -170,15 +357,18 @@ func (s *DocumentServiceSuite) TestUpdateTitle() {
 
 func (s *DocumentServiceSuite) TestUpdateCollaborators() {
 	// Prepare test data
-	documents, err := s.service.GetAllDocuments(dto.Email{Email: "author@test.com"})
+	documents, err := s.listDocuments("author@test.com")
 	s.Require().NoError(err)
 	s.Require().Len(documents, 1)
 	documentID := documents[0].ID
 
 	// Prepare collaborators
 	newCollaborators := dto.Access{
-		ReadAccess:  []string{"new_read@test.com"},
-		WriteAccess: []string{"new_write@test.com"},
+		ACL: []dto.ACLEntry{
+			{Principal: "author@test.com", Role: dto.RoleOwner},
+			{Principal: "new_read@test.com", Role: dto.RoleViewer},
+			{Principal: "new_write@test.com", Role: dto.RoleEditor},
+		},
 	}
 
 	// Call the method under test
@@ -187,30 +377,295 @@ func (s *DocumentServiceSuite) TestUpdateCollaborators() {
 	// Assertions
 	s.NoError(err)
 	s.NotNil(updatedDocument)
-	s.Equal(newCollaborators.ReadAccess, updatedDocument.ReadAccess)
-	s.Equal(newCollaborators.WriteAccess, updatedDocument.WriteAccess)
+	s.Equal(newCollaborators.ACL, updatedDocument.ACL)
 	// Add more assertions based on your use case
 }
 
+func (s *DocumentServiceSuite) TestTransferOwnership() {
+	// Prepare test data
+	documents, err := s.listDocuments("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	documentID := documents[0].ID
+
+	users := s.client.Database("testdb").Collection("users")
+	_, err = users.DeleteMany(context.Background(), bson.M{"email": "write@test.com"})
+	s.Require().NoError(err)
+	_, err = users.InsertOne(context.Background(), bson.M{"email": "write@test.com"})
+	s.Require().NoError(err)
+
+	// Nobody could act as a missing owner
+	_, err = s.service.TransferOwnership(documentID, "author@test.com", "typo@test.com")
+	s.ErrorIs(err, service.ErrPrincipalNotFound)
+
+	// Call the method under test
+	document, err := s.service.TransferOwnership(documentID, "author@test.com", "write@test.com")
+
+	// Assertions
+	s.NoError(err)
+	s.Equal(dto.RoleOwner, service.EffectiveRole(document.ACL, "write@test.com"))
+	s.Equal(dto.RoleEditor, service.EffectiveRole(document.ACL, "author@test.com"))
+
+	role, err := s.service.GetRole(documentID, "write@test.com")
+	s.NoError(err)
+	s.Equal(dto.RoleOwner, role)
+}
+
+func (s *DocumentServiceSuite) TestTransferOwnershipNeedsDirectOwner() {
+	users := s.client.Database("testdb").Collection("users")
+	_, err := users.DeleteMany(context.Background(), bson.M{"email": "write@test.com"})
+	s.Require().NoError(err)
+	_, err = users.InsertOne(context.Background(), bson.M{"email": "write@test.com"})
+	s.Require().NoError(err)
+	group := service.GroupPrincipal("65f1c0ffee0000000000beef")
+	acl := []dto.ACLEntry{{Principal: group, Role: dto.RoleOwner}}
+	documentID, err := s.service.CreateDocument("author@test.com", "Team document", "Team body", acl)
+	s.Require().NoError(err)
+
+	// Owning the document through the group alone, the transfer would leave them an owner
+	_, err = s.service.TransferOwnership(documentID, "member@test.com", "write@test.com")
+	s.ErrorIs(err, service.ErrNotDirectOwner)
+}
+
+func (s *DocumentServiceSuite) TestUnknownPrincipal() {
+	users := s.client.Database("testdb").Collection("users")
+	_, err := users.DeleteMany(context.Background(), bson.M{"email": "new@test.com"})
+	s.Require().NoError(err)
+	_, err = users.InsertOne(context.Background(), bson.M{"email": "new@test.com"})
+	s.Require().NoError(err)
+
+	principal, err := s.service.UnknownPrincipal([]dto.ACLEntry{{Principal: "new@test.com", Role: dto.RoleEditor}})
+	s.Require().NoError(err)
+	s.Empty(principal)
+
+	// Unregistered emails and missing groups are both reported
+	acl := []dto.ACLEntry{{Principal: "new@test.com", Role: dto.RoleEditor}, {Principal: "nobody@test.com", Role: dto.RoleViewer}}
+	principal, err = s.service.UnknownPrincipal(acl)
+	s.Require().NoError(err)
+	s.Equal("nobody@test.com", principal)
+	principal, err = s.service.UnknownPrincipal([]dto.ACLEntry{{Principal: service.GroupPrincipal("65f1c0ffee0000000000beef"), Role: dto.RoleViewer}})
+	s.Require().NoError(err)
+	s.Equal(service.GroupPrincipal("65f1c0ffee0000000000beef"), principal)
+}
+
+func (s *DocumentServiceSuite) TestAddChangeRemoveCollaborator() {
+	// Prepare test data
+	users := s.client.Database("testdb").Collection("users")
+	_, err := users.DeleteMany(context.Background(), bson.M{"email": "new@test.com"})
+	s.Require().NoError(err)
+	_, err = users.InsertOne(context.Background(), bson.M{"email": "new@test.com"})
+	s.Require().NoError(err)
+	documents, err := s.listDocuments("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	documentID := documents[0].ID
+
+	// Only existing accounts can be added, and only once
+	_, err = s.service.AddCollaborator(documentID, dto.ACLEntry{Principal: "nobody@test.com", Role: dto.RoleViewer})
+	s.ErrorIs(err, service.ErrPrincipalNotFound)
+	document, err := s.service.AddCollaborator(documentID, dto.ACLEntry{Principal: "new@test.com", Role: dto.RoleViewer})
+	s.Require().NoError(err)
+	s.Equal(dto.RoleViewer, service.EffectiveRole(document.ACL, "new@test.com"))
+	_, err = s.service.AddCollaborator(documentID, dto.ACLEntry{Principal: "new@test.com", Role: dto.RoleEditor})
+	s.ErrorIs(err, service.ErrCollaboratorExists)
+
+	document, err = s.service.ChangeCollaboratorRole(documentID, "new@test.com", dto.RoleEditor)
+	s.Require().NoError(err)
+	s.Equal(dto.RoleEditor, service.EffectiveRole(document.ACL, "new@test.com"))
+	s.Len(document.ACL, 4)
+
+	// The last owner can neither be demoted nor removed
+	_, err = s.service.ChangeCollaboratorRole(documentID, "author@test.com", dto.RoleEditor)
+	s.ErrorIs(err, service.ErrLastOwner)
+	_, err = s.service.RemoveCollaborator(documentID, "author@test.com")
+	s.ErrorIs(err, service.ErrLastOwner)
+
+	document, err = s.service.RemoveCollaborator(documentID, "new@test.com")
+	s.Require().NoError(err)
+	s.Equal("", service.EffectiveRole(document.ACL, "new@test.com"))
+	_, err = s.service.RemoveCollaborator(documentID, "new@test.com")
+	s.ErrorIs(err, service.ErrNotCollaborator)
+}
+
+func (s *DocumentServiceSuite) TestMigrateAccess() {
+	legacy := bson.D{
+		{Key: "author", Value: "legacy@test.com"},
+		{Key: "title", Value: "Legacy Document"},
+		{Key: "readAccess", Value: []string{"legacy@test.com", "reader@test.com"}},
+		{Key: "writeAccess", Value: []string{"legacy@test.com", "writer@test.com"}},
+	}
+	_, err := s.client.Database("testdb").Collection("documentCollection").InsertOne(context.Background(), legacy)
+	s.Require().NoError(err)
+
+	// Call the method under test
+	migrated, err := s.service.MigrateAccess()
+
+	// Assertions
+	s.NoError(err)
+	s.Equal(int64(1), migrated)
+	documents, err := s.listDocuments("reader@test.com")
+	s.NoError(err)
+	s.Require().Len(documents, 1)
+	s.Equal(dto.RoleViewer, documents[0].Role)
+}
+
+func (s *DocumentServiceSuite) TestMigrateAccessKeepsOwner() {
+	legacy := bson.D{
+		{Key: "author", Value: "legacy@test.com"},
+		{Key: "title", Value: "Transferred Document"},
+		{Key: "acl", Value: []dto.ACLEntry{{Principal: "owner@test.com", Role: dto.RoleOwner}}},
+		{Key: "readAccess", Value: []string{"reader@test.com"}},
+	}
+	result, err := s.client.Database("testdb").Collection("documentCollection").InsertOne(context.Background(), legacy)
+	s.Require().NoError(err)
+
+	// Call the method under test
+	_, err = s.service.MigrateAccess()
+
+	// Assertions
+	s.Require().NoError(err)
+	document, err := s.service.GetDocumentByID(result.InsertedID.(primitive.ObjectID).Hex())
+	s.Require().NoError(err)
+	s.Equal(dto.RoleOwner, service.EffectiveRole(document.ACL, "owner@test.com"))
+	s.Equal(dto.RoleViewer, service.EffectiveRole(document.ACL, "reader@test.com"))
+	s.Equal("", service.EffectiveRole(document.ACL, "legacy@test.com"))
+}
+
 func (s *DocumentServiceSuite) TestDeleteDocument() {
 	// Prepare test data
-	documents, err := s.service.GetAllDocuments(dto.Email{Email: "author@test.com"})
+	documents, err := s.listDocuments("author@test.com")
 	s.Require().NoError(err)
 	s.Require().Len(documents, 1)
 	documentID := documents[0].ID
 
-	// Declare the variable "deleted"
-	var deleted bool
+	// Only documents in the trash can be deleted for good, and only by their owners
+	deleted, err := s.service.DeleteDocument(documentID, "author@test.com")
+	s.NoError(err)
+	s.False(deleted)
+	s.Require().NoError(s.service.TrashDocument(documentID, "author@test.com", time.Hour))
+	deleted, err = s.service.DeleteDocument(documentID, "write@test.com")
+	s.NoError(err)
+	s.False(deleted)
 
 	// Call the method under test
-	deleted, err = s.service.DeleteDocument(documentID)
+	deleted, err = s.service.DeleteDocument(documentID, "author@test.com")
 
 	// Assertions
 	s.NoError(err)
 	s.Assert().Equal(true, deleted)
 
 	// Verify that the document is deleted
-	deletedDocument, err := s.service.GetDocumentByID(documentID)
+	count, err := s.client.Database("testdb").Collection("documentCollection").CountDocuments(context.Background(), bson.M{})
+	s.NoError(err)
+	s.Zero(count)
+}
+
+func (s *DocumentServiceSuite) TestTrashAndRestoreDocument() {
+	documents, err := s.listDocuments("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	documentID := documents[0].ID
+
+	s.Require().NoError(s.service.TrashDocument(documentID, "author@test.com", 24*time.Hour))
+	s.ErrorIs(s.service.TrashDocument(documentID, "author@test.com", 24*time.Hour), service.ErrDocumentNotFound)
+
+	// Nobody can open a trashed document, it only shows in the trash of its owners
+	_, err = s.service.GetDocumentByID(documentID)
 	s.Error(err)
-	s.Nil(deletedDocument)
-}
\ No newline at end of file
+	_, err = s.service.GetRole(documentID, "read@test.com")
+	s.ErrorIs(err, service.ErrDocumentNotFound)
+	page, err := s.service.ListDocuments("author@test.com", dto.DocumentListQuery{})
+	s.Require().NoError(err)
+	s.Empty(page.Documents)
+	trash, err := s.service.ListTrash("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(trash, 1)
+	s.Equal("author@test.com", trash[0].DeletedBy)
+	s.WithinDuration(trash[0].DeletedAt.Add(24*time.Hour), trash[0].PurgeAt, time.Second)
+	trash, err = s.service.ListTrash("write@test.com")
+	s.Require().NoError(err)
+	s.Empty(trash)
+
+	s.ErrorIs(s.service.RestoreDocument(documentID, "write@test.com"), service.ErrDocumentNotFound)
+	s.Require().NoError(s.service.RestoreDocument(documentID, "author@test.com"))
+	document, err := s.service.GetDocumentByID(documentID)
+	s.Require().NoError(err)
+	s.Equal("Test Document", document.Title)
+}
+
+func (s *DocumentServiceSuite) TestPurgeTrash() {
+	documents, err := s.listDocuments("read@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	expired := documents[0].ID
+	kept, err := s.service.CreateDocument("author@test.com", "Kept", "", nil)
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.service.TrashDocument(expired, "author@test.com", time.Hour))
+	s.Require().NoError(s.service.TrashDocument(kept, "author@test.com", 48*time.Hour))
+
+	purged, err := s.service.PurgeTrash(time.Now().Add(2 * time.Hour))
+	s.Require().NoError(err)
+	s.Equal([]string{expired}, purged)
+	trash, err := s.service.ListTrash("author@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(trash, 1)
+	s.Equal(kept, trash[0].ID)
+}
+
+func (s *DocumentServiceSuite) TestDuplicateDocument() {
+	documents, err := s.listDocuments("read@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(documents, 1)
+	body := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "Shared notes\n"}}}
+	s.Require().NoError(s.service.UpdateDocument(documents[0].ID, body, 1, "write@test.com"))
+
+	copyID, err := s.service.DuplicateDocument(documents[0].ID, "read@test.com", "")
+	s.Require().NoError(err)
+
+	// The copy belongs to the reader alone
+	duplicate, err := s.service.GetDocumentByID(copyID)
+	s.Require().NoError(err)
+	s.Equal("Copy of Test Document", duplicate.Title)
+	s.Equal("read@test.com", duplicate.Author)
+	s.Equal([]dto.ACLEntry{{Principal: "read@test.com", Role: dto.RoleOwner}}, duplicate.ACL)
+	s.Equal("Shared notes\n", duplicate.Data.Ops[0]["insert"])
+	s.Equal(2, duplicate.WordCount)
+}
+
+func (s *DocumentServiceSuite) TestCreateFromTemplate() {
+	templateID, err := s.service.CreateDocument("author@test.com", "Standup {{date}}", "", nil)
+	s.Require().NoError(err)
+	body := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "Notes by {{author}}\n"}}}
+	s.Require().NoError(s.service.UpdateDocument(templateID, body, 1, "author@test.com"))
+	template := &dto.Template{Scope: dto.TemplateScopeUser, MarkedBy: "author@test.com"}
+	s.Require().NoError(s.service.SetTemplate(templateID, template))
+
+	// User templates are only offered to the user who marked them
+	templates, err := s.service.ListTemplates("read@test.com")
+	s.Require().NoError(err)
+	s.Empty(templates)
+	_, err = s.service.CreateFromTemplate(templateID, "read@test.com", "")
+	s.ErrorIs(err, service.ErrTemplateNotFound)
+
+	template.Scope = dto.TemplateScopeGlobal
+	s.Require().NoError(s.service.SetTemplate(templateID, template))
+	templates, err = s.service.ListTemplates("read@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(templates, 1)
+	s.Equal(dto.TemplateScopeGlobal, templates[0].Template.Scope)
+
+	documentID, err := s.service.CreateFromTemplate(templateID, "read@test.com", "")
+	s.Require().NoError(err)
+	document, err := s.service.GetDocumentByID(documentID)
+	s.Require().NoError(err)
+	s.Equal("Standup "+time.Now().UTC().Format("2006-01-02"), document.Title)
+	s.Equal("Notes by read@test.com\n", document.Data.Ops[0]["insert"])
+	s.Equal("read@test.com", document.Author)
+	s.Nil(document.Template)
+
+	s.Require().NoError(s.service.SetTemplate(templateID, nil))
+	templates, err = s.service.ListTemplates("read@test.com")
+	s.Require().NoError(err)
+	s.Empty(templates)
+}
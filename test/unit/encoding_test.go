@@ -0,0 +1,86 @@
+package unit_tests
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/realtime"
+)
+
+// The benchmarks below compare the cost of relaying a keystroke the legacy way, with the whole
+// document sent along with the change as JSON, to the change-only messages of the realtime
+// protocol in JSON and MessagePack. Each reports the bytes sent by the editor, as they are and
+// deflated the way permessage-deflate would.
+
+func benchmarkDocument() dto.DocumentData {
+	paragraph := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20) + "\n"
+	ops := []map[string]interface{}{}
+	for i := 0; i < 50; i++ {
+		ops = append(ops, map[string]interface{}{"insert": paragraph})
+		ops = append(ops, map[string]interface{}{"insert": "Heading\n", "attributes": map[string]interface{}{"header": 2}})
+	}
+	return dto.DocumentData{Ops: ops}
+}
+
+func benchmarkChange() dto.DocumentData {
+	return dto.DocumentData{Ops: []map[string]interface{}{{"retain": 1234}, {"insert": "a"}}}
+}
+
+func reportSize(b *testing.B, message []byte) {
+	var compressed bytes.Buffer
+	writer, _ := flate.NewWriter(&compressed, flate.BestSpeed)
+	writer.Write(message)
+	writer.Close()
+	b.ReportMetric(float64(len(message)), "wire-B/msg")
+	b.ReportMetric(float64(compressed.Len()), "deflated-B/msg")
+}
+
+func BenchmarkLegacyEdit(b *testing.B) {
+	document, change := benchmarkDocument(), benchmarkChange()
+	raw, _ := json.Marshal(map[string]interface{}{"data": document, "Change": change})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var message dto.Message
+		if err := json.Unmarshal(raw, &message); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := json.Marshal(message.Change); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportSize(b, raw)
+}
+
+func benchmarkChangeOnlyEdit(b *testing.B, encoding *realtime.Encoding) {
+	document, change := benchmarkDocument(), benchmarkChange()
+	raw, _ := encoding.Encode(dto.MessageEdit, "m1", 1, dto.EditPayload{Change: change})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		envelope, protocolErr := encoding.ParseEnvelope(raw)
+		if protocolErr != nil {
+			b.Fatal(protocolErr)
+		}
+		edit, protocolErr := encoding.ParseEdit(envelope)
+		if protocolErr != nil {
+			b.Fatal(protocolErr)
+		}
+		// The server now applies the change to its copy of the document
+		realtime.Compose(document, edit.Change)
+		if _, err := encoding.Encode(dto.MessageEdit, "", 2, edit); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportSize(b, raw)
+}
+
+func BenchmarkChangeOnlyEditJSON(b *testing.B) {
+	benchmarkChangeOnlyEdit(b, realtime.JSON)
+}
+
+func BenchmarkChangeOnlyEditMessagePack(b *testing.B) {
+	benchmarkChangeOnlyEdit(b, realtime.MessagePack)
+}
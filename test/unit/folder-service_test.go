@@ -0,0 +1,108 @@
+package unit_tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FolderServiceSuite struct {
+	suite.Suite
+	service   service.FolderService
+	documents service.DocumentService
+	client    *mongo.Client
+}
+
+func TestFolderServiceSuite(t *testing.T) {
+	suite.Run(t, new(FolderServiceSuite))
+}
+
+func (s *FolderServiceSuite) SetupSuite() {
+	// Setup MongoDB connection
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update with your MongoDB URI
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.client = client
+
+	// Initialize the folder service, it files documents of the "documents" collection
+	s.service = service.NewFolderService(client, "testdb", "folders")
+	s.documents = service.NewDocumentService(client, "testdb", "documents")
+}
+
+func (s *FolderServiceSuite) SetupTest() {
+	// Cleanup existing data in the test database
+	for _, collection := range []string{"folders", "documents"} {
+		_, err := s.client.Database("testdb").Collection(collection).DeleteMany(context.Background(), bson.M{})
+		if err != nil {
+			s.T().Fatal(err)
+		}
+	}
+}
+
+func (s *FolderServiceSuite) TearDownSuite() {
+	// Close MongoDB connection after all tests
+	if err := s.client.Disconnect(context.Background()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *FolderServiceSuite) TestSharedFolderGrantsAccessToDocuments() {
+	parent, err := s.service.CreateFolder("owner@test.com", dto.CreateFolder{Name: "Team"})
+	s.Require().NoError(err)
+	child, err := s.service.CreateFolder("owner@test.com", dto.CreateFolder{Name: "Specs", ParentID: parent.ID})
+	s.Require().NoError(err)
+	s.Equal([]string{parent.ID}, child.Ancestors)
+	documentID, err := s.documents.CreateDocument("owner@test.com", "Spec", "Test body", nil)
+	s.Require().NoError(err)
+
+	moved, err := s.service.MoveDocument("owner@test.com", dto.MoveDocument{ID: documentID, FolderID: child.ID})
+	s.Require().NoError(err)
+	s.Equal(child.ID, moved.FolderID)
+
+	// Sharing the top folder reaches the document two levels down
+	changed, err := s.service.ShareFolder(parent.ID, "owner@test.com", dto.FolderShare{Principal: "reader@test.com", Role: dto.RoleViewer})
+	s.Require().NoError(err)
+	s.Equal([]string{documentID}, changed)
+	role, err := s.documents.GetRole(documentID, "reader@test.com")
+	s.Require().NoError(err)
+	s.Equal(dto.RoleViewer, role)
+
+	breadcrumbs, err := s.service.Breadcrumbs(child.ID, "reader@test.com")
+	s.Require().NoError(err)
+	s.Equal([]dto.Breadcrumb{{ID: parent.ID, Name: "Team"}, {ID: child.ID, Name: "Specs"}}, breadcrumbs)
+
+	// Revoking it takes the access away again
+	_, err = s.service.ShareFolder(parent.ID, "owner@test.com", dto.FolderShare{Principal: "reader@test.com"})
+	s.Require().NoError(err)
+	role, err = s.documents.GetRole(documentID, "reader@test.com")
+	s.Require().NoError(err)
+	s.Equal("", role)
+}
+
+func (s *FolderServiceSuite) TestMoveAndDeleteFolder() {
+	first, err := s.service.CreateFolder("owner@test.com", dto.CreateFolder{Name: "First"})
+	s.Require().NoError(err)
+	second, err := s.service.CreateFolder("owner@test.com", dto.CreateFolder{Name: "Second", ParentID: first.ID})
+	s.Require().NoError(err)
+
+	_, err = s.service.MoveFolder(first.ID, "owner@test.com", second.ID)
+	s.ErrorIs(err, service.ErrFolderCycle)
+	_, err = s.service.MoveFolder(second.ID, "stranger@test.com", "")
+	s.ErrorIs(err, service.ErrFolderNotFound)
+
+	_, err = s.service.DeleteFolder(first.ID, "owner@test.com")
+	s.Require().NoError(err)
+	contents, err := s.service.GetContents("", "owner@test.com")
+	s.Require().NoError(err)
+	s.Require().Len(contents.Folders, 1)
+	s.Equal(second.ID, contents.Folders[0].ID)
+	s.Empty(contents.Folders[0].Ancestors)
+}
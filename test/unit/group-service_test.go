@@ -0,0 +1,136 @@
+package unit_tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type GroupServiceSuite struct {
+	suite.Suite
+	service         service.GroupService
+	documentService service.DocumentService
+	client          *mongo.Client
+	group           *dto.Group
+}
+
+func TestGroupServiceSuite(t *testing.T) {
+	suite.Run(t, new(GroupServiceSuite))
+}
+
+func (s *GroupServiceSuite) SetupSuite() {
+	// Setup MongoDB connection
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update with your MongoDB URI
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.client = client
+
+	// Initialize the group service and the document service resolving group roles
+	s.service = service.NewGroupService(client, "testdb", "groups")
+	s.documentService = service.NewDocumentService(client, "testdb", "documents")
+}
+
+func (s *GroupServiceSuite) SetupTest() {
+	// Cleanup and prepare data before each test
+	for _, collection := range []string{"groups", "documents", "users"} {
+		_, err := s.client.Database("testdb").Collection(collection).DeleteMany(context.Background(), bson.M{})
+		if err != nil {
+			s.T().Fatal(err)
+		}
+	}
+	users := []interface{}{
+		bson.M{"email": "admin@test.com"},
+		bson.M{"email": "new@test.com"},
+		bson.M{"email": "member@test.com"},
+		bson.M{"email": "other@test.com"},
+	}
+	if _, err := s.client.Database("testdb").Collection("users").InsertMany(context.Background(), users); err != nil {
+		s.T().Fatal(err)
+	}
+
+	group, err := s.service.CreateGroup("admin@test.com", "Engineering")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.group = group
+}
+
+func (s *GroupServiceSuite) TearDownSuite() {
+	// Close MongoDB connection after all tests
+	if err := s.client.Disconnect(context.Background()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *GroupServiceSuite) TestMembersGetGroupRole() {
+	acl := []dto.ACLEntry{{Principal: service.GroupPrincipal(s.group.ID), Role: dto.RoleEditor}}
+	documentID, err := s.documentService.CreateDocument("owner@test.com", "Shared", "", acl)
+	s.Require().NoError(err)
+
+	_, err = s.service.AddMember(s.group.ID, "admin@test.com", dto.GroupMember{Email: "new@test.com"})
+	s.Require().NoError(err)
+
+	role, err := s.documentService.GetRole(documentID, "new@test.com")
+	s.NoError(err)
+	s.Equal(dto.RoleEditor, role)
+
+	// Removing the member revokes the role immediately
+	_, err = s.service.RemoveMember(s.group.ID, "admin@test.com", "new@test.com")
+	s.Require().NoError(err)
+
+	role, err = s.documentService.GetRole(documentID, "new@test.com")
+	s.NoError(err)
+	s.Equal("", role)
+}
+
+func (s *GroupServiceSuite) TestOnlyAdminsManageMembers() {
+	_, err := s.service.AddMember(s.group.ID, "admin@test.com", dto.GroupMember{Email: "member@test.com"})
+	s.Require().NoError(err)
+
+	_, err = s.service.AddMember(s.group.ID, "member@test.com", dto.GroupMember{Email: "other@test.com"})
+	s.ErrorIs(err, service.ErrNotGroupAdmin)
+}
+
+func (s *GroupServiceSuite) TestLastAdminCannotLeave() {
+	_, err := s.service.RemoveMember(s.group.ID, "admin@test.com", "admin@test.com")
+
+	s.ErrorIs(err, service.ErrLastGroupAdmin)
+}
+
+func (s *GroupServiceSuite) TestLastAdminCannotBeDemoted() {
+	_, err := s.service.AddMember(s.group.ID, "admin@test.com", dto.GroupMember{Email: "admin@test.com"})
+	s.ErrorIs(err, service.ErrLastGroupAdmin)
+
+	// Once there is another admin, either may step down
+	_, err = s.service.AddMember(s.group.ID, "admin@test.com", dto.GroupMember{Email: "new@test.com", Admin: true})
+	s.Require().NoError(err)
+	group, err := s.service.AddMember(s.group.ID, "admin@test.com", dto.GroupMember{Email: "admin@test.com"})
+	s.Require().NoError(err)
+	s.Equal([]string{"new@test.com"}, group.Admins)
+}
+
+func (s *GroupServiceSuite) TestAddMemberRejectsUnknownUser() {
+	_, err := s.service.AddMember(s.group.ID, "admin@test.com", dto.GroupMember{Email: "typo@test.com"})
+	s.ErrorIs(err, service.ErrPrincipalNotFound)
+}
+
+func (s *GroupServiceSuite) TestDeleteGroupRevokesRoles() {
+	acl := []dto.ACLEntry{{Principal: service.GroupPrincipal(s.group.ID), Role: dto.RoleViewer}}
+	documentID, err := s.documentService.CreateDocument("owner@test.com", "Shared", "", acl)
+	s.Require().NoError(err)
+
+	_, err = s.service.DeleteGroup(s.group.ID, "admin@test.com")
+	s.Require().NoError(err)
+
+	document, err := s.documentService.GetDocumentByID(documentID)
+	s.NoError(err)
+	s.Equal([]dto.ACLEntry{{Principal: "owner@test.com", Role: dto.RoleOwner}}, document.ACL)
+}
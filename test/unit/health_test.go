@@ -0,0 +1,123 @@
+package unit_tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/health"
+	"github.com/stretchr/testify/suite"
+)
+
+type HealthTestSuite struct {
+	suite.Suite
+	checker *health.Checker
+	server  *gin.Engine
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	suite.Run(t, &HealthTestSuite{})
+}
+
+// Setup code before running each test
+func (uts *HealthTestSuite) SetupTest() {
+	gin.SetMode(gin.TestMode)
+	uts.checker = health.NewChecker()
+	uts.server = gin.New()
+	uts.server.GET("/health/live", uts.checker.LiveHandler())
+	uts.server.GET("/health/ready", uts.checker.ReadyHandler())
+}
+
+func componentUp(ctx context.Context) health.Component {
+	return health.Component{Status: health.StatusUp}
+}
+
+func componentDown(ctx context.Context) health.Component {
+	return health.Component{Status: health.StatusDown, Error: "connection refused"}
+}
+
+// probe requests a health route, returning its status code and report
+func (uts *HealthTestSuite) probe(path string) (int, health.Report) {
+	recorder := httptest.NewRecorder()
+	uts.server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	var report health.Report
+	uts.Require().NoError(json.Unmarshal(recorder.Body.Bytes(), &report))
+	return recorder.Code, report
+}
+
+func (uts *HealthTestSuite) TestReady() {
+	uts.checker.Add("mongo", componentUp)
+	uts.checker.Add("cache", componentUp)
+
+	code, report := uts.probe("/health/ready")
+	uts.Equal(http.StatusOK, code)
+	uts.Equal(health.StatusUp, report.Status)
+	uts.Equal(health.StatusUp, report.Components["mongo"].Status)
+	uts.Equal(health.StatusUp, report.Components["cache"].Status)
+	uts.Equal(false, report.Components["lifecycle"].Details["draining"])
+}
+
+func (uts *HealthTestSuite) TestComponentDown() {
+	uts.checker.Add("mongo", componentDown)
+	uts.checker.Add("cache", componentUp)
+
+	code, report := uts.probe("/health/ready")
+	uts.Equal(http.StatusServiceUnavailable, code)
+	uts.Equal(health.StatusDown, report.Status)
+	uts.Equal("connection refused", report.Components["mongo"].Error)
+	uts.Equal(health.StatusUp, report.Components["cache"].Status)
+
+	// The server is still alive, restarting it wouldn't bring MongoDB back
+	code, report = uts.probe("/health/live")
+	uts.Equal(http.StatusOK, code)
+	uts.Equal(health.StatusUp, report.Status)
+}
+
+func (uts *HealthTestSuite) TestDraining() {
+	uts.checker.Add("mongo", componentUp)
+	uts.checker.Drain()
+
+	code, report := uts.probe("/health/ready")
+	uts.Equal(http.StatusServiceUnavailable, code)
+	uts.Equal(health.StatusDown, report.Components["lifecycle"].Status)
+	uts.Equal(true, report.Components["lifecycle"].Details["draining"])
+	uts.Equal(health.StatusUp, report.Components["mongo"].Status)
+}
+
+func (uts *HealthTestSuite) TestCheckTimeout() {
+	uts.checker.Timeout = 50 * time.Millisecond
+	uts.checker.Add("mongo", func(ctx context.Context) health.Component {
+		<-ctx.Done()
+		return health.Component{Status: health.StatusDown, Error: ctx.Err().Error()}
+	})
+
+	started := time.Now()
+	report := uts.checker.Ready(context.Background())
+	uts.Less(time.Since(started), time.Second)
+	uts.Equal(health.StatusDown, report.Status)
+	uts.Equal(context.DeadlineExceeded.Error(), report.Components["mongo"].Error)
+}
+
+func (uts *HealthTestSuite) TestFlushLag() {
+	now := time.Now()
+	dirty := 0
+	check := health.FlushLag(func() time.Time { return now.Add(-5 * time.Minute) }, func() int { return dirty }, time.Minute)
+
+	// An old flush doesn't matter while there is nothing to save
+	component := check(context.Background())
+	uts.Equal(health.StatusUp, component.Status)
+	uts.Equal(0, component.Details["dirtyDocuments"])
+
+	dirty = 3
+	component = check(context.Background())
+	uts.Equal(health.StatusDown, component.Status)
+	uts.Equal(3, component.Details["dirtyDocuments"])
+	uts.NotEmpty(component.Error)
+
+	recent := health.FlushLag(func() time.Time { return now }, func() int { return dirty }, time.Minute)
+	uts.Equal(health.StatusUp, recent(context.Background()).Status)
+}
@@ -0,0 +1,196 @@
+package unit_tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/khallihub/godoc/realtime"
+	"github.com/stretchr/testify/suite"
+)
+
+type HubTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+	conns  chan *websocket.Conn
+	opened []string
+	closed []string
+}
+
+func TestHubTestSuite(t *testing.T) {
+	suite.Run(t, &HubTestSuite{})
+}
+
+func (uts *HubTestSuite) SetupSuite() {
+	// Setup code before running the tests in the suite
+	upgrader := websocket.Upgrader{}
+	uts.conns = make(chan *websocket.Conn, 1)
+	uts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			uts.conns <- conn
+		}
+	}))
+}
+
+func (uts *HubTestSuite) SetupTest() {
+	// Setup code before each test
+	uts.opened, uts.closed = nil, nil
+}
+
+func (uts *HubTestSuite) TearDownSuite() {
+	// Teardown code after running all the tests in the suite
+	uts.server.Close()
+}
+
+func (uts *HubTestSuite) registry() *realtime.Registry {
+	return realtime.NewRegistry(10, func(documentID string) (int64, error) {
+		uts.opened = append(uts.opened, documentID)
+		return 7, nil
+	}, func(documentID string) {
+		uts.closed = append(uts.closed, documentID)
+	})
+}
+
+// connect opens a connection and returns the client serving it and the remote end
+func (uts *HubTestSuite) connect() (*realtime.Client, *websocket.Conn) {
+	remote, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(uts.server.URL, "http"), nil)
+	uts.Require().NoError(err)
+	client := &realtime.Client{}
+	client.Attach(<-uts.conns)
+	return client, remote
+}
+
+func (uts *HubTestSuite) read(remote *websocket.Conn) string {
+	remote.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := remote.ReadMessage()
+	uts.Require().NoError(err)
+	return string(message)
+}
+
+func (uts *HubTestSuite) TestBroadcastSkipsSource() {
+	registry := uts.registry()
+	first, firstRemote := uts.connect()
+	second, secondRemote := uts.connect()
+	defer firstRemote.Close()
+	defer secondRemote.Close()
+
+	hub, err := registry.Join("doc", first, nil)
+	uts.Require().NoError(err)
+	var revision int64
+	_, err = registry.Join("doc", second, func(hub *realtime.Hub) {
+		revision = hub.Changes.Revision()
+	})
+	uts.Require().NoError(err)
+	// The document is opened once, at the revision it was loaded with
+	uts.Equal([]string{"doc"}, uts.opened)
+	uts.Equal(int64(7), revision)
+
+	hub.Mutex.Lock()
+	hub.Broadcast(first, func(client *realtime.Client) []byte { return []byte("hello") })
+	hub.Mutex.Unlock()
+	uts.Equal("hello", uts.read(secondRemote))
+
+	firstRemote.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = firstRemote.ReadMessage()
+	uts.Error(err)
+}
+
+func (uts *HubTestSuite) TestLocked() {
+	registry := uts.registry()
+	client, remote := uts.connect()
+	defer remote.Close()
+
+	// Sessions can't join a document while it's locked without a hub
+	joined := make(chan struct{})
+	registry.Locked("doc", func(hub *realtime.Hub) {
+		uts.Nil(hub)
+		go func() {
+			registry.Join("doc", client, nil)
+			close(joined)
+		}()
+		select {
+		case <-joined:
+			uts.Fail("joined a locked document")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	<-joined
+
+	registry.Locked("doc", func(hub *realtime.Hub) {
+		uts.Require().NotNil(hub)
+		uts.False(hub.Mutex.TryLock())
+	})
+	hub, _ := registry.Get("doc")
+	uts.True(hub.Mutex.TryLock())
+	hub.Mutex.Unlock()
+}
+
+func (uts *HubTestSuite) TestLastLeaveClosesDocument() {
+	registry := uts.registry()
+	first, firstRemote := uts.connect()
+	second, secondRemote := uts.connect()
+	defer firstRemote.Close()
+	defer secondRemote.Close()
+
+	hub, err := registry.Join("doc", first, nil)
+	uts.Require().NoError(err)
+	_, err = registry.Join("doc", second, nil)
+	uts.Require().NoError(err)
+
+	registry.Leave(hub, first, nil)
+	uts.Empty(uts.closed)
+	registry.Leave(hub, second, nil)
+	uts.Equal([]string{"doc"}, uts.closed)
+	_, ok := registry.Get("doc")
+	uts.False(ok)
+
+	// Joining again opens the document again
+	_, err = registry.Join("doc", first, nil)
+	uts.Require().NoError(err)
+	uts.Equal([]string{"doc", "doc"}, uts.opened)
+}
+
+func (uts *HubTestSuite) TestJoinFailsWhenDocumentCantOpen() {
+	registry := realtime.NewRegistry(10, func(documentID string) (int64, error) {
+		return 0, errors.New("not found")
+	}, func(documentID string) {})
+	client, remote := uts.connect()
+	defer remote.Close()
+	defer client.Close()
+
+	_, err := registry.Join("doc", client, nil)
+	uts.Error(err)
+	_, ok := registry.Get("doc")
+	uts.False(ok)
+}
+
+func (uts *HubTestSuite) TestSlowClientIsDisconnected() {
+	registry := uts.registry()
+	slow, slowRemote := uts.connect()
+	fast, fastRemote := uts.connect()
+	defer slowRemote.Close()
+	defer fastRemote.Close()
+	hub, err := registry.Join("doc", slow, nil)
+	uts.Require().NoError(err)
+	_, err = registry.Join("doc", fast, nil)
+	uts.Require().NoError(err)
+
+	// The slow client never reads, its queue fills up once the connection is backed up
+	message := []byte(strings.Repeat("x", 64*1024))
+	disconnected := false
+	for i := 0; i < 10000 && !disconnected; i++ {
+		disconnected = !slow.Send(message)
+	}
+	uts.True(disconnected)
+
+	// The others aren't held up
+	hub.Mutex.Lock()
+	hub.Broadcast(slow, func(client *realtime.Client) []byte { return []byte("still here") })
+	hub.Mutex.Unlock()
+	uts.Equal("still here", uts.read(fastRemote))
+}
@@ -0,0 +1,111 @@
+package unit_tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// recordingMailService keeps the last message instead of sending it
+type recordingMailService struct {
+	to   string
+	body string
+}
+
+func (mail *recordingMailService) Send(to string, subject string, body string) error {
+	mail.to, mail.body = to, body
+	return nil
+}
+
+type InvitationServiceSuite struct {
+	suite.Suite
+	service service.InvitationService
+	mail    *recordingMailService
+	client  *mongo.Client
+}
+
+func TestInvitationServiceSuite(t *testing.T) {
+	suite.Run(t, new(InvitationServiceSuite))
+}
+
+func (s *InvitationServiceSuite) SetupSuite() {
+	// Setup MongoDB connection
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update with your MongoDB URI
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.client = client
+
+	// Initialize the invitation service
+	s.mail = &recordingMailService{}
+	s.service = service.NewInvitationService(client, "testdb", "invitations", s.mail)
+}
+
+func (s *InvitationServiceSuite) SetupTest() {
+	// Cleanup existing data in the test database
+	_, err := s.client.Database("testdb").Collection("invitations").DeleteMany(context.Background(), bson.M{})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *InvitationServiceSuite) TearDownSuite() {
+	// Close MongoDB connection after all tests
+	if err := s.client.Disconnect(context.Background()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+// token reads the invitation token from the link in the last mail
+func (s *InvitationServiceSuite) token() string {
+	_, token, found := strings.Cut(s.mail.body, "token=")
+	s.Require().True(found)
+	return token
+}
+
+func (s *InvitationServiceSuite) TestCreateAndAccept() {
+	invitation, err := s.service.CreateInvitation("doc1", "owner@test.com", "Invitee@test.com", dto.RoleEditor)
+	s.Require().NoError(err)
+	s.Equal("invitee@test.com", invitation.Email)
+	s.Equal("invitee@test.com", s.mail.to)
+	token := s.token()
+
+	invitations, err := s.service.ListInvitations("doc1")
+	s.Require().NoError(err)
+	s.Len(invitations, 1)
+
+	// Invitations can only be used from the invited address, and only once
+	_, err = s.service.AcceptInvitation(token, "other@test.com")
+	s.ErrorIs(err, service.ErrInvalidInvitation)
+	accepted, err := s.service.AcceptInvitation(token, "invitee@test.com")
+	s.Require().NoError(err)
+	s.Equal("doc1", accepted.DocumentID)
+	s.Equal(dto.RoleEditor, accepted.Role)
+	_, err = s.service.AcceptInvitation(token, "invitee@test.com")
+	s.ErrorIs(err, service.ErrInvalidInvitation)
+}
+
+func (s *InvitationServiceSuite) TestReinviteReplacesInvitation() {
+	_, err := s.service.CreateInvitation("doc1", "owner@test.com", "invitee@test.com", dto.RoleViewer)
+	s.Require().NoError(err)
+	first := s.token()
+	invitation, err := s.service.CreateInvitation("doc1", "owner@test.com", "invitee@test.com", dto.RoleCommenter)
+	s.Require().NoError(err)
+
+	invitations, err := s.service.ListInvitations("doc1")
+	s.Require().NoError(err)
+	s.Len(invitations, 1)
+	_, err = s.service.AcceptInvitation(first, "invitee@test.com")
+	s.ErrorIs(err, service.ErrInvalidInvitation)
+
+	s.Require().NoError(s.service.RevokeInvitation("doc1", invitation.ID))
+	s.ErrorIs(s.service.RevokeInvitation("doc1", invitation.ID), service.ErrInvitationNotFound)
+}
@@ -46,4 +46,23 @@ func (uts *JWTServiceTestSuite) TestValidateToken() {
 
 	// Assert that token was validated
 	uts.Nil(err)
-}
\ No newline at end of file
+}
+func (uts *JWTServiceTestSuite) TestMFATokenRoundTrip() {
+	name := "author@test.com"
+
+	// An MFA pending token resolves back to the user it was issued for
+	token := uts.jwtService.GenerateMFAToken(name)
+	email, err := uts.jwtService.ValidateMFAToken(token)
+
+	uts.Nil(err)
+	uts.Equal(name, email)
+}
+
+func (uts *JWTServiceTestSuite) TestSessionTokenIsNotMFAToken() {
+	token := uts.jwtService.GenerateToken("author@test.com", false)
+
+	// A regular session token must not be accepted as the first step of a two-factor login
+	_, err := uts.jwtService.ValidateMFAToken(token)
+
+	uts.NotNil(err)
+}
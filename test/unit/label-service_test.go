@@ -0,0 +1,176 @@
+package unit_tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LabelServiceSuite struct {
+	suite.Suite
+	service   service.LabelService
+	documents service.DocumentService
+	client    *mongo.Client
+}
+
+func TestLabelServiceSuite(t *testing.T) {
+	suite.Run(t, new(LabelServiceSuite))
+}
+
+func (s *LabelServiceSuite) SetupSuite() {
+	// Setup MongoDB connection
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update with your MongoDB URI
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.client = client
+
+	// Initialize the label service, the document service reads its "documentlabels" collection
+	s.service = service.NewLabelService(client, "testdb", "documentlabels")
+	s.documents = service.NewDocumentService(client, "testdb", "documents")
+}
+
+func (s *LabelServiceSuite) SetupTest() {
+	// Cleanup existing data in the test database
+	for _, collection := range []string{"documentlabels", "documents"} {
+		_, err := s.client.Database("testdb").Collection(collection).DeleteMany(context.Background(), bson.M{})
+		if err != nil {
+			s.T().Fatal(err)
+		}
+	}
+}
+
+func (s *LabelServiceSuite) TearDownSuite() {
+	// Close MongoDB connection after all tests
+	if err := s.client.Disconnect(context.Background()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *LabelServiceSuite) createShared(title string) string {
+	acl := []dto.ACLEntry{
+		{Principal: "owner@test.com", Role: dto.RoleOwner},
+		{Principal: "editor@test.com", Role: dto.RoleEditor},
+	}
+	documentID, err := s.documents.CreateDocument("owner@test.com", title, map[string]interface{}{}, acl)
+	s.Require().NoError(err)
+	return documentID
+}
+
+func (s *LabelServiceSuite) TestLabelsArePrivateToEachUser() {
+	documentID := s.createShared("Roadmap")
+
+	_, err := s.service.SetStarred(documentID, "owner@test.com", true)
+	s.Require().NoError(err)
+	labels, err := s.service.UpdateLabels("owner@test.com", dto.LabelUpdate{DocumentID: documentID, Add: []string{" q3 ", "planning", "q3"}})
+	s.Require().NoError(err)
+	s.True(labels.Starred)
+	s.Equal([]string{"q3", "planning"}, labels.Labels)
+
+	mine, err := s.documents.ListDocuments("owner@test.com", dto.DocumentListQuery{Starred: true})
+	s.Require().NoError(err)
+	s.Require().Len(mine.Documents, 1)
+	s.True(mine.Documents[0].Starred)
+	s.Equal([]string{"q3", "planning"}, mine.Documents[0].Labels)
+
+	// The editor sees the document but none of the owner's marks
+	theirs, err := s.documents.ListDocuments("editor@test.com", dto.DocumentListQuery{})
+	s.Require().NoError(err)
+	s.Require().Len(theirs.Documents, 1)
+	s.False(theirs.Documents[0].Starred)
+	s.Empty(theirs.Documents[0].Labels)
+	starred, err := s.documents.ListDocuments("editor@test.com", dto.DocumentListQuery{Starred: true})
+	s.Require().NoError(err)
+	s.Empty(starred.Documents)
+	counts, err := s.service.ListLabels("editor@test.com")
+	s.Require().NoError(err)
+	s.Empty(counts)
+}
+
+func (s *LabelServiceSuite) TestUpdateLabelsAddsAndRemoves() {
+	documentID := s.createShared("Notes")
+
+	_, err := s.service.UpdateLabels("owner@test.com", dto.LabelUpdate{DocumentID: documentID, Add: []string{"draft", "ideas"}})
+	s.Require().NoError(err)
+	labels, err := s.service.UpdateLabels("owner@test.com", dto.LabelUpdate{DocumentID: documentID, Add: []string{"final"}, Remove: []string{"draft"}})
+	s.Require().NoError(err)
+	s.Equal([]string{"ideas", "final"}, labels.Labels)
+
+	page, err := s.documents.ListDocuments("owner@test.com", dto.DocumentListQuery{Label: "final"})
+	s.Require().NoError(err)
+	s.Len(page.Documents, 1)
+	page, err = s.documents.ListDocuments("owner@test.com", dto.DocumentListQuery{Label: "draft"})
+	s.Require().NoError(err)
+	s.Empty(page.Documents)
+
+	counts, err := s.service.ListLabels("owner@test.com")
+	s.Require().NoError(err)
+	s.Equal([]*dto.LabelCount{{Label: "final", Count: 1}, {Label: "ideas", Count: 1}}, counts)
+
+	// Unmarking everything leaves no entry behind
+	_, err = s.service.UpdateLabels("owner@test.com", dto.LabelUpdate{DocumentID: documentID, Remove: []string{"ideas", "final"}})
+	s.Require().NoError(err)
+	count, err := s.client.Database("testdb").Collection("documentlabels").CountDocuments(context.Background(), bson.M{})
+	s.Require().NoError(err)
+	s.Zero(count)
+}
+
+func (s *LabelServiceSuite) TestSharedTagsFilterListsAndSearches() {
+	tagged := s.createShared("Launch plan")
+	s.createShared("Launch retro")
+
+	tags, err := s.documents.UpdateTags(dto.LabelUpdate{DocumentID: tagged, Add: []string{"marketing", "2024"}})
+	s.Require().NoError(err)
+	s.Equal([]string{"marketing", "2024"}, tags)
+	tags, err = s.documents.UpdateTags(dto.LabelUpdate{DocumentID: tagged, Remove: []string{"2024"}})
+	s.Require().NoError(err)
+	s.Equal([]string{"marketing"}, tags)
+
+	// Tags are shared, every collaborator filters on them
+	page, err := s.documents.ListDocuments("editor@test.com", dto.DocumentListQuery{Tag: "marketing"})
+	s.Require().NoError(err)
+	s.Require().Len(page.Documents, 1)
+	s.Equal([]string{"marketing"}, page.Documents[0].Tags)
+
+	results, err := s.documents.SearchDocuments("editor@test.com", dto.Search{SearchQuery: "launch", Tag: "marketing"})
+	s.Require().NoError(err)
+	s.Require().Len(results, 1)
+	s.Equal(tagged, results[0].ID)
+
+	_, err = s.service.SetStarred(tagged, "editor@test.com", true)
+	s.Require().NoError(err)
+	results, err = s.documents.SearchDocuments("owner@test.com", dto.Search{SearchQuery: "launch", Starred: true})
+	s.Require().NoError(err)
+	s.Empty(results)
+	results, err = s.documents.SearchDocuments("editor@test.com", dto.Search{SearchQuery: "launch", Starred: true})
+	s.Require().NoError(err)
+	s.Len(results, 1)
+}
+
+func (s *LabelServiceSuite) TestTagsStartingWithDollarAreStoredAsIs() {
+	documentID := s.createShared("Pricing")
+
+	tags, err := s.documents.UpdateTags(dto.LabelUpdate{DocumentID: documentID, Add: []string{"$acl", "$data", "$$this"}})
+	s.Require().NoError(err)
+	s.Equal([]string{"$acl", "$data", "$$this"}, tags)
+	tags, err = s.documents.UpdateTags(dto.LabelUpdate{DocumentID: documentID, Remove: []string{"$acl"}})
+	s.Require().NoError(err)
+	s.Equal([]string{"$data", "$$this"}, tags)
+
+	labels, err := s.service.UpdateLabels("owner@test.com", dto.LabelUpdate{DocumentID: documentID, Add: []string{"$title"}})
+	s.Require().NoError(err)
+	s.Equal([]string{"$title"}, labels.Labels)
+
+	// The document still decodes for the collaborators listing it
+	page, err := s.documents.ListDocuments("editor@test.com", dto.DocumentListQuery{Tag: "$data"})
+	s.Require().NoError(err)
+	s.Require().Len(page.Documents, 1)
+	s.Equal([]string{"$data", "$$this"}, page.Documents[0].Tags)
+}
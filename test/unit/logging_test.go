@@ -0,0 +1,93 @@
+package unit_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/logging"
+	"github.com/khallihub/godoc/middlewares"
+	"github.com/stretchr/testify/suite"
+)
+
+type LoggingTestSuite struct {
+	suite.Suite
+}
+
+func TestLoggingTestSuite(t *testing.T) {
+	suite.Run(t, &LoggingTestSuite{})
+}
+
+func (uts *LoggingTestSuite) TestRedactsSensitiveAttributes() {
+	var output bytes.Buffer
+	logger := logging.New(&output, "info", "json")
+	logger.Info("Signing in", "email", "someone@example.com", "Password", "hunter2", "token", "eyJ", "data", map[string]string{"insert": "secret plans"})
+
+	var line map[string]interface{}
+	uts.Require().NoError(json.Unmarshal(output.Bytes(), &line))
+	uts.Equal("someone@example.com", line["email"])
+	uts.Equal(logging.Redacted, line["Password"])
+	uts.Equal(logging.Redacted, line["token"])
+	uts.Equal(logging.Redacted, line["data"])
+	uts.NotContains(output.String(), "secret plans")
+}
+
+func (uts *LoggingTestSuite) TestLevel() {
+	var output bytes.Buffer
+	logger := logging.New(&output, "warn", "text")
+	logger.Info("hidden")
+	logger.Warn("shown")
+	uts.NotContains(output.String(), "hidden")
+	uts.Contains(output.String(), "shown")
+
+	// Unknown levels fall back to info
+	output.Reset()
+	logging.New(&output, "loud", "text").Debug("hidden")
+	uts.Empty(output.String())
+}
+
+func (uts *LoggingTestSuite) TestRedactURL() {
+	u, _ := url.Parse("/documents/handler?document_id=abc&token=eyJ")
+	uts.Equal("/documents/handler?document_id=abc&token=%5BREDACTED%5D", logging.RedactURL(u))
+
+	u, _ = url.Parse("/documents/list?page=2")
+	uts.Equal("/documents/list?page=2", logging.RedactURL(u))
+}
+
+func (uts *LoggingTestSuite) TestRequestID() {
+	uts.Equal("lb-1234_abcd", logging.RequestID("lb-1234_abcd"))
+	// IDs that could forge log lines or bloat them are replaced
+	for _, received := range []string{"", "two\nlines", strings.Repeat("a", 65)} {
+		id := logging.RequestID(received)
+		uts.NotEqual(received, id)
+		uts.Len(id, 16)
+	}
+}
+
+func (uts *LoggingTestSuite) TestRequestIDMiddleware() {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middlewares.RequestID())
+	router.GET("/", func(ctx *gin.Context) {
+		ctx.String(http.StatusOK, ctx.GetString("requestID"))
+	})
+
+	// The ID given by the load balancer is kept
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(logging.RequestIDHeader, "from-the-lb")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	uts.Equal("from-the-lb", recorder.Header().Get(logging.RequestIDHeader))
+	uts.Equal("from-the-lb", recorder.Body.String())
+
+	// Requests reaching the server directly get one
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	uts.Len(recorder.Header().Get(logging.RequestIDHeader), 16)
+	uts.Equal(recorder.Header().Get(logging.RequestIDHeader), recorder.Body.String())
+}
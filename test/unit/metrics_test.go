@@ -0,0 +1,70 @@
+package unit_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsTestSuite struct {
+	suite.Suite
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, &MetricsTestSuite{})
+}
+
+// requests returns the number of requests recorded with a route and status
+func (uts *MetricsTestSuite) requests(route string, status string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	uts.Require().NoError(err)
+	for _, family := range families {
+		if family.GetName() != "godoc_http_requests_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["route"] == route && labels["status"] == status {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func (uts *MetricsTestSuite) TestHTTPRecordsRoutes() {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(metrics.HTTP())
+	router.GET("/documents/:id", func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+
+	before := uts.requests("/documents/:id", "204")
+	for _, path := range []string{"/documents/a", "/documents/b", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	// Requests are recorded by route, not by path
+	uts.Equal(before+2, uts.requests("/documents/:id", "204"))
+	uts.Equal(1.0, uts.requests("unmatched", "404"))
+}
+
+func (uts *MetricsTestSuite) TestForgetDocument() {
+	metrics.RealtimeSessions.WithLabelValues("doc", "websocket", "edit").Inc()
+	metrics.RealtimeSessions.WithLabelValues("doc", "event-stream", "view").Inc()
+	metrics.RealtimeSessions.WithLabelValues("other", "websocket", "edit").Inc()
+	uts.Equal(3, testutil.CollectAndCount(metrics.RealtimeSessions))
+
+	metrics.ForgetDocument("doc")
+	uts.Equal(1, testutil.CollectAndCount(metrics.RealtimeSessions))
+	metrics.ForgetDocument("other")
+}
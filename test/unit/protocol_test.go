@@ -0,0 +1,94 @@
+package unit_tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/realtime"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProtocolTestSuite struct {
+	suite.Suite
+}
+
+func TestProtocolTestSuite(t *testing.T) {
+	suite.Run(t, &ProtocolTestSuite{})
+}
+
+func (uts *ProtocolTestSuite) TestParseEdit() {
+	raw := `{"v":1,"type":"edit","id":"m1","rev":4,"payload":{"change":{"ops":[{"retain":3},{"insert":"a"}]},"data":{"ops":[{"insert":"abca\n"}]},"author":"someone@else.com"}}`
+
+	envelope, err := realtime.JSON.ParseEnvelope([]byte(raw))
+	uts.Require().Nil(err)
+	uts.Equal("m1", envelope.ID)
+	uts.Equal(int64(4), envelope.Revision)
+
+	edit, err := realtime.JSON.ParseEdit(envelope)
+	uts.Require().Nil(err)
+	uts.Len(edit.Change.Ops, 2)
+	// Clients don't get to set the author
+	uts.Empty(edit.Author)
+}
+
+func (uts *ProtocolTestSuite) TestParseEnvelopeRejectsInvalidMessages() {
+	cases := map[string]string{
+		`not json`:                       dto.ErrorInvalidMessage,
+		`{"v":2,"type":"ping"}`:          dto.ErrorUnsupportedVersion,
+		`{"v":1,"type":"ack"}`:           dto.ErrorUnknownType,
+		`{"v":1,"type":"ping","rev":-1}`: dto.ErrorInvalidMessage,
+		`{"v":1,"type":"edit"}`:          dto.ErrorInvalidMessage,
+	}
+	for raw, code := range cases {
+		_, err := realtime.JSON.ParseEnvelope([]byte(raw))
+		uts.Require().NotNil(err, raw)
+		uts.Equal(code, err.Code, raw)
+	}
+}
+
+func (uts *ProtocolTestSuite) TestParseEditRejectsInvalidDeltas() {
+	changes := []string{
+		`{"change":{"ops":[]},"data":{"ops":[]}}`,
+		`{"change":{"ops":[{"insert":"a","retain":1}]},"data":{"ops":[]}}`,
+		`{"change":{"ops":[{"retain":1.5}]},"data":{"ops":[]}}`,
+		`{"change":{"ops":[{"delete":1,"attributes":{"bold":true}}]},"data":{"ops":[]}}`,
+		`{"change":{"ops":[{"insert":""}]},"data":{"ops":[]}}`,
+	}
+	for _, payload := range changes {
+		envelope := &dto.Envelope{Version: dto.ProtocolVersion, Type: dto.MessageEdit, ID: "m1", Payload: json.RawMessage(payload)}
+		_, err := realtime.JSON.ParseEdit(envelope)
+		uts.Require().NotNil(err, payload)
+		uts.Equal(dto.ErrorInvalidPayload, err.Code, payload)
+	}
+}
+
+func (uts *ProtocolTestSuite) TestEncodeError() {
+	var envelope dto.Envelope
+	uts.Require().NoError(json.Unmarshal(realtime.JSON.EncodeError("m1", &realtime.ProtocolError{Code: dto.ErrorReadOnly, Message: "no"}), &envelope))
+
+	uts.Equal(dto.ProtocolVersion, envelope.Version)
+	uts.Equal(dto.MessageError, envelope.Type)
+	uts.Equal("m1", envelope.ID)
+	uts.JSONEq(`{"code":"read-only","message":"no"}`, string(envelope.Payload))
+}
+
+func (uts *ProtocolTestSuite) TestMessagePackRoundTrip() {
+	change := dto.DocumentData{Ops: []map[string]interface{}{
+		{"retain": 3},
+		{"insert": "a", "attributes": map[string]interface{}{"bold": true}},
+	}}
+	raw, err := realtime.MessagePack.Encode(dto.MessageEdit, "m1", 3, dto.EditPayload{Change: change})
+	uts.Require().NoError(err)
+
+	envelope, protocolErr := realtime.MessagePack.ParseEnvelope(raw)
+	uts.Require().Nil(protocolErr)
+	uts.Equal(int64(3), envelope.Revision)
+	// Edits carry the change alone, the server applies it to its copy of the document
+	edit, protocolErr := realtime.MessagePack.ParseEdit(envelope)
+	uts.Require().Nil(protocolErr)
+	uts.Nil(edit.Data)
+
+	document := dto.DocumentData{Ops: []map[string]interface{}{{"insert": "abc\n"}}}
+	uts.Equal(realtime.Compose(document, change), realtime.Compose(document, edit.Change))
+}
@@ -0,0 +1,62 @@
+package unit_tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+)
+
+type SearchTestSuite struct {
+	suite.Suite
+}
+
+func TestSearchTestSuite(t *testing.T) {
+	suite.Run(t, &SearchTestSuite{})
+}
+
+func (uts *SearchTestSuite) TestPlainTextSkipsEmbeds() {
+	data := dto.DocumentData{Ops: []map[string]interface{}{
+		{"insert": "Hello "},
+		{"insert": "world", "attributes": map[string]interface{}{"bold": true}},
+		{"insert": map[string]interface{}{"image": "cat.png"}},
+		{"insert": "\n"},
+	}}
+
+	uts.Equal("Hello world\n", service.PlainText(data))
+}
+
+func (uts *SearchTestSuite) TestSearchTerms() {
+	uts.Equal([]string{"annual", "report"}, service.SearchTerms(`"Annual"  Report -draft`))
+}
+
+func (uts *SearchTestSuite) TestSnippetHighlightsAndEscapes() {
+	snippet := service.Snippet("Cats <b>and</b>\n\ndogs, more cats", []string{"cats"})
+
+	uts.Equal("<mark>Cats</mark> &lt;b&gt;and&lt;/b&gt; dogs, more <mark>cats</mark>", snippet)
+}
+
+func (uts *SearchTestSuite) TestSnippetCentersOnFirstMatch() {
+	text := strings.Repeat("filler words ", 40) + "needle " + strings.Repeat("tail ", 40)
+
+	snippet := service.Snippet(text, []string{"needle"})
+	uts.True(strings.HasPrefix(snippet, "… "))
+	uts.True(strings.HasSuffix(snippet, "…"))
+	uts.Contains(snippet, "<mark>needle</mark>")
+
+	// Without a match the excerpt is the start of the text
+	uts.True(strings.HasPrefix(service.Snippet(text, []string{"missing"}), "filler words"))
+}
+
+func (uts *SearchTestSuite) TestCountText() {
+	words, chars := service.CountText("Héllo  wide\nworld\n")
+
+	uts.Equal(3, words)
+	uts.Equal(16, chars)
+}
+
+func (uts *SearchTestSuite) TestNormalizeLabels() {
+	uts.Equal([]string{"draft", "Q3"}, service.NormalizeLabels([]string{" draft", "", "Q3", "draft ", "  "}))
+}
@@ -0,0 +1,100 @@
+package unit_tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ShareLinkServiceSuite struct {
+	suite.Suite
+	service service.ShareLinkService
+	client  *mongo.Client
+}
+
+func TestShareLinkServiceSuite(t *testing.T) {
+	suite.Run(t, new(ShareLinkServiceSuite))
+}
+
+func (s *ShareLinkServiceSuite) SetupSuite() {
+	// Setup MongoDB connection
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update with your MongoDB URI
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.client = client
+
+	// Initialize the share link service
+	s.service = service.NewShareLinkService(client, "testdb", "sharelinks")
+}
+
+func (s *ShareLinkServiceSuite) SetupTest() {
+	// Cleanup existing data in the test database
+	_, err := s.client.Database("testdb").Collection("sharelinks").DeleteMany(context.Background(), bson.M{})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *ShareLinkServiceSuite) TearDownSuite() {
+	// Close MongoDB connection after all tests
+	if err := s.client.Disconnect(context.Background()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *ShareLinkServiceSuite) TestCreateAndResolve() {
+	request := dto.CreateShareLink{DocumentID: "doc1", Role: dto.RoleViewer, ExpiresInHours: 24}
+
+	token, link, err := s.service.CreateLink("owner@test.com", request)
+	s.Require().NoError(err)
+	s.NotEmpty(token)
+	s.NotNil(link.ExpiresAt)
+
+	resolved, err := s.service.Resolve(token, "", "")
+	s.Require().NoError(err)
+	s.Equal(link.ID, resolved.ID)
+	s.Equal(dto.RoleViewer, resolved.Role)
+
+	_, err = s.service.Resolve("not-a-token", "", "")
+	s.ErrorIs(err, service.ErrShareLinkNotFound)
+}
+
+func (s *ShareLinkServiceSuite) TestPasswordAndDomain() {
+	request := dto.CreateShareLink{DocumentID: "doc1", Role: dto.RoleEditor, Password: "secret", Domain: "@Test.com"}
+
+	token, link, err := s.service.CreateLink("owner@test.com", request)
+	s.Require().NoError(err)
+	s.True(link.HasPassword)
+	s.Equal("test.com", link.Domain)
+
+	_, err = s.service.Resolve(token, "wrong", "user@test.com")
+	s.ErrorIs(err, service.ErrShareLinkPassword)
+	_, err = s.service.Resolve(token, "secret", "")
+	s.ErrorIs(err, service.ErrShareLinkSignIn)
+	_, err = s.service.Resolve(token, "secret", "user@other.com")
+	s.ErrorIs(err, service.ErrShareLinkDomain)
+	_, err = s.service.Resolve(token, "secret", "user@test.com")
+	s.NoError(err)
+}
+
+func (s *ShareLinkServiceSuite) TestRevokeLink() {
+	token, link, err := s.service.CreateLink("owner@test.com", dto.CreateShareLink{DocumentID: "doc1", Role: dto.RoleViewer})
+	s.Require().NoError(err)
+
+	s.ErrorIs(s.service.RevokeLink("doc2", link.ID), service.ErrShareLinkNotFound)
+	s.Require().NoError(s.service.RevokeLink("doc1", link.ID))
+
+	_, err = s.service.Resolve(token, "", "")
+	s.ErrorIs(err, service.ErrShareLinkNotFound)
+	links, err := s.service.ListLinks("doc1")
+	s.Require().NoError(err)
+	s.Empty(links)
+}
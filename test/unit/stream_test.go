@@ -0,0 +1,65 @@
+package unit_tests
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/khallihub/godoc/realtime"
+	"github.com/stretchr/testify/suite"
+)
+
+type StreamTestSuite struct {
+	suite.Suite
+}
+
+func TestStreamTestSuite(t *testing.T) {
+	suite.Run(t, &StreamTestSuite{})
+}
+
+func (uts *StreamTestSuite) TestStreamWritesEvents() {
+	client := &realtime.Client{}
+	client.AttachStream()
+	uts.True(client.Streamed())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client.Stream(r.Context(), w)
+	}))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	uts.Require().NoError(err)
+	defer response.Body.Close()
+	uts.Equal("text/event-stream", response.Header.Get("Content-Type"))
+	reader := bufio.NewReader(response.Body)
+	readLine := func() string {
+		line, err := reader.ReadString('\n')
+		uts.Require().NoError(err)
+		return line
+	}
+
+	uts.True(client.Send([]byte(`{"v":1,"type":"pong"}`)))
+	uts.Equal("data: {\"v\":1,\"type\":\"pong\"}\n", readLine())
+	uts.Equal("\n", readLine())
+
+	// The stream ends with the reason the session was closed for
+	client.CloseWith(4410, "Document deleted")
+	uts.Equal("event: close\n", readLine())
+	uts.Equal("data: {\"code\":4410,\"reason\":\"Document deleted\"}\n", readLine())
+	uts.Equal("\n", readLine())
+	_, err = reader.ReadString('\n')
+	uts.Equal(io.EOF, err)
+}
+
+func (uts *StreamTestSuite) TestStreamEndsWithRequest() {
+	client := &realtime.Client{}
+	client.AttachStream()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	uts.NoError(client.Stream(ctx, httptest.NewRecorder()))
+	// The session is closed, it leaves its hub with the request
+	uts.False(client.Send([]byte("late")))
+}
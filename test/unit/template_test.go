@@ -0,0 +1,40 @@
+package unit_tests
+
+import (
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+)
+
+type TemplateTestSuite struct {
+	suite.Suite
+}
+
+func TestTemplateTestSuite(t *testing.T) {
+	suite.Run(t, &TemplateTestSuite{})
+}
+
+func (uts *TemplateTestSuite) TestFillPlaceholders() {
+	values := map[string]string{"date": "2024-03-01", "author": "Ada"}
+
+	uts.Equal("Minutes 2024-03-01 by Ada", service.FillPlaceholders("Minutes {{date}} by {{author}}", values))
+	uts.Equal("Keep {{unknown}} and {date}", service.FillPlaceholders("Keep {{unknown}} and {date}", values))
+}
+
+func (uts *TemplateTestSuite) TestFillDataPlaceholdersKeepsTemplate() {
+	template := dto.DocumentData{Ops: []map[string]interface{}{
+		{"insert": "Report of {{date}}", "attributes": map[string]interface{}{"bold": true}},
+		{"insert": map[string]interface{}{"image": "{{date}}.png"}},
+		{"insert": "\n"},
+	}}
+
+	filled := service.FillDataPlaceholders(template, map[string]string{"date": "2024-03-01"})
+
+	uts.Equal("Report of 2024-03-01", filled.Ops[0]["insert"])
+	uts.Equal(template.Ops[0]["attributes"], filled.Ops[0]["attributes"])
+	// Embeds are not text and the template itself is left untouched
+	uts.Equal(map[string]interface{}{"image": "{{date}}.png"}, filled.Ops[1]["insert"])
+	uts.Equal("Report of {{date}}", template.Ops[0]["insert"])
+}
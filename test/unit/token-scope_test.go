@@ -0,0 +1,69 @@
+package unit_tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/middlewares"
+	"github.com/stretchr/testify/suite"
+)
+
+type TokenScopeTestSuite struct {
+	suite.Suite
+}
+
+func TestTokenScopeTestSuite(t *testing.T) {
+	suite.Run(t, &TokenScopeTestSuite{})
+}
+
+// Setup code before running the tests in the suite
+func (uts *TokenScopeTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+}
+
+// request runs a request through the middlewares as made with a token of the given scope and
+// documents, returning the status code
+func (uts *TokenScopeTestSuite) request(scope string, documents []string, handlers ...gin.HandlerFunc) int {
+	server := gin.New()
+	server.Use(func(c *gin.Context) {
+		c.Set("scope", scope)
+		c.Set("tokenDocuments", documents)
+	})
+	server.Use(handlers...)
+	server.POST("/folders", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/folders", nil))
+	return recorder.Code
+}
+
+func (uts *TokenScopeTestSuite) TestRejectDocumentTokens() {
+	uts.Equal(http.StatusForbidden, uts.request(dto.TokenScopeWrite, []string{"doc1"}, middlewares.RejectDocumentTokens()))
+	uts.Equal(http.StatusOK, uts.request(dto.TokenScopeWrite, nil, middlewares.RejectDocumentTokens()))
+	// Sessions carry neither a scope nor documents
+	uts.Equal(http.StatusOK, uts.request("", nil, middlewares.RejectDocumentTokens()))
+}
+
+func (uts *TokenScopeTestSuite) TestTokenAllowsDocument() {
+	var allowed, other bool
+	check := func(c *gin.Context) {
+		allowed = middlewares.TokenAllowsDocument(c, "doc1")
+		other = middlewares.TokenAllowsDocument(c, "doc2")
+	}
+	uts.request(dto.TokenScopeRead, []string{"doc1"}, check)
+	uts.True(allowed)
+	uts.False(other)
+
+	uts.request("", nil, check)
+	uts.True(allowed)
+	uts.True(other)
+}
+
+func (uts *TokenScopeTestSuite) TestRequireWriteScope() {
+	uts.Equal(http.StatusForbidden, uts.request(dto.TokenScopeRead, nil, middlewares.RequireWriteScope()))
+	uts.Equal(http.StatusOK, uts.request(dto.TokenScopeWrite, nil, middlewares.RequireWriteScope()))
+}
@@ -0,0 +1,108 @@
+package unit_tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TokenServiceSuite struct {
+	suite.Suite
+	service service.TokenService
+	client  *mongo.Client
+}
+
+func TestTokenServiceSuite(t *testing.T) {
+	suite.Run(t, new(TokenServiceSuite))
+}
+
+func (s *TokenServiceSuite) SetupSuite() {
+	// Setup MongoDB connection
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update with your MongoDB URI
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.client = client
+
+	// Initialize the token service
+	s.service = service.NewTokenService(client, "testdb", "tokens")
+}
+
+func (s *TokenServiceSuite) SetupTest() {
+	// Cleanup existing data in the test database
+	for _, collection := range []string{"tokens", "users"} {
+		_, err := s.client.Database("testdb").Collection(collection).DeleteMany(context.Background(), bson.M{})
+		if err != nil {
+			s.T().Fatal(err)
+		}
+	}
+	// Tokens only authenticate while their owner has an account
+	_, err := s.client.Database("testdb").Collection("users").InsertOne(context.Background(), bson.M{"email": "author@test.com"})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *TokenServiceSuite) TearDownSuite() {
+	// Close MongoDB connection after all tests
+	if err := s.client.Disconnect(context.Background()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *TokenServiceSuite) TestCreateAndAuthenticate() {
+	request := dto.CreateToken{Name: "ci", Scope: dto.TokenScopeRead, Documents: []string{"doc1"}, ExpiresInDays: 30}
+
+	secret, token, err := s.service.CreateToken("author@test.com", request)
+	s.Require().NoError(err)
+	s.True(strings.HasPrefix(secret, service.PersonalAccessTokenPrefix))
+	s.True(strings.HasPrefix(secret, token.Prefix))
+	s.NotNil(token.ExpiresAt)
+
+	authenticated, err := s.service.Authenticate(secret)
+	s.NoError(err)
+	s.Equal("author@test.com", authenticated.Owner)
+	s.Equal(dto.TokenScopeRead, authenticated.Scope)
+	s.Equal([]string{"doc1"}, authenticated.Documents)
+}
+
+func (s *TokenServiceSuite) TestAuthenticateRejectsUnknownToken() {
+	_, err := s.service.Authenticate(service.PersonalAccessTokenPrefix + "unknown")
+
+	s.ErrorIs(err, service.ErrInvalidToken)
+}
+
+func (s *TokenServiceSuite) TestAuthenticateRejectsTokenOfDeletedOwner() {
+	secret, _, err := s.service.CreateToken("author@test.com", dto.CreateToken{Name: "ci", Scope: dto.TokenScopeWrite})
+	s.Require().NoError(err)
+
+	_, err = s.client.Database("testdb").Collection("users").DeleteOne(context.Background(), bson.M{"email": "author@test.com"})
+	s.Require().NoError(err)
+
+	_, err = s.service.Authenticate(secret)
+	s.ErrorIs(err, service.ErrInvalidToken)
+}
+
+func (s *TokenServiceSuite) TestRevokeToken() {
+	secret, token, err := s.service.CreateToken("author@test.com", dto.CreateToken{Name: "ci", Scope: dto.TokenScopeWrite})
+	s.Require().NoError(err)
+
+	// Only the owner can revoke a token
+	s.ErrorIs(s.service.RevokeToken("other@test.com", token.ID), service.ErrTokenNotFound)
+	s.NoError(s.service.RevokeToken("author@test.com", token.ID))
+
+	_, err = s.service.Authenticate(secret)
+	s.ErrorIs(err, service.ErrInvalidToken)
+
+	tokens, err := s.service.ListTokens("author@test.com")
+	s.NoError(err)
+	s.Empty(tokens)
+}
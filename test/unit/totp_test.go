@@ -0,0 +1,63 @@
+package unit_tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+)
+
+type TOTPTestSuite struct {
+	suite.Suite
+	// base32 encoding of the RFC 6238 test secret "12345678901234567890"
+	secret string
+}
+
+func TestTOTPTestSuite(t *testing.T) {
+	suite.Run(t, &TOTPTestSuite{})
+}
+
+func (uts *TOTPTestSuite) SetupTest() {
+	uts.secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+}
+
+func (uts *TOTPTestSuite) TestGenerateTOTPCodeMatchesRFCVectors() {
+	code, err := service.GenerateTOTPCode(uts.secret, time.Unix(59, 0))
+	uts.NoError(err)
+	uts.Equal("287082", code)
+
+	code, err = service.GenerateTOTPCode(uts.secret, time.Unix(1111111109, 0))
+	uts.NoError(err)
+	uts.Equal("081804", code)
+}
+
+func (uts *TOTPTestSuite) TestValidateTOTPCodeAcceptsAdjacentStep() {
+	now := time.Unix(1111111109, 0)
+	previous, err := service.GenerateTOTPCode(uts.secret, now.Add(-30*time.Second))
+	uts.Require().NoError(err)
+
+	step, ok := service.ValidateTOTPCode(uts.secret, previous, now)
+	uts.True(ok)
+	uts.Equal(now.Unix()/30-1, step)
+}
+
+func (uts *TOTPTestSuite) TestValidateTOTPCodeRejectsStaleCode() {
+	now := time.Unix(1111111109, 0)
+	stale, err := service.GenerateTOTPCode(uts.secret, now.Add(-5*time.Minute))
+	uts.Require().NoError(err)
+
+	_, ok := service.ValidateTOTPCode(uts.secret, stale, now)
+	uts.False(ok)
+}
+
+func (uts *TOTPTestSuite) TestProvisioningURI() {
+	secret, err := service.GenerateTOTPSecret()
+	uts.Require().NoError(err)
+
+	uri := service.TOTPProvisioningURI("GoDoc", "author@test.com", secret)
+	uts.True(strings.HasPrefix(uri, "otpauth://totp/GoDoc:author@test.com?"))
+	uts.Contains(uri, "secret="+secret)
+	uts.Contains(uri, "issuer=GoDoc")
+}
@@ -0,0 +1,157 @@
+package unit_tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khallihub/godoc/logging"
+	"github.com/khallihub/godoc/middlewares"
+	"github.com/khallihub/godoc/tracing"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A trace context sent by a client, or the load balancer, in the W3C format
+const (
+	parentTraceID   = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parentSpanID    = "00f067aa0ba902b7"
+	parentTraceCtx  = "00-" + parentTraceID + "-" + parentSpanID + "-01"
+	traceparentName = "traceparent"
+)
+
+type TracingTestSuite struct {
+	suite.Suite
+	spans    *tracetest.InMemoryExporter
+	provider *sdktrace.TracerProvider
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	suite.Run(t, &TracingTestSuite{})
+}
+
+// Setup code before running the tests in the suite
+func (uts *TracingTestSuite) SetupSuite() {
+	gin.SetMode(gin.TestMode)
+	_, err := tracing.Setup(context.Background(), "godoc-test")
+	uts.Require().NoError(err)
+	uts.spans = tracetest.NewInMemoryExporter()
+	uts.provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(uts.spans))
+	otel.SetTracerProvider(uts.provider)
+}
+
+// Setup code before running each test
+func (uts *TracingTestSuite) SetupTest() {
+	uts.spans.Reset()
+}
+
+// Teardown code after running the tests in the suite
+func (uts *TracingTestSuite) TearDownSuite() {
+	uts.provider.Shutdown(context.Background())
+}
+
+func (uts *TracingTestSuite) TestContinuesIncomingTrace() {
+	server := gin.New()
+	server.Use(otelgin.Middleware("godoc-test"))
+	server.GET("/documents/:id", func(ctx *gin.Context) {
+		_, span := tracing.Tracer.Start(ctx.Request.Context(), "DocumentController.GetDocumentByID")
+		span.End()
+		ctx.Status(http.StatusOK)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/documents/abc", nil)
+	request.Header.Set(traceparentName, parentTraceCtx)
+	server.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := uts.spans.GetSpans()
+	uts.Require().Len(spans, 2)
+	controllerSpan, routeSpan := spans[0], spans[1]
+	uts.Equal("/documents/:id", routeSpan.Name)
+	uts.Equal(parentTraceID, routeSpan.SpanContext.TraceID().String())
+	uts.Equal(parentSpanID, routeSpan.Parent.SpanID().String())
+	uts.True(routeSpan.Parent.IsRemote())
+	uts.Equal(routeSpan.SpanContext.SpanID(), controllerSpan.Parent.SpanID())
+	uts.Equal(parentTraceID, controllerSpan.SpanContext.TraceID().String())
+}
+
+func (uts *TracingTestSuite) TestInjectsTraceContext() {
+	ctx, span := tracing.Tracer.Start(context.Background(), "LoadBalancer.serveProxy")
+	defer span.End()
+
+	header := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	traceparent := header.Get(traceparentName)
+	uts.Equal("00-"+span.SpanContext().TraceID().String()+"-"+span.SpanContext().SpanID().String()+"-01", traceparent)
+}
+
+func (uts *TracingTestSuite) TestLogsCarryTraceID() {
+	var output bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(logging.New(&output, "info", "json"))
+	defer slog.SetDefault(defaultLogger)
+
+	server := gin.New()
+	server.Use(otelgin.Middleware("godoc-test"), middlewares.RequestID())
+	server.GET("/health", func(ctx *gin.Context) {
+		logging.FromContext(ctx.Request.Context()).Info("Checked")
+		ctx.Status(http.StatusOK)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/health", nil)
+	request.Header.Set(traceparentName, parentTraceCtx)
+	server.ServeHTTP(httptest.NewRecorder(), request)
+
+	var line map[string]interface{}
+	uts.Require().NoError(json.Unmarshal(output.Bytes(), &line))
+	uts.Equal(parentTraceID, line["trace_id"])
+}
+
+func (uts *TracingTestSuite) TestFail() {
+	_, span := tracing.Tracer.Start(context.Background(), "flushDocument")
+	tracing.Fail(span, nil)
+	tracing.Fail(span, errors.New("write failed"))
+	span.End()
+
+	spans := uts.spans.GetSpans()
+	uts.Require().Len(spans, 1)
+	uts.Equal(codes.Error, spans[0].Status.Code)
+	uts.Equal("write failed", spans[0].Status.Description)
+	uts.Len(spans[0].Events, 1)
+}
+
+func (uts *TracingTestSuite) TestExporters() {
+	uts.T().Setenv("OTEL_TRACES_EXPORTER", "carrier-pigeon")
+	_, err := tracing.Setup(context.Background(), "godoc-test")
+	uts.Error(err)
+
+	uts.T().Setenv("OTEL_TRACES_EXPORTER", tracing.ExporterNone)
+	shutdown, err := tracing.Setup(context.Background(), "godoc-test")
+	uts.Require().NoError(err)
+	uts.NoError(shutdown(context.Background()))
+
+	// The spans of a service carry its name
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := tracing.NewProvider(context.Background(), "godoc-test", exporter)
+	uts.Require().NoError(err)
+	_, span := provider.Tracer("test").Start(context.Background(), "syncDatabaseWithCache")
+	span.End()
+	uts.NoError(provider.ForceFlush(context.Background()))
+	defer provider.Shutdown(context.Background())
+	uts.Require().Len(exporter.GetSpans(), 1)
+	service, _ := exporter.GetSpans()[0].Resource.Set().Value(semconv.ServiceNameKey)
+	uts.Equal("godoc-test", service.AsString())
+	// Setup only installs a provider when there's an exporter
+	uts.Equal(trace.TracerProvider(uts.provider), otel.GetTracerProvider())
+}
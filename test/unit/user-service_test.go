@@ -0,0 +1,156 @@
+package unit_tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/khallihub/godoc/dto"
+	"github.com/khallihub/godoc/service"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserServiceSuite struct {
+	suite.Suite
+	service  service.UserService
+	client   *mongo.Client
+	database *mongo.Database
+}
+
+func TestUserServiceSuite(t *testing.T) {
+	suite.Run(t, new(UserServiceSuite))
+}
+
+func (s *UserServiceSuite) SetupSuite() {
+	// Setup MongoDB connection
+	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017") // Update with your MongoDB URI
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	s.client = client
+	s.database = client.Database("testdb")
+
+	// Initialize the user service
+	s.service = service.NewUserService(client, "testdb", "users", service.NewMailService())
+}
+
+func (s *UserServiceSuite) SetupTest() {
+	// Cleanup and prepare data before each test
+	s.cleanupDatabase()
+	s.prepareTestData()
+}
+
+func (s *UserServiceSuite) TearDownSuite() {
+	// Close MongoDB connection after all tests
+	if err := s.client.Disconnect(context.Background()); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *UserServiceSuite) cleanupDatabase() {
+	for _, collection := range []string{"users", "documents", "tokens"} {
+		_, err := s.database.Collection(collection).DeleteMany(context.Background(), bson.M{})
+		if err != nil {
+			s.T().Fatal(err)
+		}
+	}
+}
+
+func (s *UserServiceSuite) prepareTestData() {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("testpassword"), bcrypt.DefaultCost)
+	users := []interface{}{
+		bson.D{{Key: "username", Value: "Test User"}, {Key: "email", Value: "testuser@test.com"}, {Key: "password", Value: string(hashedPassword)}},
+		bson.D{{Key: "username", Value: "Other User"}, {Key: "email", Value: "other@test.com"}, {Key: "password", Value: string(hashedPassword)}},
+	}
+	if _, err := s.database.Collection("users").InsertMany(context.Background(), users); err != nil {
+		s.T().Fatal(err)
+	}
+
+	documents := []interface{}{
+		bson.D{{Key: "author", Value: "testuser@test.com"}, {Key: "title", Value: "Owned"}, {Key: "acl", Value: []dto.ACLEntry{{Principal: "testuser@test.com", Role: dto.RoleOwner}}}},
+		bson.D{{Key: "author", Value: "other@test.com"}, {Key: "title", Value: "Shared"}, {Key: "acl", Value: []dto.ACLEntry{{Principal: "other@test.com", Role: dto.RoleOwner}, {Principal: "testuser@test.com", Role: dto.RoleEditor}}}},
+	}
+	if _, err := s.database.Collection("documents").InsertMany(context.Background(), documents); err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *UserServiceSuite) TestGetProfileHidesPassword() {
+	profile, err := s.service.GetProfile("testuser@test.com")
+
+	s.NoError(err)
+	s.Equal("Test User", profile.DisplayName)
+	s.Equal("testuser@test.com", profile.Email)
+}
+
+func (s *UserServiceSuite) TestUpdateProfile() {
+	name := "Renamed"
+	avatar := "https://example.com/avatar.png"
+
+	user, err := s.service.UpdateProfile("testuser@test.com", dto.ProfileUpdate{DisplayName: &name, AvatarURL: &avatar})
+
+	s.NoError(err)
+	s.Equal(name, user.DisplayName)
+	s.Equal(avatar, user.AvatarURL)
+}
+
+func (s *UserServiceSuite) TestRequestEmailChangeRejectsTakenEmail() {
+	err := s.service.RequestEmailChange("testuser@test.com", "testpassword", "other@test.com")
+
+	s.ErrorIs(err, service.ErrEmailTaken)
+}
+
+func (s *UserServiceSuite) TestDeleteUserRemovesOwnedAndSharedAccess() {
+	deleted, err := s.service.DeleteUser("testuser@test.com", "testpassword", "")
+	s.Require().NoError(err)
+	s.Len(deleted, 1)
+
+	count, err := s.database.Collection("documents").CountDocuments(context.Background(), bson.M{"author": "testuser@test.com"})
+	s.NoError(err)
+	s.Equal(int64(0), count)
+
+	var shared dto.Document
+	err = s.database.Collection("documents").FindOne(context.Background(), bson.M{"title": "Shared"}).Decode(&shared)
+	s.NoError(err)
+	s.Equal([]dto.ACLEntry{{Principal: "other@test.com", Role: dto.RoleOwner}}, shared.ACL)
+}
+
+func (s *UserServiceSuite) TestDeleteUserDeletesTokens() {
+	tokens := []interface{}{
+		bson.M{"owner": "testuser@test.com", "name": "ci"},
+		bson.M{"owner": "other@test.com", "name": "ci"},
+	}
+	_, err := s.database.Collection("tokens").InsertMany(context.Background(), tokens)
+	s.Require().NoError(err)
+
+	_, err = s.service.DeleteUser("testuser@test.com", "testpassword", "")
+	s.Require().NoError(err)
+
+	count, err := s.database.Collection("tokens").CountDocuments(context.Background(), bson.M{"owner": "testuser@test.com"})
+	s.NoError(err)
+	s.Equal(int64(0), count)
+	count, err = s.database.Collection("tokens").CountDocuments(context.Background(), bson.M{"owner": "other@test.com"})
+	s.NoError(err)
+	s.Equal(int64(1), count)
+}
+
+func (s *UserServiceSuite) TestDeleteUserTransfersOwnedDocuments() {
+	deleted, err := s.service.DeleteUser("testuser@test.com", "testpassword", "other@test.com")
+	s.Require().NoError(err)
+	s.Empty(deleted)
+
+	var owned dto.Document
+	err = s.database.Collection("documents").FindOne(context.Background(), bson.M{"title": "Owned"}).Decode(&owned)
+	s.NoError(err)
+	s.Equal("other@test.com", owned.Author)
+}
+
+func (s *UserServiceSuite) TestDeleteUserRequiresPassword() {
+	_, err := s.service.DeleteUser("testuser@test.com", "wrongpassword", "")
+
+	s.ErrorIs(err, service.ErrInvalidPassword)
+}
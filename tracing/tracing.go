@@ -0,0 +1,112 @@
+// Package tracing sets up the OpenTelemetry traces of the server and the load balancer, which
+// pass the trace context to each other in W3C traceparent headers
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts the spans of the godoc code, the libraries have their own
+var Tracer = otel.Tracer("github.com/khallihub/godoc")
+
+// Exporters picked by OTEL_TRACES_EXPORTER
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Setup installs the tracer provider of a service and the W3C trace context propagator.
+// OTEL_TRACES_EXPORTER picks where spans go: otlp sends them over HTTP to the collector at
+// OTEL_EXPORTER_OTLP_ENDPOINT (http://localhost:4318 by default), stdout prints them, and none
+// or nothing keeps tracing off while still passing the trace context on. shutdown exports the
+// spans left.
+func Setup(ctx context.Context, service string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	switch name := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER")); name {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider, err := NewProvider(ctx, service, exporter)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider batching the spans of a service to an exporter.
+// OTEL_RESOURCE_ATTRIBUTES adds to the attributes of the service.
+func NewProvider(ctx context.Context, service string, exporter sdktrace.SpanExporter) (*sdktrace.TracerProvider, error) {
+	serviceResource, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(service)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(serviceResource)), nil
+}
+
+// Fail marks a span as failed with an error, nil leaving it as it is
+func Fail(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// MongoMonitor traces the MongoDB commands, which then run in the span of the caller's
+// context, and passes the events on to next. The commands themselves aren't recorded as they
+// hold the documents.
+func MongoMonitor(next *event.CommandMonitor) *event.CommandMonitor {
+	traced := otelmongo.NewMonitor()
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, started *event.CommandStartedEvent) {
+			traced.Started(ctx, started)
+			if next.Started != nil {
+				next.Started(ctx, started)
+			}
+		},
+		Succeeded: func(ctx context.Context, succeeded *event.CommandSucceededEvent) {
+			traced.Succeeded(ctx, succeeded)
+			if next.Succeeded != nil {
+				next.Succeeded(ctx, succeeded)
+			}
+		},
+		Failed: func(ctx context.Context, failed *event.CommandFailedEvent) {
+			traced.Failed(ctx, failed)
+			if next.Failed != nil {
+				next.Failed(ctx, failed)
+			}
+		},
+	}
+}